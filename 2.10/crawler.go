@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// crawler downloads a site breadth first with a pool of workers. Pages
+// are fetched level by level, so that every page is saved once at the
+// depth of the shortest chain of links leading to it. Resources are
+// fetched as soon as the page using them has been parsed.
+//
+// Unless ignoreRobots is set, the robots.txt of every host is honored,
+// including its Crawl-delay. Requests to a host are spaced by the longer
+// of wait and that delay, varied between half and one and a half times
+// it when randomWait is set.
+//
+// With a manifest, pages and resources saved by an earlier run are only
+// downloaded again when the server reports them modified.
+type crawler struct {
+	client          *http.Client
+	dir             string
+	baseURL         string
+	maxDepth        int
+	concurrency     int
+	visited         *visitedSet
+	hosts           *hostLimiter
+	log             io.Writer
+	userAgent       string
+	wait            time.Duration
+	randomWait      bool
+	ignoreRobots    bool
+	robots          *robotsCache
+	pacer           *hostPacer
+	resume          bool
+	retries         int
+	backoff         time.Duration
+	manifest        *manifest
+	deleteAfterSync bool
+}
+
+// defaultUserAgent identifies the mirror to servers and robots.txt files.
+const defaultUserAgent = "site-mirror/1.0"
+
+func newCrawler(dir, baseURL string, maxDepth, concurrency, perHost int) *crawler {
+	return &crawler{
+		client:      http.DefaultClient,
+		dir:         dir,
+		baseURL:     baseURL,
+		maxDepth:    maxDepth,
+		concurrency: concurrency,
+		visited:     newVisitedSet(),
+		hosts:       newHostLimiter(perHost),
+		log:         os.Stdout,
+		userAgent:   defaultUserAgent,
+		robots:      newRobotsCache(),
+		pacer:       newHostPacer(),
+		retries:     3,
+		backoff:     time.Second,
+	}
+}
+
+// visitedSet records the URLs that have been queued, so that every page
+// and resource is downloaded once. It is safe for concurrent use.
+type visitedSet struct {
+	urls  map[string]bool
+	mutex *sync.Mutex
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{urls: make(map[string]bool), mutex: &sync.Mutex{}}
+}
+
+// add marks the URL as visited and tells whether it was not already.
+func (vs *visitedSet) add(u string) bool {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+
+	if vs.urls[u] {
+		return false
+	}
+	vs.urls[u] = true
+	return true
+}
+
+// hostLimiter bounds the number of requests in flight to each host. A
+// limit of 0 means no limit.
+type hostLimiter struct {
+	limit int
+	slots map[string]chan struct{}
+	mutex *sync.Mutex
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{}), mutex: &sync.Mutex{}}
+}
+
+// acquire waits for a free slot of the host and returns the function that
+// gives it back.
+func (hl *hostLimiter) acquire(host string) func() {
+	if hl.limit <= 0 {
+		return func() {}
+	}
+	hl.mutex.Lock()
+	slots, ok := hl.slots[host]
+	if !ok {
+		slots = make(chan struct{}, hl.limit)
+		hl.slots[host] = slots
+	}
+	hl.mutex.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// workQueue is an unbounded queue of tasks for the workers. Workers add
+// tasks of their own without blocking, so the pool cannot deadlock.
+type workQueue struct {
+	tasks  []func()
+	closed bool
+	mutex  *sync.Mutex
+	cond   *sync.Cond
+}
+
+func newWorkQueue() *workQueue {
+	mutex := &sync.Mutex{}
+	return &workQueue{mutex: mutex, cond: sync.NewCond(mutex)}
+}
+
+func (q *workQueue) push(task func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.tasks = append(q.tasks, task)
+	q.cond.Signal()
+}
+
+// close lets the workers stop once the queue has been drained.
+func (q *workQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// work runs tasks until the queue is closed and empty.
+func (q *workQueue) work() {
+	for {
+		q.mutex.Lock()
+		for len(q.tasks) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.tasks) == 0 {
+			q.mutex.Unlock()
+			return
+		}
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		q.mutex.Unlock()
+
+		task()
+	}
+}
+
+// crawl downloads the start page and, down to maxDepth levels, the pages
+// it links to under the base URL, with the resources of all of them. The
+// error is that of the start page; later failures are only reported. With
+// a manifest it is saved at the end, after the sync.
+func (c *crawler) crawl(startURL string) error {
+	queue := newWorkQueue()
+	var workers sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			queue.work()
+		}()
+	}
+
+	var startErr error
+	c.visited.add(startURL)
+	frontier := []string{startURL}
+	for depth := 1; depth <= c.maxDepth && len(frontier) > 0; depth++ {
+		// links are kept per page so that the next level is in document
+		// order whatever order the pages complete in
+		found := make([][]string, len(frontier))
+		var level sync.WaitGroup
+		for i, pageURL := range frontier {
+			level.Add(1)
+			queue.push(func() {
+				defer level.Done()
+				links, resources, err := c.downloadPage(pageURL)
+				if err != nil {
+					if depth == 1 {
+						startErr = err
+					} else {
+						fmt.Fprintln(c.log, "Error while downloading page:", pageURL, err)
+					}
+					c.keepUnlessGone(pageURL, err)
+					return
+				}
+				c.searched(pageURL, depth)
+				for _, resURL := range resources {
+					if c.visited.add(resURL) {
+						queue.push(func() {
+							if err := c.downloadResource(resURL); err != nil {
+								fmt.Fprintln(c.log, "Error while downloading resource:", resURL, err)
+								c.keepUnlessGone(resURL, err)
+							}
+						})
+					}
+				}
+				found[i] = links
+			})
+		}
+		level.Wait()
+
+		frontier = nil
+		if depth == c.maxDepth {
+			break
+		}
+		for _, links := range found {
+			for _, link := range links {
+				if strings.HasPrefix(link, c.baseURL) && c.visited.add(link) {
+					frontier = append(frontier, link)
+				}
+			}
+		}
+	}
+
+	queue.close()
+	workers.Wait()
+	if c.manifest != nil {
+		// a run that failed from the start, or did not even start, has
+		// found nothing, which does not mean that everything is gone
+		if err := c.sync(c.deleteAfterSync && startErr == nil && c.maxDepth >= 1); err != nil {
+			fmt.Fprintln(c.log, "Error while saving the manifest:", err)
+		}
+	}
+	return startErr
+}
+
+// errDisallowed is returned for the URLs that robots.txt disallows.
+var errDisallowed = errors.New("disallowed by robots.txt")
+
+// statusError reports a response with an unexpected status.
+type statusError struct {
+	kind string
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to download %s: %s, status: %d", e.kind, e.url, e.code)
+}
+
+// fetch requests the URL, with the extra headers if any, while holding a
+// slot of its host and hands the response to handle. URLs that robots.txt
+// disallows are not requested.
+func (c *crawler) fetch(rawURL string, header http.Header, handle func(resp *http.Response) error) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	rules := allowAll
+	if !c.ignoreRobots {
+		rules = c.robotsRules(u)
+		if !rules.allowed(u) {
+			return fmt.Errorf("%s: %w", rawURL, errDisallowed)
+		}
+	}
+
+	release := c.hosts.acquire(u.Host)
+	defer release()
+	c.pacer.wait(u.Host, c.delay(rules))
+
+	resp, err := c.get(rawURL, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return handle(resp)
+}
+
+// get sends a GET request with the user agent of the crawler and the
+// extra headers.
+func (c *crawler) get(rawURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return c.client.Do(req)
+}
+
+// delay returns the time to leave before the next request to a host.
+func (c *crawler) delay(rules *robotsRules) time.Duration {
+	d := max(c.wait, rules.crawlDelay)
+	if c.randomWait && d > 0 {
+		d = time.Duration((0.5 + rand.Float64()) * float64(d))
+	}
+	return d
+}
+
+// robotsRules returns the rules of the host of u, downloading its
+// robots.txt the first time. A missing file allows everything and one
+// that cannot be read, because of a network or server error, disallows
+// everything.
+func (c *crawler) robotsRules(u *url.URL) *robotsRules {
+	return c.robots.get(u.Host, func() *robotsRules {
+		robotsURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+
+		release := c.hosts.acquire(u.Host)
+		defer release()
+		c.pacer.wait(u.Host, c.wait)
+
+		resp, err := c.get(robotsURL, nil)
+		if err != nil {
+			fmt.Fprintln(c.log, "Error while downloading robots.txt:", robotsURL, err)
+			return disallowAll
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return parseRobots(resp.Body, c.userAgent)
+		case resp.StatusCode >= 500:
+			fmt.Fprintln(c.log, "Error while downloading robots.txt:", robotsURL, "status:", resp.StatusCode)
+			return disallowAll
+		default:
+			return allowAll
+		}
+	})
+}
+
+// downloadPage saves a page with its links rewritten to the local copies
+// and returns the pages and resources it links to. A page that has not
+// been modified since the last run is not saved again.
+func (c *crawler) downloadPage(pageURL string) (pageLinks, resourceLinks []string, err error) {
+	fmt.Fprintln(c.log, "Downloading page:", pageURL)
+
+	conditional := c.conditionalHeader(pageURL)
+	err = c.retry(pageURL, func() error {
+		pageLinks, resourceLinks = nil, nil
+		return c.fetch(pageURL, conditional, func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusNotModified && conditional != nil {
+				// the links are those the page had when it was saved
+				fmt.Fprintln(c.log, "Not modified:", pageURL)
+				entry, _ := c.manifest.get(pageURL)
+				pageLinks, resourceLinks = entry.Links, entry.Resources
+				c.manifest.keep(pageURL)
+				return nil
+			}
+			if resp.StatusCode != http.StatusOK {
+				return &statusError{"page", pageURL, resp.StatusCode}
+			}
+
+			u, err := url.Parse(pageURL)
+			if err != nil {
+				return err
+			}
+			filePath := getLocalPath(u, c.dir)
+			os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+
+			file, err := os.Create(filePath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+
+			doc, err := html.Parse(strings.NewReader(string(bodyBytes)))
+			if err != nil {
+				_, err = file.Write(bodyBytes)
+				return err
+			}
+
+			var f func(*html.Node)
+			f = func(n *html.Node) {
+				if n.Type == html.ElementNode {
+					for _, a := range n.Attr {
+						if a.Key == "href" || a.Key == "src" {
+							if strings.HasPrefix(a.Val, "#") {
+								continue
+							}
+
+							resourceURL, err := url.Parse(a.Val)
+							if err != nil {
+								continue
+							}
+							absoluteURL := resp.Request.URL.ResolveReference(resourceURL)
+
+							localPath := getLocalPath(absoluteURL, c.dir)
+							a.Val = filepath.ToSlash(localPath[len(c.dir)+1:])
+
+							if isHTMLPage(absoluteURL) {
+								pageLinks = append(pageLinks, absoluteURL.String())
+							} else {
+								resourceLinks = append(resourceLinks, absoluteURL.String())
+							}
+						}
+					}
+				}
+				for child := n.FirstChild; child != nil; child = child.NextSibling {
+					f(child)
+				}
+			}
+			f(doc)
+
+			if err := html.Render(file, doc); err != nil {
+				return err
+			}
+			c.remember(pageURL, filePath, resp.Header, pageLinks, resourceLinks)
+			return nil
+		})
+	})
+	return pageLinks, resourceLinks, err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSite serves pages from a map of paths to bodies and counts the
+// requests for each path, the user agents and the times they arrived.
+type testSite struct {
+	pages map[string]string
+	delay time.Duration
+
+	mutex    *sync.Mutex
+	hits     map[string]int
+	agents   map[string]bool
+	times    []time.Time
+	inFlight atomic.Int32
+	maxShown atomic.Int32
+}
+
+func newTestSite(pages map[string]string) *testSite {
+	return &testSite{pages: pages, mutex: &sync.Mutex{}, hits: make(map[string]int), agents: make(map[string]bool)}
+}
+
+func (s *testSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		max := s.maxShown.Load()
+		if n <= max || s.maxShown.CompareAndSwap(max, n) {
+			break
+		}
+	}
+
+	s.mutex.Lock()
+	s.hits[r.URL.Path]++
+	s.agents[r.UserAgent()] = true
+	s.times = append(s.times, time.Now())
+	s.mutex.Unlock()
+
+	time.Sleep(s.delay)
+	body, ok := s.pages[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	io.WriteString(w, body)
+}
+
+func (s *testSite) requested() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var paths []string
+	for p, n := range s.hits {
+		for i := 0; i < n; i++ {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+var linkedSite = map[string]string{
+	"/": `<html><body><a href="#top">top</a><a href="/a.html">a</a><a href="/b/">b</a>
+		<link href="/style.css"><img src="/logo.png"><a href="http://other.invalid/x.html">x</a></body></html>`,
+	"/a.html":    `<a href="/c.html">c</a><a href="/a.html">self</a><link href="/style.css">`,
+	"/b/":        `<a href="/c.html">c</a><img src="img.png">`,
+	"/b/img.png": "png",
+	"/c.html":    `<a href="/d.html">d</a>`,
+	"/d.html":    `<a href="/missing.html">missing</a>`,
+	"/style.css": "css",
+	"/logo.png":  "png",
+}
+
+func TestCrawlDepth(t *testing.T) {
+	testCases := []struct {
+		depth     int
+		requested []string
+	}{
+		{0, nil},
+		{1, []string{"/", "/logo.png", "/robots.txt", "/style.css"}},
+		{2, []string{"/", "/a.html", "/b/", "/b/img.png", "/logo.png", "/robots.txt", "/style.css"}},
+		{3, []string{"/", "/a.html", "/b/", "/b/img.png", "/c.html", "/logo.png", "/robots.txt", "/style.css"}},
+		{5, []string{"/", "/a.html", "/b/", "/b/img.png", "/c.html", "/d.html", "/logo.png", "/missing.html", "/robots.txt", "/style.css"}},
+	}
+
+	for _, tc := range testCases {
+		site := newTestSite(linkedSite)
+		server := httptest.NewServer(site)
+		dir := t.TempDir()
+
+		c := newCrawler(dir, server.URL+"/", tc.depth, 4, 2)
+		c.log = io.Discard
+		err := c.crawl(server.URL + "/")
+		server.Close()
+
+		if err != nil {
+			t.Errorf("unexpected error for depth %d: %v", tc.depth, err)
+		}
+		if requested := site.requested(); !reflect.DeepEqual(requested, tc.requested) {
+			t.Errorf("expected requests %q, got %q for depth %d", tc.requested, requested, tc.depth)
+		}
+	}
+}
+
+func TestCrawlSavesFiles(t *testing.T) {
+	site := newTestSite(linkedSite)
+	server := httptest.NewServer(site)
+	defer server.Close()
+	dir := t.TempDir()
+
+	c := newCrawler(dir, server.URL+"/", 2, 3, 1)
+	c.log = io.Discard
+	if err := c.crawl(server.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, name := range []string{"index.html", "a.html", "b/index.html", "b/img.png", "style.css", "logo.png"} {
+		if _, err := os.Stat(filepath.Join(dir, host, name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, host, "style.css"))
+	if err != nil || string(data) != "css" {
+		t.Errorf("expected style.css to contain %q, got %q (%v)", "css", data, err)
+	}
+}
+
+func TestCrawlStartPageError(t *testing.T) {
+	site := newTestSite(map[string]string{})
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	c := newCrawler(t.TempDir(), server.URL+"/", 2, 2, 2)
+	c.log = io.Discard
+	if err := c.crawl(server.URL + "/"); err == nil || !strings.Contains(err.Error(), "status: 404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+}
+
+func TestCrawlPerHostLimit(t *testing.T) {
+	pages := map[string]string{}
+	var index strings.Builder
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("/img%d.png", i)
+		pages[name] = "png"
+		fmt.Fprintf(&index, `<img src="%s">`, name)
+	}
+	pages["/"] = index.String()
+
+	for _, limit := range []int{1, 3} {
+		site := newTestSite(pages)
+		site.delay = 20 * time.Millisecond
+		server := httptest.NewServer(site)
+
+		c := newCrawler(t.TempDir(), server.URL+"/", 1, 8, limit)
+		c.log = io.Discard
+		err := c.crawl(server.URL + "/")
+		server.Close()
+
+		if err != nil {
+			t.Errorf("unexpected error with a limit of %d: %v", limit, err)
+		}
+		if max := int(site.maxShown.Load()); max > limit {
+			t.Errorf("expected at most %d requests at a time, got %d", limit, max)
+		}
+		if n := len(site.requested()); n != 14 {
+			t.Errorf("expected 14 requests, got %d", n)
+		}
+	}
+}
+
+func TestVisitedSet(t *testing.T) {
+	vs := newVisitedSet()
+	var added atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if vs.add("http://example.com/") {
+				added.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if added.Load() != 1 {
+		t.Errorf("expected the URL to be added once, got %d", added.Load())
+	}
+}
+
+func TestGetLocalPath(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"http://example.com/", "out/example.com/index.html"},
+		{"http://example.com/docs", "out/example.com/docs/index.html"},
+		{"http://example.com/docs/", "out/example.com/docs/index.html"},
+		{"http://example.com/css/site.css", "out/example.com/css/site.css"},
+	}
+
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.url)
+		if result := filepath.ToSlash(getLocalPath(u, "out")); result != tc.expected {
+			t.Errorf("expected %q, got %q for %q", tc.expected, result, tc.url)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNotModified tells that the local copy of a resource is up to date.
+var errNotModified = errors.New("not modified")
+
+// maxBackoff caps the wait between two attempts of a download.
+const maxBackoff = 30 * time.Second
+
+// retryable tells whether a failed download may succeed if tried again:
+// network errors and server errors may, a missing file or a URL that
+// robots.txt disallows will not.
+func retryable(err error) bool {
+	if errors.Is(err, errDisallowed) || errors.Is(err, errNotModified) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// retry calls attempt until it succeeds, fails for good or has been
+// retried c.retries times, waiting twice as long before each new attempt.
+func (c *crawler) retry(rawURL string, attempt func() error) error {
+	wait := c.backoff
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil || i >= c.retries || !retryable(err) {
+			return err
+		}
+		fmt.Fprintln(c.log, "Retrying in", wait, "after error:", rawURL, err)
+		time.Sleep(wait)
+		wait = min(wait*2, maxBackoff)
+	}
+}
+
+// downloadResource saves a resource. The data goes to a .part file that
+// is renamed into place once complete, and a retry after a dropped
+// connection goes on where the last attempt stopped. With c.resume set a
+// .part file left by an earlier run is continued too. A resource that has
+// not been modified since the last run is not downloaded again.
+func (c *crawler) downloadResource(resURL string) error {
+	fmt.Fprintln(c.log, "Downloading resourse:", resURL)
+
+	u, err := url.Parse(resURL)
+	if err != nil {
+		return err
+	}
+	savePath := getLocalPath(u, c.dir)
+	os.MkdirAll(filepath.Dir(savePath), os.ModePerm)
+
+	partPath := savePath + ".part"
+	if !c.resume {
+		os.Remove(partPath)
+		os.Remove(partPath + validatorSuffix)
+	}
+
+	var conditional http.Header
+	if _, err := os.Stat(partPath); err != nil {
+		conditional = c.conditionalHeader(resURL)
+	}
+
+	var header http.Header
+	err = c.retry(resURL, func() error {
+		var err error
+		header, err = c.downloadPart(resURL, partPath, conditional)
+		return err
+	})
+	if errors.Is(err, errNotModified) {
+		fmt.Fprintln(c.log, "Not modified:", resURL)
+		os.Remove(partPath)
+		os.Remove(partPath + validatorSuffix)
+		c.manifest.keep(resURL)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, savePath); err != nil {
+		return err
+	}
+	os.Remove(partPath + validatorSuffix)
+	c.remember(resURL, savePath, header, nil, nil)
+	return nil
+}
+
+// validatorSuffix names the file next to a .part file that holds the
+// If-Range value of the resource the .part file was started from. It is
+// written before any data, so that it is there even when the download is
+// killed.
+const validatorSuffix = ".validator"
+
+// rangeValidator returns the If-Range value of a response: its strong
+// entity tag, or else its Last-Modified time, or "" when it has neither.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// downloadPart appends the rest of the resource to the .part file. When
+// the file is not empty only the missing range is requested, on the
+// condition that the resource is the one the file was started from, as
+// recorded in the validator file. A .part file without one, or a server
+// that ignores the range or finds the resource changed, gets the resource
+// whole and the file is started over. An empty file is requested with the
+// conditional headers, if any, and errNotModified returned for a 304.
+// The header of the last response is returned.
+func (c *crawler) downloadPart(resURL, partPath string, conditional http.Header) (http.Header, error) {
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size()
+
+	header := conditional
+	if offset > 0 {
+		header = http.Header{}
+		validator, err := os.ReadFile(partPath + validatorSuffix)
+		if err == nil && len(validator) > 0 {
+			header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			header.Set("If-Range", string(validator))
+		}
+	}
+
+	var respHeader http.Header
+	err = c.fetch(resURL, header, func(resp *http.Response) error {
+		respHeader = resp.Header
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			if conditional != nil && offset == 0 {
+				return errNotModified
+			}
+			return &statusError{"resource", resURL, resp.StatusCode}
+		case http.StatusOK:
+			offset = 0
+		case http.StatusPartialContent:
+			start, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+			if err != nil || start != offset {
+				// the next attempt starts from the beginning
+				file.Truncate(0)
+				return fmt.Errorf("failed to download resource: %s, bad Content-Range %q", resURL, resp.Header.Get("Content-Range"))
+			}
+		case http.StatusRequestedRangeNotSatisfiable:
+			if _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && size == offset {
+				// the file was complete already
+				return nil
+			}
+			file.Truncate(0)
+			return fmt.Errorf("failed to download resource: %s, range not satisfiable", resURL)
+		default:
+			return &statusError{"resource", resURL, resp.StatusCode}
+		}
+
+		if err := file.Truncate(offset); err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			if err := os.WriteFile(partPath+validatorSuffix, []byte(rangeValidator(resp.Header)), 0666); err != nil {
+				return err
+			}
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(file, resp.Body)
+		return err
+	})
+	return respHeader, err
+}
+
+// parseContentRange reads a Content-Range header of the form
+// "bytes start-end/size" or "bytes */size". The size is -1 when unknown.
+func parseContentRange(value string) (start, size int64, err error) {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+	span, total, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+		}
+	}
+	if span == "*" {
+		return 0, size, nil
+	}
+	first, _, ok := strings.Cut(span, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+	return start, size, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testData    = bytes.Repeat([]byte("0123456789"), 100)
+	testModTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// rangeServer serves testData at /data.bin with range support. The first
+// cut requests are dropped after half of the data, and with noRanges set
+// the Range header is ignored.
+type rangeServer struct {
+	cut      int
+	noRanges bool
+	etag     string
+
+	mutex   *sync.Mutex
+	headers []http.Header
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.headers = append(s.headers, r.Header.Clone())
+	cut := len(s.headers) <= s.cut
+	s.mutex.Unlock()
+
+	if r.URL.Path != "/data.bin" {
+		http.NotFound(w, r)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if cut {
+		w.Header().Set("Content-Length", "1000")
+		w.Header().Set("Last-Modified", testModTime.Format(http.TimeFormat))
+		w.Write(testData[:500])
+		return
+	}
+	if s.noRanges {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, "data.bin", testModTime, bytes.NewReader(testData))
+}
+
+// ranges returns the Range and If-Range headers of every request.
+func (s *rangeServer) ranges() [][2]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result [][2]string
+	for _, h := range s.headers {
+		result = append(result, [2]string{h.Get("Range"), h.Get("If-Range")})
+	}
+	return result
+}
+
+func newTestCrawler(dir, baseURL string, resume bool) *crawler {
+	c := newCrawler(dir, baseURL, 1, 1, 1)
+	c.log = io.Discard
+	c.ignoreRobots = true
+	c.backoff = time.Millisecond
+	c.resume = resume
+	return c
+}
+
+func downloadTestResource(t *testing.T, s *rangeServer, resume bool, part []byte, validator string) (string, error) {
+	t.Helper()
+	s.mutex = &sync.Mutex{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	dir := t.TempDir()
+	c := newTestCrawler(dir, server.URL+"/", resume)
+
+	savePath := filepath.Join(dir, strings.TrimPrefix(server.URL, "http://"), "data.bin")
+	if part != nil {
+		os.MkdirAll(filepath.Dir(savePath), os.ModePerm)
+		if err := os.WriteFile(savePath+".part", part, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if validator != "" {
+			if err := os.WriteFile(savePath+".part"+validatorSuffix, []byte(validator), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	err := c.downloadResource(server.URL + "/data.bin")
+	if _, serr := os.Stat(savePath + ".part"); err == nil && serr == nil {
+		t.Errorf("expected the .part file to be renamed")
+	}
+	if _, serr := os.Stat(savePath + ".part" + validatorSuffix); err == nil && serr == nil {
+		t.Errorf("expected the validator file to be removed")
+	}
+	return savePath, err
+}
+
+func TestDownloadResourceResume(t *testing.T) {
+	lastModified := testModTime.Format(http.TimeFormat)
+	testCases := []struct {
+		name      string
+		server    *rangeServer
+		resume    bool
+		part      []byte
+		validator string
+		ranges    [][2]string
+	}{
+		{"complete", &rangeServer{}, false, nil, "", [][2]string{{"", ""}}},
+		{"retry with etag", &rangeServer{cut: 1, etag: `"v1"`}, false, nil, "",
+			[][2]string{{"", ""}, {"bytes=500-", `"v1"`}}},
+		{"retry with date", &rangeServer{cut: 2}, false, nil, "",
+			[][2]string{{"", ""}, {"bytes=500-", lastModified}, {"bytes=500-", lastModified}}},
+		{"retry with weak etag", &rangeServer{cut: 1, etag: `W/"v1"`}, false, nil, "",
+			[][2]string{{"", ""}, {"bytes=500-", lastModified}}},
+		{"no range support", &rangeServer{cut: 1, noRanges: true}, false, nil, "",
+			[][2]string{{"", ""}, {"bytes=500-", lastModified}}},
+		{"continue", &rangeServer{}, true, testData[:300], lastModified,
+			[][2]string{{"bytes=300-", lastModified}}},
+		{"continue changed", &rangeServer{}, true, []byte("stale"), testModTime.Add(-time.Hour).Format(http.TimeFormat),
+			[][2]string{{"bytes=5-", testModTime.Add(-time.Hour).Format(http.TimeFormat)}}},
+		{"continue complete", &rangeServer{}, true, testData, lastModified,
+			[][2]string{{"bytes=1000-", lastModified}}},
+		{"continue without validator", &rangeServer{}, true, []byte("stale"), "", [][2]string{{"", ""}}},
+		{"no continue", &rangeServer{}, false, []byte("stale"), lastModified, [][2]string{{"", ""}}},
+	}
+
+	for _, tc := range testCases {
+		savePath, err := downloadTestResource(t, tc.server, tc.resume, tc.part, tc.validator)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.name, err)
+			continue
+		}
+		if data, err := os.ReadFile(savePath); err != nil || !bytes.Equal(data, testData) {
+			t.Errorf("expected the whole data for %s, got %d bytes (%v)", tc.name, len(data), err)
+		}
+		if ranges := tc.server.ranges(); !reflect.DeepEqual(ranges, tc.ranges) {
+			t.Errorf("expected requests %q, got %q for %s", tc.ranges, ranges, tc.name)
+		}
+	}
+}
+
+// TestDownloadResourceResumeKilled continues, in a new run, a download
+// whose run was stopped after the first half: the .part file keeps the
+// time it was last written, not the Last-Modified time of the resource.
+func TestDownloadResourceResumeKilled(t *testing.T) {
+	lastModified := testModTime.Format(http.TimeFormat)
+	testCases := []struct {
+		etag    string
+		ifRange string
+	}{
+		{"", lastModified},
+		{`"v1"`, `"v1"`},
+	}
+
+	for _, tc := range testCases {
+		s := &rangeServer{cut: 1, etag: tc.etag, mutex: &sync.Mutex{}}
+		server := httptest.NewServer(s)
+		dir := t.TempDir()
+		resURL := server.URL + "/data.bin"
+		savePath := filepath.Join(dir, strings.TrimPrefix(server.URL, "http://"), "data.bin")
+
+		killed := newTestCrawler(dir, server.URL+"/", true)
+		killed.retries = 0
+		if err := killed.downloadResource(resURL); err == nil {
+			t.Fatalf("expected the first run to fail for etag %q", tc.etag)
+		}
+		if info, err := os.Stat(savePath + ".part"); err != nil || info.Size() != 500 || info.ModTime().Equal(testModTime) {
+			t.Fatalf("expected a fresh .part file of 500 bytes for etag %q, got %v (%v)", tc.etag, info, err)
+		}
+
+		if err := newTestCrawler(dir, server.URL+"/", true).downloadResource(resURL); err != nil {
+			t.Errorf("unexpected error for etag %q: %v", tc.etag, err)
+		}
+		server.Close()
+
+		if data, err := os.ReadFile(savePath); err != nil || !bytes.Equal(data, testData) {
+			t.Errorf("expected the whole data for etag %q, got %d bytes (%v)", tc.etag, len(data), err)
+		}
+		expected := [][2]string{{"", ""}, {"bytes=500-", tc.ifRange}}
+		if ranges := s.ranges(); !reflect.DeepEqual(ranges, expected) {
+			t.Errorf("expected requests %q, got %q for etag %q", expected, ranges, tc.etag)
+		}
+		if _, err := os.Stat(savePath + ".part" + validatorSuffix); err == nil {
+			t.Errorf("expected the validator file to be removed for etag %q", tc.etag)
+		}
+	}
+}
+
+func TestDownloadResourceRetries(t *testing.T) {
+	s := &rangeServer{cut: 10}
+	_, err := downloadTestResource(t, s, false, nil, "")
+	if err == nil {
+		t.Errorf("expected an error after the retries")
+	}
+	if n := len(s.ranges()); n != 4 {
+		t.Errorf("expected 4 attempts, got %d", n)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		errs     []error
+		attempts int
+		hasError bool
+	}{
+		{[]error{nil}, 1, false},
+		{[]error{io.ErrUnexpectedEOF, &statusError{"page", "u", 503}, nil}, 3, false},
+		{[]error{&statusError{"page", "u", 429}, nil}, 2, false},
+		{[]error{&statusError{"page", "u", 404}, nil}, 1, true},
+		{[]error{errDisallowed, nil}, 1, true},
+		{[]error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, nil}, 4, true},
+	}
+
+	for _, tc := range testCases {
+		c := newCrawler(t.TempDir(), "", 1, 1, 1)
+		c.log = io.Discard
+		c.backoff = time.Millisecond
+		attempts := 0
+		err := c.retry("u", func() error {
+			attempts++
+			return tc.errs[attempts-1]
+		})
+		if attempts != tc.attempts || (err != nil) != tc.hasError {
+			t.Errorf("expected %d attempts and error %v, got %d and %v for %v", tc.attempts, tc.hasError, attempts, err, tc.errs)
+		}
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	testCases := []struct {
+		value    string
+		start    int64
+		size     int64
+		hasError bool
+	}{
+		{"bytes 0-499/1000", 0, 1000, false},
+		{"bytes 500-999/1000", 500, 1000, false},
+		{"bytes 500-999/*", 500, -1, false},
+		{"bytes */1000", 0, 1000, false},
+		{"", 0, 0, true},
+		{"bytes 500/1000", 0, 0, true},
+		{"items 0-1/2", 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		start, size, err := parseContentRange(tc.value)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for %q, but got none", tc.value)
+			}
+			continue
+		}
+		if err != nil || start != tc.start || size != tc.size {
+			t.Errorf("expected %d %d, got %d %d (%v) for %q", tc.start, tc.size, start, size, err, tc.value)
+		}
+	}
+}
@@ -3,195 +3,77 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"math"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
-
-	"golang.org/x/net/html"
 )
 
-var visitedPages = make(map[string]bool)
-var visitedResources = make(map[string]bool)
-
 func main() {
 	startURL := flag.String("url", "", "Download site URL")
 	outputDir := flag.String("output", ".", "Directory for saving files")
 	maxDepth := flag.Int("depth", 1, "Recursion depth")
+	concurrency := flag.Int("concurrency", 4, "Number of parallel downloads")
+	perHost := flag.Int("per-host", 2, "Maximum parallel requests to one host, 0 for no limit")
+	wait := flag.Duration("wait", 0, "Time to wait between requests to one host")
+	randomWait := flag.Bool("random-wait", false, "Vary the wait between 0.5 and 1.5 times its value")
+	userAgent := flag.String("user-agent", defaultUserAgent, "User-Agent header sent with every request")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Do not fetch or honor robots.txt")
+	resume := flag.Bool("c", false, "Continue partially downloaded files")
+	retries := flag.Int("retries", 3, "Number of retries after a failed download")
+	timestamping := flag.Bool("timestamping", false, "Only download again what changed since the last run")
+	mirror := flag.Bool("mirror", false, "Same as -timestamping with unlimited depth unless -depth is given")
+	deleteAfterSync := flag.Bool("delete-after-sync", false, "Delete local files whose sources have vanished")
 	flag.Parse()
 
+	if *mirror {
+		*timestamping = true
+		depthSet := false
+		flag.Visit(func(f *flag.Flag) {
+			depthSet = depthSet || f.Name == "depth"
+		})
+		if !depthSet {
+			*maxDepth = math.MaxInt
+		}
+	}
+
 	if *startURL == "" {
 		fmt.Println("Specify the URL using the -url flag")
 		return
 	}
-
-	os.MkdirAll(*outputDir, os.ModePerm)
-
-	err := downloadPage(*startURL, *outputDir, *startURL, *maxDepth)
-	if err != nil {
-		fmt.Println("Error:", err)
-	}
-}
-
-func downloadPage(pageURL, dir, baseURL string, depth int) error {
-	if depth <= 0 {
-		return nil
-	}
-
-	if visitedPages[pageURL] {
-		return nil
-	}
-	visitedPages[pageURL] = true
-
-	fmt.Println("Downloading page:", pageURL)
-
-	resp, err := http.Get(pageURL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download page: %s, status: %d", pageURL, resp.StatusCode)
-	}
-
-	u, err := url.Parse(pageURL)
-	if err != nil {
-		return err
-	}
-
-	var filename string
-	var saveDir string
-
-	if path.Ext(u.Path) == "" || strings.HasSuffix(u.Path, "/") {
-		filename = "index.html"
-		saveDir = filepath.Join(dir, u.Host, u.Path)
-	} else {
-		filename = path.Base(u.Path)
-		saveDir = filepath.Join(dir, u.Host, path.Dir(u.Path))
-	}
-
-	os.MkdirAll(saveDir, os.ModePerm)
-
-	filePath := filepath.Join(saveDir, filename)
-
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	bodyString := string(bodyBytes)
-
-	doc, err := html.Parse(strings.NewReader(bodyString))
-	if err != nil {
-		_, err = file.Write(bodyBytes)
-		return err
-	}
-
-	var pageLinks []string
-	var resourceLinks []string
-
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			for _, a := range n.Attr {
-				if a.Key == "href" || a.Key == "src" {
-					if strings.HasPrefix(a.Val, "#") {
-						continue
-					}
-
-					resourceURL, err := url.Parse(a.Val)
-					if err != nil {
-						continue
-					}
-					absoluteURL := resp.Request.URL.ResolveReference(resourceURL)
-
-					localPath := getLocalPath(absoluteURL, dir)
-					a.Val = filepath.ToSlash(localPath[len(dir)+1:])
-
-					if isHTMLPage(absoluteURL) {
-						pageLinks = append(pageLinks, absoluteURL.String())
-					} else {
-						resourceLinks = append(resourceLinks, absoluteURL.String())
-					}
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
+	if *concurrency < 1 {
+		fmt.Println("The -concurrency flag must be at least 1")
+		return
 	}
-	f(doc)
-
-	err = html.Render(file, doc)
-	if err != nil {
-		return err
+	if *deleteAfterSync && !*timestamping {
+		fmt.Println("The -delete-after-sync flag needs -timestamping or -mirror")
+		return
 	}
 
-	for _, resURL := range resourceLinks {
-		if !visitedResources[resURL] {
-			err := downloadResource(resURL, dir)
-			if err != nil {
-				fmt.Println("Error while downloading resource:", resURL, err)
-			}
-		}
-	}
+	os.MkdirAll(*outputDir, os.ModePerm)
 
-	for _, link := range pageLinks {
-		if strings.HasPrefix(link, baseURL) {
-			err := downloadPage(link, dir, baseURL, depth-1)
-			if err != nil {
-				fmt.Println("Error while downloading page:", link, err)
-			}
+	c := newCrawler(*outputDir, *startURL, *maxDepth, *concurrency, *perHost)
+	c.wait = *wait
+	c.randomWait = *randomWait
+	c.userAgent = *userAgent
+	c.ignoreRobots = *ignoreRobots
+	c.resume = *resume
+	c.retries = *retries
+	c.deleteAfterSync = *deleteAfterSync
+	if *timestamping {
+		m, err := loadManifest(*outputDir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
 		}
+		c.manifest = m
 	}
-
-	return nil
-}
-
-func downloadResource(resURL, dir string) error {
-	if visitedResources[resURL] {
-		return nil
-	}
-	visitedResources[resURL] = true
-
-	fmt.Println("Downloading resourse:", resURL)
-
-	resp, err := http.Get(resURL)
+	err := c.crawl(*startURL)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download resource: %s, status: %d", resURL, resp.StatusCode)
-	}
-
-	u, err := url.Parse(resURL)
-	if err != nil {
-		return err
-	}
-
-	savePath := getLocalPath(u, dir)
-
-	os.MkdirAll(filepath.Dir(savePath), os.ModePerm)
-
-	file, err := os.Create(savePath)
-	if err != nil {
-		return err
+		fmt.Println("Error:", err)
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	return err
 }
 
 func isHTMLPage(u *url.URL) bool {
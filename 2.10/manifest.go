@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// manifestName is the file in the output directory that keeps the
+// validators of the downloaded URLs between runs.
+const manifestName = ".mirror-manifest.json"
+
+// manifestEntry is what is known of a downloaded URL: where it was saved,
+// its validators and, for a page, its links, which are needed to go on
+// crawling when the page has not been modified.
+type manifestEntry struct {
+	Path         string   `json:"path"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"lastModified,omitempty"`
+	Links        []string `json:"links,omitempty"`
+	Resources    []string `json:"resources,omitempty"`
+}
+
+// manifest maps URLs to their entries and records which of them the
+// current run has found still present, which the server said are gone and
+// which pages it has followed the links of. It is safe for concurrent use.
+type manifest struct {
+	path    string
+	entries map[string]*manifestEntry
+	kept    map[string]bool
+	gone    map[string]bool
+
+	// linkedFrom and usedBy map the pages and resources of the loaded
+	// manifest to the pages that linked to them; searched maps the pages
+	// of the current run to whether their page links were followed, on
+	// top of their resources
+	linkedFrom map[string][]string
+	usedBy     map[string][]string
+	searched   map[string]bool
+
+	mutex *sync.Mutex
+}
+
+// loadManifest reads the manifest of the output directory, or starts an
+// empty one if there is none yet.
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{
+		path:       filepath.Join(dir, manifestName),
+		entries:    make(map[string]*manifestEntry),
+		kept:       make(map[string]bool),
+		gone:       make(map[string]bool),
+		linkedFrom: make(map[string][]string),
+		usedBy:     make(map[string][]string),
+		searched:   make(map[string]bool),
+		mutex:      &sync.Mutex{},
+	}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", m.path, err)
+	}
+	for u, entry := range m.entries {
+		for _, link := range entry.Links {
+			m.linkedFrom[link] = append(m.linkedFrom[link], u)
+		}
+		for _, res := range entry.Resources {
+			m.usedBy[res] = append(m.usedBy[res], u)
+		}
+	}
+	return m, nil
+}
+
+// save writes the manifest back to the output directory.
+func (m *manifest) save() error {
+	m.mutex.Lock()
+	data, err := json.MarshalIndent(m.entries, "", "  ")
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// get returns a copy of the entry of the URL.
+func (m *manifest) get(u string) (manifestEntry, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.entries[u]
+	if !ok {
+		return manifestEntry{}, false
+	}
+	return *entry, true
+}
+
+// record stores the entry of a URL that has just been downloaded.
+func (m *manifest) record(u string, entry manifestEntry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries[u] = &entry
+	m.kept[u] = true
+}
+
+// keep marks the URL as still present, so that its local copy survives a
+// sync.
+func (m *manifest) keep(u string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.kept[u] = true
+}
+
+// markGone records that the server answered 404 or 410 for the URL.
+func (m *manifest) markGone(u string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.gone[u] = true
+}
+
+// search records that the current run has followed the resources of a
+// page, and its links to other pages when links is set.
+func (m *manifest) search(u string, links bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.searched[u] = m.searched[u] || links
+}
+
+// reached tells whether the current run would have found the URL if it
+// were still linked: a page that linked to it in the loaded manifest had
+// its links followed.
+func (m *manifest) reached(u string) bool {
+	for _, page := range m.usedBy[u] {
+		if _, ok := m.searched[page]; ok {
+			return true
+		}
+	}
+	for _, page := range m.linkedFrom[u] {
+		if m.searched[page] {
+			return true
+		}
+	}
+	return false
+}
+
+// vanished removes and returns, sorted by URL, the entries of the URLs
+// that the current run has not found while it would have: the server said
+// they are gone, or the pages that linked to them no longer do. The URLs
+// out of reach of this run, such as those deeper than its depth, stay.
+func (m *manifest) vanished() []manifestEntry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var urls []string
+	for u := range m.entries {
+		if !m.kept[u] && (m.gone[u] || m.reached(u)) {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+
+	entries := make([]manifestEntry, len(urls))
+	for i, u := range urls {
+		entries[i] = *m.entries[u]
+		delete(m.entries, u)
+	}
+	return entries
+}
+
+// conditionalHeader returns the If-None-Match and If-Modified-Since
+// headers for a URL downloaded by an earlier run whose local copy is still
+// there, or nil when it has to be downloaded anyway.
+func (c *crawler) conditionalHeader(u string) http.Header {
+	if c.manifest == nil {
+		return nil
+	}
+	entry, ok := c.manifest.get(u)
+	if !ok || (entry.ETag == "" && entry.LastModified == "") {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(entry.Path))); err != nil {
+		return nil
+	}
+
+	header := http.Header{}
+	if entry.ETag != "" {
+		header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		header.Set("If-Modified-Since", entry.LastModified)
+	}
+	return header
+}
+
+// remember records a URL saved at localPath with the validators in the
+// header of its response, when timestamping.
+func (c *crawler) remember(u, localPath string, header http.Header, links, resources []string) {
+	if c.manifest == nil {
+		return
+	}
+	rel, err := filepath.Rel(c.dir, localPath)
+	if err != nil {
+		return
+	}
+	c.manifest.record(u, manifestEntry{
+		Path:         filepath.ToSlash(rel),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Links:        links,
+		Resources:    resources,
+	})
+}
+
+// keepUnlessGone keeps the local copy of a URL that could not be
+// downloaded, unless the server said it no longer exists.
+func (c *crawler) keepUnlessGone(u string, err error) {
+	if c.manifest == nil {
+		return
+	}
+	var se *statusError
+	if errors.As(err, &se) && (se.code == http.StatusNotFound || se.code == http.StatusGone) {
+		c.manifest.markGone(u)
+		return
+	}
+	c.manifest.keep(u)
+}
+
+// searched records that the links of a page downloaded by this run were
+// followed: its resources always, its pages above the maximum depth.
+func (c *crawler) searched(pageURL string, depth int) {
+	if c.manifest != nil {
+		c.manifest.search(pageURL, depth < c.maxDepth)
+	}
+}
+
+// sync deletes, when deleteVanished is set, the local copies of the URLs
+// this run has not found, then saves the manifest.
+func (c *crawler) sync(deleteVanished bool) error {
+	if deleteVanished {
+		for _, entry := range c.manifest.vanished() {
+			fmt.Fprintln(c.log, "Deleting:", entry.Path)
+			err := os.Remove(filepath.Join(c.dir, filepath.FromSlash(entry.Path)))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintln(c.log, "Error while deleting:", entry.Path, err)
+			}
+		}
+	}
+	return c.manifest.save()
+}
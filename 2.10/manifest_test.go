@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// versionedSite serves pages with an ETag and a Last-Modified time that
+// follow their content, and answers conditional requests.
+type versionedSite struct {
+	pages map[string]string
+
+	mutex    *sync.Mutex
+	statuses []string
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (s *versionedSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{w, http.StatusOK}
+	s.mutex.Lock()
+	body, ok := s.pages[r.URL.Path]
+	s.mutex.Unlock()
+
+	if !ok {
+		http.NotFound(sw, r)
+	} else {
+		sum := crc32.ChecksumIEEE([]byte(body))
+		w.Header().Set("ETag", fmt.Sprintf(`"%08x"`, sum))
+		modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(sum%1000) * time.Hour)
+		http.ServeContent(sw, r, "", modTime, strings.NewReader(body))
+	}
+
+	s.mutex.Lock()
+	s.statuses = append(s.statuses, fmt.Sprintf("%s %d", r.URL.Path, sw.code))
+	s.mutex.Unlock()
+}
+
+func (s *versionedSite) set(path, body string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if body == "" {
+		delete(s.pages, path)
+	} else {
+		s.pages[path] = body
+	}
+}
+
+// requests returns the sorted paths and statuses of the requests since
+// the last call.
+func (s *versionedSite) requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := s.statuses
+	s.statuses = nil
+	sort.Strings(statuses)
+	return statuses
+}
+
+func TestCrawlTimestamping(t *testing.T) {
+	site := &versionedSite{
+		pages: map[string]string{
+			"/":          `<a href="/a.html">a</a><img src="/old.png"><img src="/gone.png">`,
+			"/a.html":    `<link href="/style.css">`,
+			"/style.css": "css",
+			"/old.png":   "old",
+			"/gone.png":  "gone",
+		},
+		mutex: &sync.Mutex{},
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+	dir := t.TempDir()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	run := func(deleteAfterSync bool) error {
+		m, err := loadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newCrawler(dir, server.URL+"/", 2, 4, 2)
+		c.log = io.Discard
+		c.ignoreRobots = true
+		c.retries = 0
+		c.manifest = m
+		c.deleteAfterSync = deleteAfterSync
+		return c.crawl(server.URL + "/")
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, host, name))
+		return err == nil
+	}
+
+	if err := run(true); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/ 200", "/a.html 200", "/gone.png 200", "/old.png 200", "/style.css 200"}
+	if requests := site.requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %q on the first run, got %q", expected, requests)
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err != nil {
+		t.Errorf("expected the manifest to be saved: %v", err)
+	}
+
+	// nothing changed: the pages reached through the stored links too
+	if err := run(true); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"/ 304", "/a.html 304", "/gone.png 304", "/old.png 304", "/style.css 304"}
+	if requests := site.requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %q on an unchanged site, got %q", expected, requests)
+	}
+
+	// a file deleted locally is downloaded again
+	os.Remove(filepath.Join(dir, host, "style.css"))
+	if err := run(false); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"/ 304", "/a.html 304", "/gone.png 304", "/old.png 304", "/style.css 200"}
+	if requests := site.requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %q after a local deletion, got %q", expected, requests)
+	}
+
+	// old.png is no longer linked and gone.png no longer served
+	site.set("/", `<a href="/a.html">a</a><img src="/gone.png">`)
+	site.set("/gone.png", "")
+	if err := run(true); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"/ 200", "/a.html 304", "/gone.png 404", "/style.css 304"}
+	if requests := site.requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %q after a change, got %q", expected, requests)
+	}
+	for name, kept := range map[string]bool{"index.html": true, "a.html": true, "style.css": true, "old.png": false, "gone.png": false} {
+		if exists(name) != kept {
+			t.Errorf("expected %s to exist: %v", name, kept)
+		}
+	}
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.entries) != 3 {
+		t.Errorf("expected 3 entries in the manifest, got %d", len(m.entries))
+	}
+}
+
+func TestCrawlTimestampingKeepsFilesOnFailure(t *testing.T) {
+	site := &versionedSite{
+		pages: map[string]string{"/": `<img src="/a.png">`, "/a.png": "png"},
+		mutex: &sync.Mutex{},
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+	dir := t.TempDir()
+
+	for _, index := range []string{`<img src="/a.png">`, ""} {
+		site.set("/", index)
+		m, err := loadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newCrawler(dir, server.URL+"/", 1, 2, 2)
+		c.log = io.Discard
+		c.ignoreRobots = true
+		c.manifest = m
+		c.deleteAfterSync = true
+		c.crawl(server.URL + "/")
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, name := range []string{"index.html", "a.png"} {
+		if _, err := os.Stat(filepath.Join(dir, host, name)); err != nil {
+			t.Errorf("expected %s to be kept when the start page fails: %v", name, err)
+		}
+	}
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, manifestName), []byte("{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest(dir); err == nil {
+		t.Errorf("expected an error for an invalid manifest")
+	}
+}
+
+func TestCrawlSyncKeepsDeeperFiles(t *testing.T) {
+	site := &versionedSite{
+		pages: map[string]string{
+			"/":       `<a href="/a.html">a</a>`,
+			"/a.html": `<a href="/b.html">b</a>`,
+			"/b.html": `<img src="/c.png">`,
+			"/c.png":  "png",
+		},
+		mutex: &sync.Mutex{},
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+	dir := t.TempDir()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	run := func(depth int) {
+		m, err := loadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newCrawler(dir, server.URL+"/", depth, 4, 2)
+		c.log = io.Discard
+		c.ignoreRobots = true
+		c.manifest = m
+		c.deleteAfterSync = true
+		if err := c.crawl(server.URL + "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, expected map[string]bool) {
+		t.Helper()
+		for name, kept := range expected {
+			if _, err := os.Stat(filepath.Join(dir, host, name)); (err == nil) != kept {
+				t.Errorf("%s: expected %s to exist: %v", step, name, kept)
+			}
+		}
+	}
+
+	run(3)
+	all := map[string]bool{"index.html": true, "a.html": true, "b.html": true, "c.png": true}
+	check("depth 3", all)
+
+	// the pages below the depth of a run are out of its reach
+	run(1)
+	check("depth 1", all)
+	run(0)
+	check("depth 0", all)
+	if requests := site.requests(); len(requests) != 5 {
+		t.Errorf("expected 4 requests at depth 3 and 1 at depth 1, got %q", requests)
+	}
+
+	// a page no longer linked from a page within reach goes, the pages
+	// below it stay
+	site.set("/", `<p>empty</p>`)
+	run(2)
+	check("unlinked", map[string]bool{"index.html": true, "a.html": false, "b.html": true, "c.png": true})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRobotsSize is the part of a robots.txt file that is read; the rest
+// is ignored, as RFC 9309 allows.
+const maxRobotsSize = 500 << 10
+
+// robotsRule allows or disallows the paths matching pattern.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	match   *regexp.Regexp
+}
+
+// robotsRules are the rules of a robots.txt file that apply to one user
+// agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowAll and disallowAll stand for a missing and an unreachable
+// robots.txt.
+var (
+	allowAll    = &robotsRules{}
+	disallowAll = &robotsRules{rules: []robotsRule{{allow: false, pattern: "/", match: regexp.MustCompile("^/")}}}
+)
+
+// robotsGroup is a set of rules and the user agents it is written for.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// productToken returns the name a robots.txt refers to a user agent by:
+// the part before the version, in lower case.
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(strings.TrimSpace(token))
+}
+
+// parseRobots reads a robots.txt file and returns the rules of the groups
+// for userAgent, or those of the groups for * if none names it.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var group *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			continue
+		}
+		inAgents = false
+		if group == nil {
+			continue
+		}
+		switch key {
+		case "allow", "disallow":
+			if value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				match:   compileRobotsPattern(value),
+			})
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	token := productToken(userAgent)
+	if rules := mergeGroups(groups, token); rules != nil {
+		return rules
+	}
+	if rules := mergeGroups(groups, "*"); rules != nil {
+		return rules
+	}
+	return allowAll
+}
+
+// mergeGroups combines the groups written for agent, or returns nil when
+// there are none.
+func mergeGroups(groups []*robotsGroup, agent string) *robotsRules {
+	var rules *robotsRules
+	for _, group := range groups {
+		for _, a := range group.agents {
+			if a != agent {
+				continue
+			}
+			if rules == nil {
+				rules = &robotsRules{}
+			}
+			rules.rules = append(rules.rules, group.rules...)
+			rules.crawlDelay = max(rules.crawlDelay, group.crawlDelay)
+			break
+		}
+	}
+	return rules
+}
+
+// compileRobotsPattern turns a path pattern into a regular expression: *
+// matches any characters and a final $ the end of the path.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, part := range strings.Split(pattern, "*") {
+		if i > 0 {
+			expr.WriteString(".*")
+		}
+		expr.WriteString(regexp.QuoteMeta(part))
+	}
+	if anchored {
+		expr.WriteString("$")
+	}
+	return regexp.MustCompile(expr.String())
+}
+
+// allowed tells whether the rules let the URL be fetched. The longest
+// matching pattern decides and Allow wins a tie.
+func (rr *robotsRules) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if target == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allow, longest := true, -1
+	for _, rule := range rr.rules {
+		if !rule.match.MatchString(target) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allow, longest = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// robotsCache keeps the rules of every host, loading each robots.txt once
+// even when several workers need it at the same time.
+type robotsCache struct {
+	hosts map[string]*robotsEntry
+	mutex *sync.Mutex
+}
+
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{hosts: make(map[string]*robotsEntry), mutex: &sync.Mutex{}}
+}
+
+// get returns the rules of the host, calling load the first time.
+func (rc *robotsCache) get(host string, load func() *robotsRules) *robotsRules {
+	rc.mutex.Lock()
+	entry, ok := rc.hosts[host]
+	if !ok {
+		entry = &robotsEntry{}
+		rc.hosts[host] = entry
+	}
+	rc.mutex.Unlock()
+
+	entry.once.Do(func() { entry.rules = load() })
+	return entry.rules
+}
+
+// hostPacer spaces the requests to each host.
+type hostPacer struct {
+	next  map[string]time.Time
+	mutex *sync.Mutex
+}
+
+func newHostPacer() *hostPacer {
+	return &hostPacer{next: make(map[string]time.Time), mutex: &sync.Mutex{}}
+}
+
+// wait blocks until the host may be requested and books the request after
+// this one delay later.
+func (hp *hostPacer) wait(host string, delay time.Duration) {
+	hp.mutex.Lock()
+	now := time.Now()
+	at := hp.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	hp.next[host] = at.Add(delay)
+	hp.mutex.Unlock()
+
+	time.Sleep(time.Until(at))
+}
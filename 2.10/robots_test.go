@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/open.html
+Disallow: /*.pdf$
+
+User-agent: BadBot
+user-agent: OtherBot
+Disallow: /
+
+User-agent: site-mirror
+Disallow: /nomirror
+Allow: /nomirror/yes
+Crawl-delay: 1.5
+`
+
+func TestParseRobots(t *testing.T) {
+	testCases := []struct {
+		userAgent string
+		url       string
+		allowed   bool
+	}{
+		{"curl/8.0", "http://example.com/", true},
+		{"curl/8.0", "http://example.com/private/", false},
+		{"curl/8.0", "http://example.com/private/a.html", false},
+		{"curl/8.0", "http://example.com/private/open.html", true},
+		{"curl/8.0", "http://example.com/docs/a.pdf", false},
+		{"curl/8.0", "http://example.com/docs/a.pdf?x=1", true},
+		{"curl/8.0", "http://example.com/robots.txt", true},
+		{"BadBot/2.1", "http://example.com/", false},
+		{"otherbot", "http://example.com/a.html", false},
+		{"OtherBot", "http://example.com/robots.txt", true},
+		{"site-mirror/1.0", "http://example.com/private/", true},
+		{"site-mirror/1.0", "http://example.com/nomirror.html", false},
+		{"site-mirror/1.0", "http://example.com/nomirror/yes/a.html", true},
+	}
+
+	for _, tc := range testCases {
+		rules := parseRobots(strings.NewReader(testRobots), tc.userAgent)
+		u, _ := url.Parse(tc.url)
+		if allowed := rules.allowed(u); allowed != tc.allowed {
+			t.Errorf("expected allowed %v, got %v for %q as %q", tc.allowed, allowed, tc.url, tc.userAgent)
+		}
+	}
+
+	if d := parseRobots(strings.NewReader(testRobots), "site-mirror/1.0").crawlDelay; d != 1500*time.Millisecond {
+		t.Errorf("expected a crawl delay of 1.5s, got %v", d)
+	}
+	if d := parseRobots(strings.NewReader(testRobots), "curl").crawlDelay; d != 0 {
+		t.Errorf("expected no crawl delay, got %v", d)
+	}
+}
+
+func TestCompileRobotsPattern(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish*", "/fishheads/", true},
+		{"/*.php", "/folder/index.php?x", true},
+		{"/*.php$", "/index.php?x", false},
+		{"/*.php$", "/index.php", true},
+		{"/a+b(c)", "/a+b(c)/d", true},
+		{"/a+b(c)", "/aab(c)", false},
+	}
+
+	for _, tc := range testCases {
+		if matches := compileRobotsPattern(tc.pattern).MatchString(tc.path); matches != tc.matches {
+			t.Errorf("expected %v, got %v for %q against %q", tc.matches, matches, tc.pattern, tc.path)
+		}
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+	pages := map[string]string{
+		"/":                `<a href="/open.html">o</a><a href="/private/a.html">p</a><img src="/private/img.png">`,
+		"/open.html":       "open",
+		"/private/a.html":  "private",
+		"/private/img.png": "png",
+		"/robots.txt":      "User-agent: *\nDisallow: /private/\n",
+	}
+
+	testCases := []struct {
+		ignoreRobots bool
+		requested    []string
+	}{
+		{false, []string{"/", "/open.html", "/robots.txt"}},
+		{true, []string{"/", "/open.html", "/private/a.html", "/private/img.png"}},
+	}
+
+	for _, tc := range testCases {
+		site := newTestSite(pages)
+		server := httptest.NewServer(site)
+
+		c := newCrawler(t.TempDir(), server.URL+"/", 2, 4, 2)
+		c.log = io.Discard
+		c.userAgent = "test-agent/0.1"
+		c.ignoreRobots = tc.ignoreRobots
+		err := c.crawl(server.URL + "/")
+		server.Close()
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if requested := site.requested(); !reflect.DeepEqual(requested, tc.requested) {
+			t.Errorf("expected requests %q, got %q with ignoreRobots %v", tc.requested, requested, tc.ignoreRobots)
+		}
+		if !reflect.DeepEqual(site.agents, map[string]bool{"test-agent/0.1": true}) {
+			t.Errorf("expected only the configured user agent, got %v", site.agents)
+		}
+	}
+}
+
+func TestCrawlRobotsDisallowsStartPage(t *testing.T) {
+	site := newTestSite(map[string]string{"/": "index", "/robots.txt": "User-agent: *\nDisallow: /\n"})
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	c := newCrawler(t.TempDir(), server.URL+"/", 1, 2, 2)
+	c.log = io.Discard
+	if err := c.crawl(server.URL + "/"); err == nil || !strings.Contains(err.Error(), "disallowed by robots.txt") {
+		t.Errorf("expected the start page to be disallowed, got %v", err)
+	}
+	if requested := site.requested(); !reflect.DeepEqual(requested, []string{"/robots.txt"}) {
+		t.Errorf("expected only robots.txt to be requested, got %q", requested)
+	}
+}
+
+func TestCrawlWait(t *testing.T) {
+	pages := map[string]string{
+		"/":           `<img src="/a.png"><img src="/b.png"><img src="/c.png">`,
+		"/a.png":      "png",
+		"/b.png":      "png",
+		"/c.png":      "png",
+		"/robots.txt": "User-agent: *\nCrawl-delay: 0.05\n",
+	}
+
+	testCases := []struct {
+		wait         time.Duration
+		ignoreRobots bool
+		minGap       time.Duration
+	}{
+		{30 * time.Millisecond, true, 30 * time.Millisecond},
+		{0, false, 50 * time.Millisecond},
+		{20 * time.Millisecond, false, 50 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		site := newTestSite(pages)
+		server := httptest.NewServer(site)
+
+		c := newCrawler(t.TempDir(), server.URL+"/", 1, 4, 4)
+		c.log = io.Discard
+		c.wait = tc.wait
+		c.ignoreRobots = tc.ignoreRobots
+		err := c.crawl(server.URL + "/")
+		server.Close()
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		// the request after robots.txt comes before its Crawl-delay is known
+		times := site.times
+		if !tc.ignoreRobots {
+			times = times[1:]
+		}
+		for i := 1; i < len(times); i++ {
+			// allow for the clock of the server
+			if gap := times[i].Sub(times[i-1]); gap < tc.minGap-5*time.Millisecond {
+				t.Errorf("expected requests at least %v apart, got %v with wait %v", tc.minGap, gap, tc.wait)
+			}
+		}
+	}
+}
+
+func TestCrawlerDelay(t *testing.T) {
+	c := newCrawler(t.TempDir(), "", 1, 1, 1)
+	c.wait = 100 * time.Millisecond
+	c.randomWait = true
+	for i := 0; i < 100; i++ {
+		if d := c.delay(allowAll); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("expected a delay between 50ms and 150ms, got %v", d)
+		}
+	}
+	if d := c.delay(&robotsRules{crawlDelay: time.Second}); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+		t.Errorf("expected the crawl delay to be varied, got %v", d)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 
 	"2.12/internal/calendar"
+	"2.12/internal/digest"
+	"2.12/internal/holidays"
 	"2.12/internal/server"
 	"github.com/spf13/viper"
 )
@@ -20,27 +23,53 @@ func initConfig() error {
 	return nil
 }
 
-func main() {
-	cal := calendar.NewCalendar()
-	srv := &server.Server{Calendar: cal}
+func initHolidays() (*holidays.Registry, error) {
+	registry := holidays.NewRegistry()
+	for code, path := range viper.GetStringMapString("holidays.files") {
+		set, err := holidays.LoadFile(code, path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load holidays %q: %v", code, err)
+		}
+		registry.Add(set)
+	}
+	return registry, nil
+}
 
+func main() {
 	if err := initConfig(); err != nil {
 		log.Fatal("config initialization error: ", err)
 	}
 	port := viper.GetString("server.port")
+	token := viper.GetString("server.token")
+
+	registry, err := initHolidays()
+	if err != nil {
+		log.Fatal("holidays initialization error: ", err)
+	}
+
+	cal := calendar.NewCalendar()
+	srv := &server.Server{
+		Calendar:       cal,
+		AdminToken:     viper.GetString("server.admin_token"),
+		Holidays:       registry,
+		HolidayCountry: viper.GetString("holidays.country"),
+	}
+
+	if viper.GetBool("digest.enabled") {
+		generator, err := digest.NewGenerator(cal)
+		if err != nil {
+			log.Fatal("digest initialization error: ", err)
+		}
+		srv.Digests = digest.NewScheduler(generator, digest.LogSender{})
+		go srv.Digests.Run(context.Background())
+	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/create_event", srv.CreateEventHandler)
-	mux.HandleFunc("/update_event", srv.UpdateEventHandler)
-	mux.HandleFunc("/delete_event", srv.DeleteEventHandler)
-	mux.HandleFunc("/events_for_day", srv.EventsForDayHandler)
-	mux.HandleFunc("/events_for_week", srv.EventsForWeekHandler)
-	mux.HandleFunc("/events_for_month", srv.EventsForMonthHandler)
+	mux := srv.Routes()
 
-	handler := server.LoggingMidleware(mux)
+	handler := server.LoggingMidleware(server.TokenMiddleware(token, mux))
 
 	log.Println("Server is running on the port:", port)
-	err := http.ListenAndServe(":"+port, handler)
+	err = http.ListenAndServe(":"+port, handler)
 	if err != nil {
 		log.Fatal("Server startup error: ", err)
 	}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"2.12/internal/calendar"
+	"2.12/internal/client"
+)
+
+const backupPattern = "calendar-*.json"
+
+func backupCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory for backup files")
+	file := fs.String("file", "", "Backup file, overrides -dir")
+	keep := fs.Int("keep", 0, "Number of backups to keep in -dir, 0 keeps all")
+	fs.Parse(args)
+
+	var buf bytes.Buffer
+	err := c.Snapshot(&buf)
+	if err != nil {
+		return err
+	}
+
+	var snap calendar.Snapshot
+	err = json.Unmarshal(buf.Bytes(), &snap)
+	if err != nil {
+		return fmt.Errorf("server returned an invalid snapshot: %v", err)
+	}
+	if err := snap.CheckVersion(); err != nil {
+		return err
+	}
+
+	path := *file
+	if path == "" {
+		path = filepath.Join(*dir, fmt.Sprintf("calendar-%s.json", snap.CreatedAt.Format("20060102T150405Z")))
+	}
+	err = writeFileAtomic(path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if *file == "" && *keep > 0 {
+		err = pruneBackups(*dir, *keep)
+		if err != nil {
+			return err
+		}
+	}
+
+	return printResult(out, map[string]interface{}{"file": path, "events": len(snap.Events), "created_at": snap.CreatedAt},
+		fmt.Sprintf("saved %d events to %s", len(snap.Events), path))
+}
+
+func restoreCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	file := fs.String("file", "", "Backup file to restore, - for stdin")
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("specify the backup file using the -file flag")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	err := c.Restore(r)
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]string{"file": *file}, fmt.Sprintf("restored snapshot from %s", *file))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".calctl-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func pruneBackups(dir string, keep int) error {
+	files, err := filepath.Glob(filepath.Join(dir, backupPattern))
+	if err != nil {
+		return err
+	}
+	// the timestamp in the name makes lexical order chronological
+	sort.Strings(files)
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"2.12/internal/client"
+)
+
+func TestBackupVersions(t *testing.T) {
+	testCases := []struct {
+		snapshot string
+		hasError bool
+	}{
+		// as written by a server from before working hours
+		{`{"version":1,"created_at":"2024-05-01T10:00:00Z","next_id":2,"next_calendar_id":1,` +
+			`"events":[{"id":1,"user_id":1,"date":"2024-05-10T00:00:00Z","event":"first"}],"calendars":[]}`, false},
+		{`{"version":2,"created_at":"2024-05-01T10:00:00Z","next_id":1,"next_calendar_id":1,"events":[],"calendars":[]}`, false},
+		{`{"version":3,"created_at":"2024-05-01T10:00:00Z","next_id":1,"next_calendar_id":1,"events":[],"calendars":[]}`, true},
+		{`{"version":0}`, true},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tc.snapshot))
+		}))
+		c := client.NewClient(ts.URL, "secret")
+		c.AdminToken = "admin"
+
+		file := filepath.Join(t.TempDir(), "backup.json")
+		err := backupCommand(c, "text", []string{"-file", file})
+		ts.Close()
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for %s, but got none", tc.snapshot)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.snapshot, err)
+			continue
+		}
+		if data, err := os.ReadFile(file); err != nil || string(data) != tc.snapshot {
+			t.Errorf("expected the snapshot to be saved as is, got %q (%v)", data, err)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/client"
+)
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	layout := "2006-01-02"
+	if len(s) > len(layout) {
+		layout = "2006-01-02 15:04"
+	}
+	date, err := time.Parse(layout, s)
+	if err != nil {
+		return date, fmt.Errorf("invalid date: %v", err)
+	}
+	return date, nil
+}
+
+func printResult(out string, result interface{}, text string) error {
+	if out == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	fmt.Println(text)
+	return nil
+}
+
+func formatDate(e calendar.Event) string {
+	date := e.Date.Format("2006-01-02")
+	if e.Date.Hour() != 0 || e.Date.Minute() != 0 {
+		date = e.Date.Format("2006-01-02 15:04")
+	}
+	if e.Duration != 0 {
+		date += " (" + e.Duration.String() + ")"
+	}
+	return date
+}
+
+func printEvents(out string, events []calendar.Event) error {
+	if out == "json" {
+		if events == nil {
+			events = []calendar.Event{}
+		}
+		return printResult(out, events, "")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tCALENDAR\tDATE\tEVENT")
+	for _, e := range events {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\n", e.ID, e.UserID, e.CalendarID, formatDate(e), e.Event)
+	}
+	return w.Flush()
+}
+
+func parseIDs(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar ID: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func eventFlags(fs *flag.FlagSet) (*int, *int, *string, *string) {
+	userID := fs.Int("user_id", 0, "User ID")
+	calendarID := fs.Int("calendar_id", 0, "Calendar ID, 0 for the default calendar")
+	date := fs.String("date", "", "Event date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\" in UTC), today by default")
+	text := fs.String("event", "", "Event text")
+	return userID, calendarID, date, text
+}
+
+func addCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	userID, calendarID, dateStr, text := eventFlags(fs)
+	fs.Parse(args)
+
+	date, err := parseDate(*dateStr)
+	if err != nil {
+		return err
+	}
+
+	id, err := c.CreateEvent(calendar.Event{UserID: *userID, CalendarID: *calendarID, Date: date, Event: *text})
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]int{"id": id}, fmt.Sprintf("event created with ID: %d", id))
+}
+
+func quickCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("quick", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "User ID")
+	calendarID := fs.Int("calendar_id", 0, "Calendar ID, 0 for the default calendar")
+	fs.Parse(args)
+
+	events, err := c.QuickAdd(*userID, *calendarID, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	return printEvents(out, events)
+}
+
+func editCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	id := fs.Int("id", 0, "Event ID")
+	userID, calendarID, dateStr, text := eventFlags(fs)
+	fs.Lookup("date").Usage = "Event date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\" in UTC), unchanged by default"
+	fs.Parse(args)
+
+	// a zero date keeps the date of the event
+	var date time.Time
+	if *dateStr != "" {
+		var err error
+		date, err = parseDate(*dateStr)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.UpdateEvent(calendar.Event{ID: *id, UserID: *userID, CalendarID: *calendarID, Date: date, Event: *text})
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]int{"id": *id}, "event updated")
+}
+
+func rmCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	id := fs.Int("id", 0, "Event ID")
+	userID := fs.Int("user_id", 0, "User ID")
+	fs.Parse(args)
+
+	err := c.DeleteEvent(*userID, *id)
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]int{"id": *id}, "event deleted")
+}
+
+func fetchPeriod(c *client.Client, period string, userID int, date time.Time, calendarIDs []int) ([]calendar.Event, error) {
+	switch period {
+	case "day":
+		return c.EventsForDay(userID, date, calendarIDs...)
+	case "week":
+		return c.EventsForWeek(userID, date, calendarIDs...)
+	case "month":
+		return c.EventsForMonth(userID, date, calendarIDs...)
+	default:
+		return nil, fmt.Errorf("unknown period: %s", period)
+	}
+}
+
+func periodCommand(period string) command {
+	return func(c *client.Client, out string, args []string) error {
+		fs := flag.NewFlagSet(period, flag.ExitOnError)
+		userID := fs.Int("user_id", 0, "User ID")
+		dateStr := fs.String("date", "", "Start date (YYYY-MM-DD), today by default")
+		calendars := fs.String("calendars", "", "Comma-separated calendar IDs to overlay")
+		fs.Parse(args)
+
+		date, err := parseDate(*dateStr)
+		if err != nil {
+			return err
+		}
+		calendarIDs, err := parseIDs(*calendars)
+		if err != nil {
+			return err
+		}
+
+		events, err := fetchPeriod(c, period, *userID, date, calendarIDs)
+		if err != nil {
+			return err
+		}
+		return printEvents(out, events)
+	}
+}
+
+func importCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "-", "JSON file with events, - for stdin")
+	fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var events []calendar.Event
+	err := json.NewDecoder(r).Decode(&events)
+	if err != nil {
+		return fmt.Errorf("could not decode events: %v", err)
+	}
+
+	var created []calendar.Event
+	for _, e := range events {
+		id, err := c.CreateEvent(e)
+		if err != nil {
+			return fmt.Errorf("could not import event %q: %v", e.Event, err)
+		}
+		e.ID = id
+		created = append(created, e)
+	}
+	return printEvents(out, created)
+}
+
+func exportCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "User ID")
+	dateStr := fs.String("date", "", "Start date (YYYY-MM-DD), today by default")
+	period := fs.String("period", "month", "Period: day, week or month")
+	calendars := fs.String("calendars", "", "Comma-separated calendar IDs to export")
+	file := fs.String("file", "-", "Output file, - for stdout")
+	fs.Parse(args)
+
+	date, err := parseDate(*dateStr)
+	if err != nil {
+		return err
+	}
+	calendarIDs, err := parseIDs(*calendars)
+	if err != nil {
+		return err
+	}
+
+	events, err := fetchPeriod(c, *period, *userID, date, calendarIDs)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []calendar.Event{}
+	}
+
+	var w io.Writer = os.Stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(events)
+}
+
+func calendarsCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("calendars", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "User ID")
+	fs.Parse(args)
+
+	calendars, err := c.Calendars(*userID)
+	if err != nil {
+		return err
+	}
+	if out == "json" {
+		if calendars == nil {
+			calendars = []calendar.UserCalendar{}
+		}
+		return printResult(out, calendars, "")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tOWNER\tNAME\tSHARES")
+	for _, cal := range calendars {
+		var shares []string
+		for user, perm := range cal.Shares {
+			shares = append(shares, fmt.Sprintf("%d:%s", user, perm))
+		}
+		sort.Strings(shares)
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", cal.ID, cal.OwnerID, cal.Name, strings.Join(shares, ","))
+	}
+	return w.Flush()
+}
+
+func mkcalCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("mkcal", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "Owner user ID")
+	name := fs.String("name", "", "Calendar name")
+	fs.Parse(args)
+
+	id, err := c.CreateCalendar(*userID, *name)
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]int{"id": id}, fmt.Sprintf("calendar created with ID: %d", id))
+}
+
+func shareCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "Owner user ID")
+	calendarID := fs.Int("calendar_id", 0, "Calendar ID")
+	shareWith := fs.Int("with", 0, "User ID to share the calendar with")
+	permStr := fs.String("permission", "read", "Permission: none, read, write or owner")
+	fs.Parse(args)
+
+	perm, err := calendar.ParsePermission(*permStr)
+	if err != nil {
+		return err
+	}
+
+	err = c.ShareCalendar(*calendarID, *userID, *shareWith, perm)
+	if err != nil {
+		return err
+	}
+	return printResult(out, map[string]interface{}{"calendar_id": *calendarID, "user_id": *shareWith, "permission": perm},
+		fmt.Sprintf("calendar %d shared with user %d (%s)", *calendarID, *shareWith, perm))
+}
+
+func workdaysCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("workdays", flag.ExitOnError)
+	fromStr := fs.String("from", "", "First day (YYYY-MM-DD), today by default")
+	toStr := fs.String("to", "", "Last day (YYYY-MM-DD), a week after -from by default")
+	country := fs.String("country", "", "Holiday set, e.g. ru, us or de-by")
+	userID := fs.Int("user_id", 0, "Use working days of this user")
+	fs.Parse(args)
+
+	from, err := parseDate(*fromStr)
+	if err != nil {
+		return err
+	}
+	to := from.AddDate(0, 0, 6)
+	if *toStr != "" {
+		to, err = parseDate(*toStr)
+		if err != nil {
+			return err
+		}
+	}
+
+	days, err := c.Workdays(from, to, *country, *userID)
+	if err != nil {
+		return err
+	}
+	return printResult(out, days, strings.Join(days, "\n"))
+}
+
+func slotsCommand(c *client.Client, out string, args []string) error {
+	fs := flag.NewFlagSet("slots", flag.ExitOnError)
+	userID := fs.Int("user_id", 0, "User ID")
+	dateStr := fs.String("date", "", "First day (YYYY-MM-DD), today by default")
+	days := fs.Int("days", 1, "Number of days to search")
+	duration := fs.Duration("duration", 30*time.Minute, "Minimal slot length")
+	country := fs.String("country", "", "Holiday set, e.g. ru, us or de-by")
+	fs.Parse(args)
+
+	date, err := parseDate(*dateStr)
+	if err != nil {
+		return err
+	}
+
+	slots, err := c.FreeSlots(*userID, date, *days, *duration, *country)
+	if err != nil {
+		return err
+	}
+	if out == "json" {
+		if slots == nil {
+			slots = []calendar.Slot{}
+		}
+		return printResult(out, slots, "")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tEND\tLENGTH")
+	for _, slot := range slots {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", slot.Start.Format("2006-01-02 15:04"), slot.End.Format("15:04"), slot.End.Sub(slot.Start))
+	}
+	return w.Flush()
+}
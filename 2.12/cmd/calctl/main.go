@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"2.12/internal/client"
+	"github.com/spf13/viper"
+)
+
+const usage = `usage: calctl [-config file] [-o table|json] <command> [flags]
+
+commands:
+  add        create an event
+  quick      create an event from a phrase, e.g. "lunch tomorrow 13:00 for 1h"
+  edit       update an event
+  rm         delete an event
+  day        list events for a day
+  week       list events for a week
+  month      list events for a month
+  workdays   list working days without holidays
+  slots      find free slots within working hours
+  import     create events from a JSON file
+  export     save events for a period to a JSON file
+  backup     save a server snapshot (admin)
+  restore    load a server snapshot (admin)
+  calendars  list calendars available to a user
+  mkcal      create a named calendar
+  share      share a calendar with another user
+
+the server URL and tokens are read from the config file (url, token,
+admin_token) or from the CALCTL_URL, CALCTL_TOKEN and CALCTL_ADMIN_TOKEN
+environment variables`
+
+type command func(c *client.Client, out string, args []string) error
+
+var commands = map[string]command{
+	"add":       addCommand,
+	"quick":     quickCommand,
+	"edit":      editCommand,
+	"rm":        rmCommand,
+	"day":       periodCommand("day"),
+	"week":      periodCommand("week"),
+	"month":     periodCommand("month"),
+	"workdays":  workdaysCommand,
+	"slots":     slotsCommand,
+	"import":    importCommand,
+	"export":    exportCommand,
+	"backup":    backupCommand,
+	"restore":   restoreCommand,
+	"calendars": calendarsCommand,
+	"mkcal":     mkcalCommand,
+	"share":     shareCommand,
+}
+
+func initConfig(configFile string) error {
+	viper.SetEnvPrefix("calctl")
+	viper.AutomaticEnv()
+	viper.SetDefault("url", "http://localhost:8080")
+
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("calctl")
+		if home, err := os.UserHomeDir(); err == nil {
+			viper.AddConfigPath(home + "/.config/calctl")
+		}
+		viper.AddConfigPath(".")
+	}
+
+	err := viper.ReadInConfig()
+	if err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok && configFile == "" {
+			return nil
+		}
+		return fmt.Errorf("error of reading config: %v", err)
+	}
+	return nil
+}
+
+func main() {
+	configFile := flag.String("config", "", "Path to the config file")
+	output := flag.String("o", "table", "Output format: table or json")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintln(os.Stderr, "unknown output format:", *output)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := initConfig(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, "config initialization error:", err)
+		os.Exit(1)
+	}
+
+	c := client.NewClient(viper.GetString("url"), viper.GetString("token"))
+	c.AdminToken = viper.GetString("admin_token")
+	if err := cmd(c, *output, flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,558 @@
+package caldav
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/ical"
+)
+
+// Handler serves the calendar over CalDAV. Resources are laid out as
+//
+//	{prefix}{user_id}/                      calendar home
+//	{prefix}{user_id}/{calendar}/           calendar collection, "default" or an ID
+//	{prefix}{user_id}/{calendar}/{name}.ics event
+//
+// The name of an event is the one the client stored it under, which need
+// not be its UID.
+type Handler struct {
+	Calendar *calendar.Calendar
+	Prefix   string
+}
+
+func NewHandler(cal *calendar.Calendar, prefix string) *Handler {
+	return &Handler{Calendar: cal, Prefix: "/" + strings.Trim(prefix, "/") + "/"}
+}
+
+type target struct {
+	userId     int
+	calendarId int
+	hasCal     bool
+	name       string
+}
+
+func (h *Handler) parsePath(p string) (target, error) {
+	var t target
+	rest := strings.Trim(strings.TrimPrefix(p, h.Prefix), "/")
+	if rest == "" {
+		return t, fmt.Errorf("user is not specified")
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 3 {
+		return t, fmt.Errorf("unknown resource")
+	}
+
+	userId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return t, fmt.Errorf("invalid user id")
+	}
+	t.userId = userId
+
+	if len(parts) > 1 {
+		t.hasCal = true
+		if parts[1] != "default" {
+			t.calendarId, err = strconv.Atoi(parts[1])
+			if err != nil {
+				return t, fmt.Errorf("invalid calendar id")
+			}
+		}
+	}
+	if len(parts) > 2 {
+		if !strings.HasSuffix(parts[2], ".ics") {
+			return t, fmt.Errorf("unknown resource")
+		}
+		t.name = strings.TrimSuffix(parts[2], ".ics")
+	}
+	return t, nil
+}
+
+func (h *Handler) homeHref(userId int) string {
+	return fmt.Sprintf("%s%d/", h.Prefix, userId)
+}
+
+func (h *Handler) calendarHref(userId, calendarId int) string {
+	if calendarId == 0 {
+		return h.homeHref(userId) + "default/"
+	}
+	return fmt.Sprintf("%s%d/", h.homeHref(userId), calendarId)
+}
+
+func (h *Handler) eventHref(userId int, event calendar.Event) string {
+	return h.calendarHref(userId, event.CalendarID) + url.PathEscape(resourceName(event)) + ".ics"
+}
+
+func resourceName(event calendar.Event) string {
+	if event.Resource != "" {
+		return event.Resource
+	}
+	return eventUID(event)
+}
+
+func eventUID(event calendar.Event) string {
+	if event.UID != "" {
+		return event.UID
+	}
+	return fmt.Sprintf("event-%d", event.ID)
+}
+
+func etag(event calendar.Event) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%s|%d|%d|%s|%d|%s",
+		event.ID, event.UID, event.UserID, event.CalendarID, event.Date.Format(time.RFC3339), event.Duration, event.Event)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	t, err := h.parsePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		h.propfind(w, r, t)
+	case "REPORT":
+		h.report(w, r, t)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, t)
+	case http.MethodPut:
+		h.put(w, r, t)
+	case http.MethodDelete:
+		h.delete(w, r, t)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) findEvent(t target) (calendar.Event, bool, error) {
+	events, err := h.Calendar.GetCalendarEvents(t.userId, t.calendarId)
+	if err != nil {
+		return calendar.Event{}, false, err
+	}
+	for _, event := range events {
+		if resourceName(event) == t.name {
+			return event, true, nil
+		}
+	}
+	return calendar.Event{}, false, nil
+}
+
+// findUID looks for an event with the UID in the calendar of t, whatever
+// its resource name.
+func (h *Handler) findUID(t target, uid string) (calendar.Event, bool) {
+	events, err := h.Calendar.GetCalendarEvents(t.userId, t.calendarId)
+	if err != nil {
+		return calendar.Event{}, false
+	}
+	for _, event := range events {
+		if eventUID(event) == uid {
+			return event, true
+		}
+	}
+	return calendar.Event{}, false
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, t target) {
+	if t.name == "" {
+		http.Error(w, "not a calendar object", http.StatusMethodNotAllowed)
+		return
+	}
+
+	event, found, err := h.findEvent(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	ical.Encode(&buf, []ical.Event{toICal(event)})
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", etag(event))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(buf.Bytes())
+	}
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, t target) {
+	if t.name == "" {
+		http.Error(w, "not a calendar object", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.Calendar.CheckPermission(t.userId, t.calendarId, calendar.PermissionWrite); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	events, err := ical.Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "no VEVENT in request body", http.StatusBadRequest)
+		return
+	}
+	ie := events[0]
+	if ie.UID == "" {
+		ie.UID = t.name
+	}
+
+	existing, found, err := h.findEvent(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if other, taken := h.findUID(t, ie.UID); taken && (!found || other.ID != existing.ID) {
+		http.Error(w, "UID is already used by "+resourceName(other)+".ics", http.StatusConflict)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && found {
+		http.Error(w, "resource already exists", http.StatusPreconditionFailed)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && (!found || (match != "*" && match != etag(existing))) {
+		http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+		return
+	}
+
+	event := fromICal(ie)
+	event.UserID = t.userId
+	event.CalendarID = t.calendarId
+	event.Resource = t.name
+
+	status := http.StatusCreated
+	if found {
+		event.ID = existing.ID
+		event.UserID = existing.UserID
+		err = h.Calendar.UpdateEvent(event)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		status = http.StatusNoContent
+	} else {
+		// another PUT may have created the resource or the UID since
+		// findEvent, so check again as the event is created
+		id, created := h.Calendar.CreateEventUnless(event, func(other calendar.Event) bool {
+			return resourceName(other) == t.name || eventUID(other) == ie.UID
+		})
+		if !created {
+			status := http.StatusConflict
+			if r.Header.Get("If-None-Match") == "*" {
+				status = http.StatusPreconditionFailed
+			}
+			http.Error(w, "resource or UID created meanwhile", status)
+			return
+		}
+		event.ID = id
+	}
+
+	w.Header().Set("ETag", etag(event))
+	w.WriteHeader(status)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, t target) {
+	if t.name == "" {
+		http.Error(w, "calendar collections cannot be deleted", http.StatusForbidden)
+		return
+	}
+	if err := h.Calendar.CheckPermission(t.userId, t.calendarId, calendar.PermissionWrite); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	event, found, err := h.findEvent(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != etag(event) {
+		http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+		return
+	}
+
+	err = h.Calendar.DeleteEvent(event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, t target) {
+	req, err := parseRequest(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	depthOne := r.Header.Get("Depth") != "0"
+
+	var responses []davResponse
+	switch {
+	case !t.hasCal:
+		responses = append(responses, h.homeResponse(t.userId, req))
+		if depthOne {
+			for _, cal := range h.calendars(t.userId) {
+				responses = append(responses, h.calendarResponse(t.userId, cal, req))
+			}
+		}
+	case t.name == "":
+		cal, found := h.findCalendar(t.userId, t.calendarId)
+		if !found {
+			http.Error(w, "calendar not found", http.StatusNotFound)
+			return
+		}
+		responses = append(responses, h.calendarResponse(t.userId, cal, req))
+		if depthOne {
+			events, err := h.Calendar.GetCalendarEvents(t.userId, t.calendarId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			for _, event := range events {
+				responses = append(responses, h.eventResponse(t.userId, event, req))
+			}
+		}
+	default:
+		event, found, err := h.findEvent(t)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if !found {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		responses = append(responses, h.eventResponse(t.userId, event, req))
+	}
+
+	writeMultistatus(w, responses)
+}
+
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, t target) {
+	if !t.hasCal || t.name != "" {
+		http.Error(w, "REPORT is supported on calendar collections only", http.StatusForbidden)
+		return
+	}
+	req, err := parseRequest(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.Calendar.GetCalendarEvents(t.userId, t.calendarId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var responses []davResponse
+	switch req.root {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		for _, event := range events {
+			if overlaps(event, req.start, req.end) {
+				responses = append(responses, h.eventResponse(t.userId, event, req))
+			}
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		// hrefs are matched unescaped, as clients do not all escape the
+		// same characters
+		byPath := make(map[string]calendar.Event)
+		for _, event := range events {
+			byPath[h.calendarHref(t.userId, event.CalendarID)+resourceName(event)+".ics"] = event
+		}
+		for _, href := range req.hrefs {
+			p := href
+			if u, err := url.Parse(href); err == nil {
+				p = u.Path
+			} else if unescaped, err := url.PathUnescape(href); err == nil {
+				p = unescaped
+			}
+			if event, ok := byPath[path.Clean(p)]; ok {
+				responses = append(responses, h.eventResponse(t.userId, event, req))
+			} else {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+			}
+		}
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+
+	writeMultistatus(w, responses)
+}
+
+func (h *Handler) calendars(userId int) []calendar.UserCalendar {
+	result := []calendar.UserCalendar{{ID: 0, OwnerID: userId, Name: "Default"}}
+	return append(result, h.Calendar.GetCalendars(userId)...)
+}
+
+func (h *Handler) findCalendar(userId, calendarId int) (calendar.UserCalendar, bool) {
+	for _, cal := range h.calendars(userId) {
+		if cal.ID == calendarId {
+			return cal, true
+		}
+	}
+	return calendar.UserCalendar{}, false
+}
+
+func href(s string) string {
+	return "<D:href>" + escape(s) + "</D:href>"
+}
+
+func respond(href string, req davRequest, all []xml.Name, values map[xml.Name]string) davResponse {
+	resp := davResponse{href: href}
+	names := req.props
+	if req.allProp {
+		names = all
+	}
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			resp.found = append(resp.found, propValue{name: name, inner: value})
+		} else {
+			resp.missing = append(resp.missing, name)
+		}
+	}
+	return resp
+}
+
+func davName(local string) xml.Name {
+	return xml.Name{Space: nsDAV, Local: local}
+}
+
+func calDAVName(local string) xml.Name {
+	return xml.Name{Space: nsCalDAV, Local: local}
+}
+
+func (h *Handler) homeResponse(userId int, req davRequest) davResponse {
+	home := h.homeHref(userId)
+	values := map[xml.Name]string{
+		davName("resourcetype"):           "<D:collection/>",
+		davName("displayname"):            escape(fmt.Sprintf("User %d", userId)),
+		davName("current-user-principal"): href(home),
+		davName("principal-URL"):          href(home),
+		calDAVName("calendar-home-set"):   href(home),
+	}
+	all := []xml.Name{davName("resourcetype"), davName("displayname")}
+	return respond(home, req, all, values)
+}
+
+func (h *Handler) calendarResponse(userId int, cal calendar.UserCalendar, req davRequest) davResponse {
+	privileges := "<D:privilege><D:read/></D:privilege>"
+	if h.Calendar.CheckPermission(userId, cal.ID, calendar.PermissionWrite) == nil {
+		privileges += "<D:privilege><D:write/></D:privilege>"
+	}
+
+	events, _ := h.Calendar.GetCalendarEvents(userId, cal.ID)
+	ctag := sha1.New()
+	for _, event := range events {
+		ctag.Write([]byte(etag(event)))
+	}
+
+	values := map[xml.Name]string{
+		davName("resourcetype"):                        "<D:collection/><C:calendar/>",
+		davName("displayname"):                         escape(cal.Name),
+		davName("current-user-principal"):              href(h.homeHref(userId)),
+		davName("current-user-privilege-set"):          privileges,
+		calDAVName("supported-calendar-component-set"): `<C:comp name="VEVENT"/>`,
+		{Space: nsCS, Local: "getctag"}:                escape(hex.EncodeToString(ctag.Sum(nil)[:8])),
+	}
+	all := []xml.Name{davName("resourcetype"), davName("displayname")}
+	return respond(h.calendarHref(userId, cal.ID), req, all, values)
+}
+
+func (h *Handler) eventResponse(userId int, event calendar.Event, req davRequest) davResponse {
+	var buf bytes.Buffer
+	ical.Encode(&buf, []ical.Event{toICal(event)})
+
+	values := map[xml.Name]string{
+		davName("resourcetype"):     "",
+		davName("getetag"):          escape(etag(event)),
+		davName("getcontenttype"):   "text/calendar; charset=utf-8",
+		calDAVName("calendar-data"): escape(buf.String()),
+	}
+	all := []xml.Name{davName("resourcetype"), davName("getetag"), davName("getcontenttype")}
+	return respond(h.eventHref(userId, event), req, all, values)
+}
+
+func isAllDay(event calendar.Event) bool {
+	d := event.Date.UTC()
+	midnight := d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 && d.Nanosecond() == 0
+	return midnight && event.Duration%(24*time.Hour) == 0
+}
+
+func eventEnd(event calendar.Event) time.Time {
+	if event.Duration == 0 && isAllDay(event) {
+		return event.Date.Add(24 * time.Hour)
+	}
+	return event.Date.Add(event.Duration)
+}
+
+func overlaps(event calendar.Event, start, end time.Time) bool {
+	eventStart, eventEnd := event.Date, eventEnd(event)
+	if !end.IsZero() && !eventStart.Before(end) {
+		return false
+	}
+	if start.IsZero() {
+		return true
+	}
+	if eventEnd.Equal(eventStart) {
+		return !eventStart.Before(start)
+	}
+	return eventEnd.After(start)
+}
+
+func toICal(event calendar.Event) ical.Event {
+	ie := ical.Event{
+		UID:     eventUID(event),
+		Summary: event.Event,
+		Start:   event.Date.UTC(),
+		AllDay:  isAllDay(event),
+	}
+	if end := eventEnd(event); end.After(event.Date) {
+		ie.End = end.UTC()
+	}
+	return ie
+}
+
+func fromICal(ie ical.Event) calendar.Event {
+	event := calendar.Event{
+		UID:   ie.UID,
+		Date:  ie.Start,
+		Event: ie.Summary,
+	}
+	if !ie.End.IsZero() && ie.End.After(ie.Start) {
+		event.Duration = ie.End.Sub(ie.Start)
+	}
+	if ie.AllDay && event.Duration == 24*time.Hour {
+		event.Duration = 0
+	}
+	return event
+}
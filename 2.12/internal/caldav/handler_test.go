@@ -0,0 +1,296 @@
+package caldav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"2.12/internal/calendar"
+)
+
+const standup = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1\r\n" +
+	"DTSTART:20240510T090000Z\r\n" +
+	"DTEND:20240510T093000Z\r\n" +
+	"SUMMARY:Standup\\, daily\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func newTestServer() (*httptest.Server, *calendar.Calendar) {
+	cal := calendar.NewCalendar()
+	mux := http.NewServeMux()
+	mux.Handle("/dav/", NewHandler(cal, "/dav/"))
+	return httptest.NewServer(mux), cal
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path, body string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestPutGetDelete(t *testing.T) {
+	ts, cal := newTestServer()
+	defer ts.Close()
+
+	resp, _ := do(t, ts, "PUT", "/dav/1/default/standup-1.ics", standup, map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: expected 201, got %d", resp.StatusCode)
+	}
+	tag := resp.Header.Get("ETag")
+	if tag == "" {
+		t.Fatalf("PUT: missing ETag")
+	}
+
+	resp, _ = do(t, ts, "PUT", "/dav/1/default/standup-1.ics", standup, map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PUT existing with If-None-Match: expected 412, got %d", resp.StatusCode)
+	}
+
+	events := cal.GetEventForPeriod(1, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), 24*time.Hour)
+	if len(events) != 1 || events[0].Event != "Standup, daily" || events[0].Duration != 30*time.Minute {
+		t.Fatalf("unexpected events in calendar: %+v", events)
+	}
+
+	resp, body := do(t, ts, "GET", "/dav/1/default/standup-1.ics", "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != tag {
+		t.Fatalf("GET: status %d, etag %q, want %q", resp.StatusCode, resp.Header.Get("ETag"), tag)
+	}
+	if !strings.Contains(body, "UID:standup-1") || !strings.Contains(body, "DTSTART:20240510T090000Z") {
+		t.Fatalf("GET: unexpected body:\n%s", body)
+	}
+
+	updated := strings.Replace(standup, "Standup\\, daily", "Standup moved", 1)
+	resp, _ = do(t, ts, "PUT", "/dav/1/default/standup-1.ics", updated, map[string]string{"If-Match": `"stale"`})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with stale If-Match: expected 412, got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, ts, "PUT", "/dav/1/default/standup-1.ics", updated, map[string]string{"If-Match": tag})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT update: expected 204, got %d", resp.StatusCode)
+	}
+	newTag := resp.Header.Get("ETag")
+	if newTag == tag {
+		t.Fatalf("ETag did not change after update")
+	}
+
+	resp, _ = do(t, ts, "DELETE", "/dav/1/default/standup-1.ics", "", map[string]string{"If-Match": tag})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("DELETE with stale If-Match: expected 412, got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, ts, "DELETE", "/dav/1/default/standup-1.ics", "", map[string]string{"If-Match": newTag})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: expected 204, got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, ts, "GET", "/dav/1/default/standup-1.ics", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET after DELETE: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestPropfind(t *testing.T) {
+	ts, cal := newTestServer()
+	defer ts.Close()
+
+	work := cal.CreateCalendar(1, "Work")
+	do(t, ts, "PUT", "/dav/1/default/standup-1.ics", standup, nil)
+
+	propfind := `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:X="urn:example">
+  <D:prop><D:resourcetype/><D:displayname/><X:unknown/></D:prop>
+</D:propfind>`
+	resp, body := do(t, ts, "PROPFIND", "/dav/1/", propfind, map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND home: expected 207, got %d", resp.StatusCode)
+	}
+	for _, want := range []string{
+		"<D:href>/dav/1/default/</D:href>",
+		"<D:href>/dav/1/" + strconv.Itoa(work) + "/</D:href>",
+		"<D:displayname>Work</D:displayname>",
+		"<C:calendar/>",
+		`<x:unknown xmlns:x="urn:example"/>`,
+		"HTTP/1.1 404 Not Found",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("PROPFIND home: missing %q in\n%s", want, body)
+		}
+	}
+
+	resp, body = do(t, ts, "PROPFIND", "/dav/1/default/", "", map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND calendar: expected 207, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, "<D:href>/dav/1/default/standup-1.ics</D:href>") || !strings.Contains(body, "<D:getetag>") {
+		t.Errorf("PROPFIND calendar: event not listed in\n%s", body)
+	}
+
+	resp, body = do(t, ts, "PROPFIND", "/dav/1/default/", "", map[string]string{"Depth": "0"})
+	if resp.StatusCode != http.StatusMultiStatus || strings.Contains(body, "standup-1.ics") {
+		t.Errorf("PROPFIND Depth 0 must not list members:\n%s", body)
+	}
+
+	resp, _ = do(t, ts, "PROPFIND", "/dav/2/"+strconv.Itoa(work)+"/", "", map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PROPFIND on unshared calendar: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestReport(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	do(t, ts, "PUT", "/dav/1/default/standup-1.ics", standup, nil)
+	allDay := strings.NewReplacer(
+		"standup-1", "holiday-1",
+		"DTSTART:20240510T090000Z", "DTSTART;VALUE=DATE:20240601",
+		"DTEND:20240510T093000Z", "DTEND;VALUE=DATE:20240602",
+	).Replace(standup)
+	do(t, ts, "PUT", "/dav/1/default/holiday-1.ics", allDay, nil)
+
+	query := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="20240601T000000Z" end="20240701T000000Z"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+	resp, body := do(t, ts, "REPORT", "/dav/1/default/", query, map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("calendar-query: expected 207, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, "holiday-1.ics") || strings.Contains(body, "standup-1.ics") {
+		t.Errorf("calendar-query: wrong time-range filtering:\n%s", body)
+	}
+	if !strings.Contains(body, "DTSTART;VALUE=DATE:20240601") {
+		t.Errorf("calendar-query: calendar-data missing:\n%s", body)
+	}
+
+	multiget := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <D:href>/dav/1/default/standup-1.ics</D:href>
+  <D:href>/dav/1/default/missing.ics</D:href>
+</C:calendar-multiget>`
+	resp, body = do(t, ts, "REPORT", "/dav/1/default/", multiget, nil)
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("calendar-multiget: expected 207, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(body, "SUMMARY:Standup\\, daily") {
+		t.Errorf("calendar-multiget: calendar-data missing:\n%s", body)
+	}
+	if !strings.Contains(body, "<D:href>/dav/1/default/missing.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>") {
+		t.Errorf("calendar-multiget: missing href not reported:\n%s", body)
+	}
+}
+
+func TestSharedCalendarPermissions(t *testing.T) {
+	ts, cal := newTestServer()
+	defer ts.Close()
+
+	team := cal.CreateCalendar(1, "Team")
+	cal.ShareCalendar(team, 1, 2, calendar.PermissionRead)
+	path := "/dav/2/" + strconv.Itoa(team) + "/standup-1.ics"
+
+	resp, _ := do(t, ts, "PUT", path, standup, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("PUT with read access: expected 403, got %d", resp.StatusCode)
+	}
+
+	cal.ShareCalendar(team, 1, 2, calendar.PermissionWrite)
+	resp, _ = do(t, ts, "PUT", path, standup, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT with write access: expected 201, got %d", resp.StatusCode)
+	}
+
+	resp, _ = do(t, ts, "GET", "/dav/1/"+strconv.Itoa(team)+"/standup-1.ics", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("owner GET of shared event: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestResourceNameDiffersFromUID(t *testing.T) {
+	ts, cal := newTestServer()
+	defer ts.Close()
+
+	resp, _ := do(t, ts, "PUT", "/dav/1/default/A1B2-C3.ics", standup, map[string]string{"If-None-Match": "*"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: expected 201, got %d", resp.StatusCode)
+	}
+
+	resp, body := do(t, ts, "GET", "/dav/1/default/A1B2-C3.ics", "", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "UID:standup-1") {
+		t.Fatalf("GET: status %d, body:\n%s", resp.StatusCode, body)
+	}
+	resp, _ = do(t, ts, "GET", "/dav/1/default/standup-1.ics", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET by UID: expected 404, got %d", resp.StatusCode)
+	}
+
+	_, body = do(t, ts, "PROPFIND", "/dav/1/default/", "", map[string]string{"Depth": "1"})
+	if !strings.Contains(body, "<D:href>/dav/1/default/A1B2-C3.ics</D:href>") {
+		t.Errorf("PROPFIND: resource not listed under its name:\n%s", body)
+	}
+
+	resp, _ = do(t, ts, "PUT", "/dav/1/default/other.ics", standup, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("PUT of a second resource with the same UID: expected 409, got %d", resp.StatusCode)
+	}
+
+	updated := strings.Replace(standup, "Standup\\, daily", "Standup moved", 1)
+	resp, _ = do(t, ts, "PUT", "/dav/1/default/A1B2-C3.ics", updated, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT update: expected 204, got %d", resp.StatusCode)
+	}
+	events, _ := cal.GetCalendarEvents(1, 0)
+	if len(events) != 1 || events[0].Event != "Standup moved" || events[0].UID != "standup-1" {
+		t.Errorf("unexpected events after update: %+v", events)
+	}
+}
+
+func TestEscapedResourceName(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	resp, _ := do(t, ts, "PUT", "/dav/1/default/team%20standup.ics", standup, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: expected 201, got %d", resp.StatusCode)
+	}
+
+	_, body := do(t, ts, "PROPFIND", "/dav/1/default/", "", map[string]string{"Depth": "1"})
+	if !strings.Contains(body, "<D:href>/dav/1/default/team%20standup.ics</D:href>") {
+		t.Errorf("PROPFIND: href not escaped:\n%s", body)
+	}
+
+	multiget := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/></D:prop>
+  <D:href>/dav/1/default/team%20standup.ics</D:href>
+</C:calendar-multiget>`
+	_, body = do(t, ts, "REPORT", "/dav/1/default/", multiget, nil)
+	if !strings.Contains(body, "<D:href>/dav/1/default/team%20standup.ics</D:href><D:propstat>") {
+		t.Errorf("calendar-multiget: escaped href not found:\n%s", body)
+	}
+}
@@ -0,0 +1,167 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+
+	timeRangeFormat = "20060102T150405Z"
+)
+
+var prefixes = map[string]string{
+	nsDAV:    "D",
+	nsCalDAV: "C",
+	nsCS:     "CS",
+}
+
+// davRequest is the part of a PROPFIND or REPORT body the handler cares
+// about: requested properties, multiget hrefs and the query time range.
+type davRequest struct {
+	root    xml.Name
+	props   []xml.Name
+	allProp bool
+	hrefs   []string
+	start   time.Time
+	end     time.Time
+}
+
+func parseRequest(r io.Reader) (davRequest, error) {
+	req := davRequest{}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return req, fmt.Errorf("could not read body: %v", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		req.allProp = true
+		return req, nil
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var stack []xml.Name
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return req, fmt.Errorf("invalid xml: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				req.root = t.Name
+			}
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			switch {
+			case parent == (xml.Name{Space: nsDAV, Local: "prop"}) && len(stack) == 2:
+				req.props = append(req.props, t.Name)
+			case t.Name == xml.Name{Space: nsDAV, Local: "allprop"}:
+				req.allProp = true
+			case t.Name == xml.Name{Space: nsCalDAV, Local: "time-range"}:
+				for _, a := range t.Attr {
+					tm, err := time.Parse(timeRangeFormat, a.Value)
+					if err != nil {
+						return req, fmt.Errorf("invalid time-range: %v", err)
+					}
+					switch a.Name.Local {
+					case "start":
+						req.start = tm
+					case "end":
+						req.end = tm
+					}
+				}
+			}
+			stack = append(stack, t.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if t.Name == (xml.Name{Space: nsDAV, Local: "href"}) && len(stack) == 2 {
+				req.hrefs = append(req.hrefs, strings.TrimSpace(text.String()))
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(req.props) == 0 {
+		req.allProp = true
+	}
+	return req, nil
+}
+
+type propValue struct {
+	name  xml.Name
+	inner string
+}
+
+type davResponse struct {
+	href    string
+	status  int
+	found   []propValue
+	missing []xml.Name
+}
+
+func elementName(name xml.Name) (string, string) {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local, ""
+	}
+	return "x:" + name.Local, fmt.Sprintf(` xmlns:x="%s"`, escape(name.Space))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/">`)
+	for _, resp := range responses {
+		b.WriteString("<D:response><D:href>" + escape(resp.href) + "</D:href>")
+		if resp.status != 0 {
+			fmt.Fprintf(&b, "<D:status>HTTP/1.1 %d %s</D:status>", resp.status, http.StatusText(resp.status))
+		}
+		if len(resp.found) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for _, p := range resp.found {
+				name, ns := elementName(p.name)
+				if p.inner == "" {
+					b.WriteString("<" + name + ns + "/>")
+				} else {
+					b.WriteString("<" + name + ns + ">" + p.inner + "</" + name + ">")
+				}
+			}
+			b.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+		}
+		if len(resp.missing) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for _, n := range resp.missing {
+				name, ns := elementName(n)
+				b.WriteString("<" + name + ns + "/>")
+			}
+			b.WriteString("</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+		}
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>\n")
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
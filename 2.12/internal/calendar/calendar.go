@@ -7,23 +7,42 @@ import (
 )
 
 type Event struct {
-	ID     int       `json:"id"`
-	UserID int       `json:"user_id"`
-	Date   time.Time `json:"date"`
-	Event  string    `json:"event"`
+	ID         int           `json:"id"`
+	UID        string        `json:"uid,omitempty"`
+	Resource   string        `json:"resource,omitempty"`
+	UserID     int           `json:"user_id"`
+	CalendarID int           `json:"calendar_id,omitempty"`
+	Date       time.Time     `json:"date"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Event      string        `json:"event"`
+}
+
+// NotFoundError is returned for an event ID that does not exist.
+type NotFoundError struct {
+	ID int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("Event with ID %d not found", e.ID)
 }
 
 type Calendar struct {
-	events map[int]Event
-	nextId int
-	mutex  *sync.Mutex
+	events         map[int]Event
+	nextId         int
+	calendars      map[int]UserCalendar
+	nextCalendarId int
+	workingHours   map[int]WorkingHours
+	mutex          *sync.Mutex
 }
 
 func NewCalendar() *Calendar {
 	return &Calendar{
-		events: make(map[int]Event),
-		nextId: 1,
-		mutex:  &sync.Mutex{},
+		events:         make(map[int]Event),
+		nextId:         1,
+		calendars:      make(map[int]UserCalendar),
+		nextCalendarId: 1,
+		workingHours:   make(map[int]WorkingHours),
+		mutex:          &sync.Mutex{},
 	}
 }
 
@@ -42,8 +61,8 @@ func (c *Calendar) UpdateEvent(event Event) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if _, exists := c.events[event.ID]; exists {
-		return fmt.Errorf("Event with ID %d not found", event.ID)
+	if _, exists := c.events[event.ID]; !exists {
+		return &NotFoundError{ID: event.ID}
 	}
 
 	c.events[event.ID] = event
@@ -55,13 +74,27 @@ func (c *Calendar) DeleteEvent(id int) error {
 	defer c.mutex.Unlock()
 
 	if _, exists := c.events[id]; !exists {
-		return fmt.Errorf("Event with ID %d not found", id)
+		return &NotFoundError{ID: id}
 	}
 
 	delete(c.events, id)
 	return nil
 }
 
+func (c *Calendar) GetEvent(id int) (Event, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	event, exists := c.events[id]
+	if !exists {
+		return event, &NotFoundError{ID: id}
+	}
+	return event, nil
+}
+
+// GetEventForPeriod returns the events of the period in every calendar the
+// user can read: their default calendar and the calendars they own or that
+// are shared with them.
 func (c *Calendar) GetEventForPeriod(userId int, startDate time.Time, duration time.Duration) []Event {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -70,7 +103,10 @@ func (c *Calendar) GetEventForPeriod(userId int, startDate time.Time, duration t
 	var result []Event
 
 	for _, event := range c.events {
-		if event.UserID == userId && (event.Date.Equal(startDate) || (event.Date.After(startDate) && event.Date.Before(endDate))) {
+		if c.checkEventPermission(userId, event, PermissionRead) != nil {
+			continue
+		}
+		if event.Date.Equal(startDate) || (event.Date.After(startDate) && event.Date.Before(endDate)) {
 			result = append(result, event)
 		}
 	}
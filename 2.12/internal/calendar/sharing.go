@@ -0,0 +1,291 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Permission int
+
+const (
+	PermissionNone Permission = iota
+	PermissionRead
+	PermissionWrite
+	PermissionOwner
+)
+
+var permissionNames = map[Permission]string{
+	PermissionNone:  "none",
+	PermissionRead:  "read",
+	PermissionWrite: "write",
+	PermissionOwner: "owner",
+}
+
+func ParsePermission(s string) (Permission, error) {
+	for p, name := range permissionNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return PermissionNone, fmt.Errorf("unknown permission: %s", s)
+}
+
+func (p Permission) String() string {
+	return permissionNames[p]
+}
+
+func (p Permission) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Permission) UnmarshalText(text []byte) error {
+	perm, err := ParsePermission(string(text))
+	if err != nil {
+		return err
+	}
+	*p = perm
+	return nil
+}
+
+// UserCalendar is a named calendar owned by a user. Events with a zero
+// CalendarID stay in the owner's implicit default calendar.
+type UserCalendar struct {
+	ID      int                `json:"id"`
+	OwnerID int                `json:"owner_id"`
+	Name    string             `json:"name"`
+	Shares  map[int]Permission `json:"shares,omitempty"`
+}
+
+func (c *Calendar) CreateCalendar(ownerId int, name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cal := UserCalendar{
+		ID:      c.nextCalendarId,
+		OwnerID: ownerId,
+		Name:    name,
+		Shares:  make(map[int]Permission),
+	}
+	c.nextCalendarId++
+	c.calendars[cal.ID] = cal
+
+	return cal.ID
+}
+
+func (c *Calendar) ShareCalendar(calendarId, actorId, userId int, perm Permission) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cal, exists := c.calendars[calendarId]
+	if !exists {
+		return fmt.Errorf("Calendar with ID %d not found", calendarId)
+	}
+	if c.permission(actorId, calendarId) < PermissionOwner {
+		return fmt.Errorf("user %d is not an owner of calendar %d", actorId, calendarId)
+	}
+	if userId == cal.OwnerID {
+		return fmt.Errorf("cannot change permissions of the calendar owner")
+	}
+
+	if perm == PermissionNone {
+		delete(cal.Shares, userId)
+	} else {
+		cal.Shares[userId] = perm
+	}
+	return nil
+}
+
+func (c *Calendar) GetCalendars(userId int) []UserCalendar {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var result []UserCalendar
+	for id, cal := range c.calendars {
+		if c.permission(userId, id) >= PermissionRead {
+			cal.Shares = copyShares(cal.Shares)
+			result = append(result, cal)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+func (c *Calendar) CheckPermission(userId, calendarId int, need Permission) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.checkPermission(userId, calendarId, need)
+}
+
+// checkEventPermission checks the access of a user to an existing event
+// and must be called with the mutex held. An event in a default calendar
+// is accessible to its owner only.
+func (c *Calendar) checkEventPermission(userId int, event Event, need Permission) error {
+	if event.CalendarID == 0 {
+		if event.UserID != userId {
+			return fmt.Errorf("user %d is not the owner of event %d", userId, event.ID)
+		}
+		return nil
+	}
+	return c.checkPermission(userId, event.CalendarID, need)
+}
+
+// UpdateEventAs replaces an event on behalf of a user who can write both
+// the calendar the event is in and the one it moves to, checked under the
+// same lock as the change. The event keeps its owner, UID and resource
+// name, and its date when event has a zero one. It cannot move to the
+// default calendar of another user.
+func (c *Calendar) UpdateEventAs(userId int, event Event) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	existing, exists := c.events[event.ID]
+	if !exists {
+		return &NotFoundError{ID: event.ID}
+	}
+	if err := c.checkEventPermission(userId, existing, PermissionWrite); err != nil {
+		return err
+	}
+	if event.CalendarID == 0 && existing.UserID != userId {
+		return fmt.Errorf("cannot move event %d to the default calendar of another user", event.ID)
+	}
+	if err := c.checkPermission(userId, event.CalendarID, PermissionWrite); err != nil {
+		return err
+	}
+
+	event.UserID = existing.UserID
+	event.UID = existing.UID
+	event.Resource = existing.Resource
+	if event.Date.IsZero() {
+		event.Date = existing.Date
+	}
+	c.events[event.ID] = event
+	return nil
+}
+
+// DeleteEventAs deletes an event on behalf of a user who can write its
+// calendar, checked under the same lock as the deletion.
+func (c *Calendar) DeleteEventAs(userId, id int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	existing, exists := c.events[id]
+	if !exists {
+		return &NotFoundError{ID: id}
+	}
+	if err := c.checkEventPermission(userId, existing, PermissionWrite); err != nil {
+		return err
+	}
+
+	delete(c.events, id)
+	return nil
+}
+
+func (c *Calendar) checkPermission(userId, calendarId int, need Permission) error {
+	if calendarId != 0 {
+		if _, exists := c.calendars[calendarId]; !exists {
+			return fmt.Errorf("Calendar with ID %d not found", calendarId)
+		}
+	}
+	if c.permission(userId, calendarId) < need {
+		return fmt.Errorf("user %d has no %s access to calendar %d", userId, need, calendarId)
+	}
+	return nil
+}
+
+// permission must be called with the mutex held. Calendar 0 is the
+// user's own default calendar.
+func (c *Calendar) permission(userId, calendarId int) Permission {
+	if calendarId == 0 {
+		return PermissionOwner
+	}
+	cal, exists := c.calendars[calendarId]
+	if !exists {
+		return PermissionNone
+	}
+	if cal.OwnerID == userId {
+		return PermissionOwner
+	}
+	return cal.Shares[userId]
+}
+
+func (c *Calendar) GetEventForCalendars(userId int, calendarIds []int, startDate time.Time, duration time.Duration) ([]Event, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	selected := make(map[int]bool)
+	for _, id := range calendarIds {
+		if err := c.checkPermission(userId, id, PermissionRead); err != nil {
+			return nil, err
+		}
+		selected[id] = true
+	}
+
+	endDate := startDate.Add(duration)
+	var result []Event
+
+	for _, event := range c.events {
+		if !selected[event.CalendarID] {
+			continue
+		}
+		if event.CalendarID == 0 && event.UserID != userId {
+			continue
+		}
+		if event.Date.Equal(startDate) || (event.Date.After(startDate) && event.Date.Before(endDate)) {
+			result = append(result, event)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Calendar) GetCalendarEvents(userId, calendarId int) ([]Event, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkPermission(userId, calendarId, PermissionRead); err != nil {
+		return nil, err
+	}
+
+	var result []Event
+	for _, event := range c.events {
+		if event.CalendarID != calendarId {
+			continue
+		}
+		if calendarId == 0 && event.UserID != userId {
+			continue
+		}
+		result = append(result, event)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+// CreateEventUnless creates the event unless taken holds for an event of
+// the same calendar, both under one lock so that no other event can come
+// in between. taken runs under the lock and must not call c. It returns
+// the ID of the new event and whether it was created.
+func (c *Calendar) CreateEventUnless(event Event, taken func(Event) bool) (int, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, other := range c.events {
+		if other.CalendarID != event.CalendarID {
+			continue
+		}
+		if event.CalendarID == 0 && other.UserID != event.UserID {
+			continue
+		}
+		if taken(other) {
+			return 0, false
+		}
+	}
+
+	event.ID = c.nextId
+	c.nextId++
+	c.events[event.ID] = event
+	return event.ID, true
+}
@@ -0,0 +1,168 @@
+package calendar
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCalendarSharing(t *testing.T) {
+	c := NewCalendar()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	work := c.CreateCalendar(1, "Work")
+	team := c.CreateCalendar(2, "Team")
+	c.CreateEvent(Event{UserID: 1, CalendarID: work, Date: day, Event: "review"})
+	c.CreateEvent(Event{UserID: 2, CalendarID: team, Date: day, Event: "retro"})
+	c.CreateEvent(Event{UserID: 1, Date: day, Event: "dentist"})
+	c.CreateEvent(Event{UserID: 2, Date: day, Event: "gym"})
+
+	if _, err := c.GetEventForCalendars(1, []int{team}, day, 24*time.Hour); err == nil {
+		t.Fatalf("expected error reading a calendar that is not shared")
+	}
+	if err := c.ShareCalendar(team, 1, 3, PermissionRead); err == nil {
+		t.Fatalf("expected error sharing a calendar owned by someone else")
+	}
+	if err := c.ShareCalendar(team, 2, 1, PermissionRead); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+
+	events, err := c.GetEventForCalendars(1, []int{0, work, team}, day, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("overlay: %v", err)
+	}
+	got := map[string]bool{}
+	for _, e := range events {
+		got[e.Event] = true
+	}
+	for _, name := range []string{"review", "retro", "dentist"} {
+		if !got[name] {
+			t.Errorf("expected %q in overlay, got %+v", name, events)
+		}
+	}
+	if got["gym"] {
+		t.Errorf("default calendar of another user leaked into overlay")
+	}
+
+	if err := c.CheckPermission(1, team, PermissionWrite); err == nil {
+		t.Errorf("read share must not allow writes")
+	}
+	if err := c.ShareCalendar(team, 2, 1, PermissionWrite); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if err := c.CheckPermission(1, team, PermissionWrite); err != nil {
+		t.Errorf("write share: %v", err)
+	}
+
+	if calendars := c.GetCalendars(1); len(calendars) != 2 {
+		t.Errorf("expected 2 calendars for user 1, got %+v", calendars)
+	}
+	if err := c.ShareCalendar(team, 2, 1, PermissionNone); err != nil {
+		t.Fatalf("unshare: %v", err)
+	}
+	if calendars := c.GetCalendars(1); len(calendars) != 1 {
+		t.Errorf("expected 1 calendar after unshare, got %+v", calendars)
+	}
+}
+
+func TestEventsForPeriodFollowShares(t *testing.T) {
+	c := NewCalendar()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	team := c.CreateCalendar(1, "Team")
+	c.ShareCalendar(team, 1, 2, PermissionWrite)
+	c.CreateEvent(Event{UserID: 2, CalendarID: team, Date: day, Event: "retro"})
+	c.CreateEvent(Event{UserID: 2, Date: day, Event: "gym"})
+
+	names := func(userId int) map[string]bool {
+		got := map[string]bool{}
+		for _, e := range c.GetEventForPeriod(userId, day, 24*time.Hour) {
+			got[e.Event] = true
+		}
+		return got
+	}
+	if got := names(1); !got["retro"] || got["gym"] {
+		t.Errorf("expected the owner to see retro and not gym, got %v", got)
+	}
+	if got := names(2); !got["retro"] || !got["gym"] {
+		t.Errorf("expected the sharee to see retro and gym, got %v", got)
+	}
+
+	c.ShareCalendar(team, 1, 2, PermissionNone)
+	if got := names(2); got["retro"] || !got["gym"] {
+		t.Errorf("expected a revoked sharee to see only gym, got %v", got)
+	}
+}
+
+func TestEventChangesAs(t *testing.T) {
+	c := NewCalendar()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	team := c.CreateCalendar(1, "Team")
+	c.ShareCalendar(team, 1, 2, PermissionRead)
+	id := c.CreateEvent(Event{UserID: 1, CalendarID: team, UID: "retro@x", Date: day, Event: "retro"})
+
+	if err := c.UpdateEventAs(2, Event{ID: id, CalendarID: team, Date: day, Event: "mine"}); err == nil {
+		t.Errorf("expected a read share to refuse an update")
+	}
+	if err := c.DeleteEventAs(2, id); err == nil {
+		t.Errorf("expected a read share to refuse a deletion")
+	}
+
+	c.ShareCalendar(team, 1, 2, PermissionWrite)
+	if err := c.UpdateEventAs(2, Event{ID: id, Date: day, Event: "mine"}); err == nil {
+		t.Errorf("expected a move to the default calendar of another user to fail")
+	}
+	if err := c.UpdateEventAs(2, Event{ID: id, CalendarID: team, Date: day, Event: "retro moved"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	event, _ := c.GetEvent(id)
+	if event.UserID != 1 || event.UID != "retro@x" || event.Event != "retro moved" {
+		t.Errorf("expected the owner and UID to be kept, got %+v", event)
+	}
+
+	if err := c.DeleteEventAs(2, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := c.DeleteEventAs(2, id).(*NotFoundError); !ok {
+		t.Errorf("expected a NotFoundError for a deleted event")
+	}
+}
+
+func TestCreateEventUnless(t *testing.T) {
+	c := NewCalendar()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	team := c.CreateCalendar(1, "Team")
+	c.CreateEvent(Event{UserID: 1, CalendarID: team, UID: "retro@x", Date: day, Event: "retro"})
+	c.CreateEvent(Event{UserID: 2, UID: "gym@x", Date: day, Event: "gym"})
+	sameUID := func(uid string) func(Event) bool {
+		return func(other Event) bool { return other.UID == uid }
+	}
+
+	if _, created := c.CreateEventUnless(Event{UserID: 2, CalendarID: team, UID: "retro@x"}, sameUID("retro@x")); created {
+		t.Errorf("expected a taken UID to refuse the event")
+	}
+	if _, created := c.CreateEventUnless(Event{UserID: 1, UID: "gym@x"}, sameUID("gym@x")); !created {
+		t.Errorf("expected the default calendar of another user to be ignored")
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	count := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, created := c.CreateEventUnless(Event{UserID: 1, CalendarID: team, UID: "standup@x"}, sameUID("standup@x")); created {
+				mutex.Lock()
+				count++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 1 {
+		t.Errorf("expected one of the concurrent creations to succeed, got %d", count)
+	}
+}
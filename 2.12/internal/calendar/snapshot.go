@@ -0,0 +1,128 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshots made by Snapshot.
+// Version 2 added working hours and CalDAV resource names; snapshots of
+// version 1 are still restored.
+const SnapshotVersion = 2
+
+// MinSnapshotVersion is the oldest snapshot version that is restored.
+const MinSnapshotVersion = 1
+
+type Snapshot struct {
+	Version        int            `json:"version"`
+	CreatedAt      time.Time      `json:"created_at"`
+	NextID         int            `json:"next_id"`
+	NextCalendarID int            `json:"next_calendar_id"`
+	Events         []Event        `json:"events"`
+	Calendars      []UserCalendar `json:"calendars"`
+
+	WorkingHours map[int]WorkingHours `json:"working_hours,omitempty"`
+}
+
+func (c *Calendar) Snapshot() Snapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	snap := Snapshot{
+		Version:        SnapshotVersion,
+		CreatedAt:      time.Now().UTC(),
+		NextID:         c.nextId,
+		NextCalendarID: c.nextCalendarId,
+		Events:         make([]Event, 0, len(c.events)),
+		Calendars:      make([]UserCalendar, 0, len(c.calendars)),
+		WorkingHours:   make(map[int]WorkingHours, len(c.workingHours)),
+	}
+	for _, event := range c.events {
+		snap.Events = append(snap.Events, event)
+	}
+	for _, cal := range c.calendars {
+		cal.Shares = copyShares(cal.Shares)
+		snap.Calendars = append(snap.Calendars, cal)
+	}
+	for userId, wh := range c.workingHours {
+		snap.WorkingHours[userId] = wh
+	}
+	sort.Slice(snap.Events, func(i, j int) bool { return snap.Events[i].ID < snap.Events[j].ID })
+	sort.Slice(snap.Calendars, func(i, j int) bool { return snap.Calendars[i].ID < snap.Calendars[j].ID })
+
+	return snap
+}
+
+// CheckVersion tells whether the snapshot has a version that is restored.
+func (snap Snapshot) CheckVersion() error {
+	if snap.Version < MinSnapshotVersion || snap.Version > SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d to %d", snap.Version, MinSnapshotVersion, SnapshotVersion)
+	}
+	return nil
+}
+
+func (c *Calendar) Restore(snap Snapshot) error {
+	if err := snap.CheckVersion(); err != nil {
+		return err
+	}
+	if snap.Version == 1 {
+		// working hours did not exist yet
+		snap.WorkingHours = nil
+	}
+	if snap.NextID < 1 || snap.NextCalendarID < 1 {
+		return fmt.Errorf("invalid ID counters in snapshot")
+	}
+
+	calendars := make(map[int]UserCalendar, len(snap.Calendars))
+	for _, cal := range snap.Calendars {
+		if cal.ID <= 0 || cal.ID >= snap.NextCalendarID {
+			return fmt.Errorf("calendar ID %d is out of range", cal.ID)
+		}
+		if _, exists := calendars[cal.ID]; exists {
+			return fmt.Errorf("duplicate calendar ID %d", cal.ID)
+		}
+		cal.Shares = copyShares(cal.Shares)
+		calendars[cal.ID] = cal
+	}
+
+	events := make(map[int]Event, len(snap.Events))
+	for _, event := range snap.Events {
+		if event.ID <= 0 || event.ID >= snap.NextID {
+			return fmt.Errorf("event ID %d is out of range", event.ID)
+		}
+		if _, exists := events[event.ID]; exists {
+			return fmt.Errorf("duplicate event ID %d", event.ID)
+		}
+		if _, exists := calendars[event.CalendarID]; event.CalendarID != 0 && !exists {
+			return fmt.Errorf("event %d refers to missing calendar %d", event.ID, event.CalendarID)
+		}
+		events[event.ID] = event
+	}
+
+	workingHours := make(map[int]WorkingHours, len(snap.WorkingHours))
+	for userId, wh := range snap.WorkingHours {
+		if err := wh.Validate(); err != nil {
+			return fmt.Errorf("working hours of user %d: %v", userId, err)
+		}
+		workingHours[userId] = wh
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.events = events
+	c.workingHours = workingHours
+	c.nextId = snap.NextID
+	c.calendars = calendars
+	c.nextCalendarId = snap.NextCalendarID
+	return nil
+}
+
+func copyShares(shares map[int]Permission) map[int]Permission {
+	result := make(map[int]Permission, len(shares))
+	for user, perm := range shares {
+		result[user] = perm
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type WorkingHours struct {
+	Start    string         `json:"start"`
+	End      string         `json:"end"`
+	Days     []time.Weekday `json:"days"`
+	Timezone string         `json:"timezone,omitempty"`
+}
+
+var DefaultWorkingHours = WorkingHours{
+	Start: "09:00",
+	End:   "18:00",
+	Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+}
+
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (wh WorkingHours) Validate() error {
+	start, err := parseClock(wh.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(wh.End)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return fmt.Errorf("working hours must end after they start")
+	}
+	for _, d := range wh.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", d)
+		}
+	}
+	_, err = wh.Location()
+	return err
+}
+
+func (wh WorkingHours) Location() (*time.Location, error) {
+	if wh.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(wh.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", wh.Timezone)
+	}
+	return loc, nil
+}
+
+func (wh WorkingHours) IsWorkday(day time.Time) bool {
+	for _, d := range wh.Days {
+		if day.Weekday() == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Window returns the working interval of the given calendar day.
+func (wh WorkingHours) Window(day time.Time) (time.Time, time.Time, error) {
+	loc, err := wh.Location()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, err := parseClock(wh.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseClock(wh.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	// wall clock times, which are not the time elapsed since midnight on
+	// the days the clocks change
+	at := func(clock time.Duration) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, loc)
+	}
+	return at(start), at(end), nil
+}
+
+func (c *Calendar) SetWorkingHours(userId int, wh WorkingHours) error {
+	if err := wh.Validate(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.workingHours[userId] = wh
+	return nil
+}
+
+func (c *Calendar) GetWorkingHours(userId int) WorkingHours {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if wh, exists := c.workingHours[userId]; exists {
+		return wh
+	}
+	return DefaultWorkingHours
+}
+
+// FreeSlots returns the gaps of at least minDuration between the user's
+// events inside working hours for days calendar days starting at date.
+// Events without a duration do not block time. Days for which isHoliday
+// returns true are skipped.
+func (c *Calendar) FreeSlots(userId int, date time.Time, days int, minDuration time.Duration, isHoliday func(time.Time) bool) ([]Slot, error) {
+	wh := c.GetWorkingHours(userId)
+
+	var result []Slot
+	for i := 0; i < days; i++ {
+		day := date.AddDate(0, 0, i)
+		if !wh.IsWorkday(day) || (isHoliday != nil && isHoliday(day)) {
+			continue
+		}
+
+		start, end, err := wh.Window(day)
+		if err != nil {
+			return nil, err
+		}
+
+		var busy []Slot
+		for _, event := range c.GetEventForPeriod(userId, start.Add(-24*time.Hour), end.Sub(start)+24*time.Hour) {
+			if event.Duration > 0 {
+				busy = append(busy, Slot{Start: event.Date, End: event.Date.Add(event.Duration)})
+			}
+		}
+		sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+
+		cursor := start
+		for _, b := range busy {
+			if b.End.Before(cursor) || b.End.Equal(cursor) {
+				continue
+			}
+			if b.Start.After(end) {
+				break
+			}
+			if b.Start.Sub(cursor) >= minDuration && b.Start.After(cursor) {
+				result = append(result, Slot{Start: cursor, End: b.Start})
+			}
+			if b.End.After(cursor) {
+				cursor = b.End
+			}
+		}
+		if end.Sub(cursor) >= minDuration && end.After(cursor) {
+			result = append(result, Slot{Start: cursor, End: end})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreeSlots(t *testing.T) {
+	c := NewCalendar()
+	err := c.SetWorkingHours(1, WorkingHours{Start: "09:00", End: "13:00", Days: []time.Weekday{time.Monday, time.Tuesday}})
+	if err != nil {
+		t.Fatalf("set working hours: %v", err)
+	}
+
+	monday := time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)
+	at := func(day time.Time, hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	c.CreateEvent(Event{UserID: 1, Date: at(monday, 8, 30), Duration: time.Hour, Event: "early"})
+	c.CreateEvent(Event{UserID: 1, Date: at(monday, 10, 0), Duration: 90 * time.Minute, Event: "review"})
+	c.CreateEvent(Event{UserID: 1, Date: at(monday, 11, 45), Event: "reminder"})
+	c.CreateEvent(Event{UserID: 2, Date: at(monday, 12, 0), Duration: time.Hour, Event: "not mine"})
+
+	slots, err := c.FreeSlots(1, monday, 3, 30*time.Minute, func(day time.Time) bool {
+		return day.Weekday() == time.Tuesday
+	})
+	if err != nil {
+		t.Fatalf("free slots: %v", err)
+	}
+
+	want := []Slot{
+		{at(monday, 9, 30), at(monday, 10, 0)},
+		{at(monday, 11, 30), at(monday, 13, 0)},
+	}
+	if len(slots) != len(want) {
+		t.Fatalf("got slots %+v, want %+v", slots, want)
+	}
+	for i := range want {
+		if !slots[i].Start.Equal(want[i].Start) || !slots[i].End.Equal(want[i].End) {
+			t.Errorf("slot %d: got %+v, want %+v", i, slots[i], want[i])
+		}
+	}
+
+	if err := c.SetWorkingHours(1, WorkingHours{Start: "18:00", End: "09:00"}); err == nil {
+		t.Errorf("expected error for inverted working hours")
+	}
+}
+
+func TestWindowOnClockChanges(t *testing.T) {
+	wh := WorkingHours{Start: "09:00", End: "17:30", Timezone: "Europe/Berlin"}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	// the clocks go forward on 31 March and back on 27 October
+	for _, day := range []time.Time{
+		time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 27, 0, 0, 0, 0, time.UTC),
+	} {
+		start, end, err := wh.Window(day)
+		if err != nil {
+			t.Fatalf("window: %v", err)
+		}
+		wantStart := time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, berlin)
+		wantEnd := time.Date(day.Year(), day.Month(), day.Day(), 17, 30, 0, 0, berlin)
+		if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+			t.Errorf("got %s to %s, want %s to %s", start, end, wantStart, wantEnd)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/digest"
+)
+
+type Client struct {
+	BaseURL    string
+	Token      string
+	AdminToken string
+	HTTPClient *http.Client
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	ID     int             `json:"id"`
+	Error  string          `json:"error"`
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *Client) do(method, path string, params url.Values) (response, error) {
+	var resp response
+
+	endpoint := c.BaseURL + path
+	var body *strings.Reader
+	if method == http.MethodGet {
+		endpoint += "?" + params.Encode()
+		body = strings.NewReader("")
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return resp, fmt.Errorf("could not create request: %v", err)
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpResp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return resp, fmt.Errorf("request failed: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	if err != nil {
+		return resp, fmt.Errorf("could not decode response: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		if resp.Error == "" {
+			resp.Error = httpResp.Status
+		}
+		return resp, fmt.Errorf("server error: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+func eventParams(event calendar.Event) url.Values {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(event.UserID))
+	if !event.Date.IsZero() {
+		params.Set("date", event.Date.Format(time.RFC3339))
+	}
+	params.Set("event", event.Event)
+	if event.CalendarID != 0 {
+		params.Set("calendar_id", strconv.Itoa(event.CalendarID))
+	}
+	if event.Duration != 0 {
+		params.Set("duration", event.Duration.String())
+	}
+	return params
+}
+
+func (c *Client) CreateEvent(event calendar.Event) (int, error) {
+	resp, err := c.do(http.MethodPost, "/create_event", eventParams(event))
+	if err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// UpdateEvent replaces an event. An event with a zero Date keeps its date.
+func (c *Client) UpdateEvent(event calendar.Event) error {
+	params := eventParams(event)
+	params.Set("id", strconv.Itoa(event.ID))
+	_, err := c.do(http.MethodPost, "/update_event", params)
+	return err
+}
+
+func (c *Client) DeleteEvent(userID, id int) error {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("id", strconv.Itoa(id))
+	_, err := c.do(http.MethodPost, "/delete_event", params)
+	return err
+}
+
+func (c *Client) eventsForPeriod(path string, userID int, date time.Time, calendarIDs []int) ([]calendar.Event, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("date", date.Format("2006-01-02"))
+	if len(calendarIDs) > 0 {
+		ids := make([]string, len(calendarIDs))
+		for i, id := range calendarIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		params.Set("calendar_ids", strings.Join(ids, ","))
+	}
+
+	resp, err := c.do(http.MethodGet, path, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []calendar.Event
+	if len(resp.Result) == 0 {
+		return events, nil
+	}
+	err = json.Unmarshal(resp.Result, &events)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode events: %v", err)
+	}
+	return events, nil
+}
+
+func (c *Client) EventsForDay(userID int, date time.Time, calendarIDs ...int) ([]calendar.Event, error) {
+	return c.eventsForPeriod("/events_for_day", userID, date, calendarIDs)
+}
+
+func (c *Client) EventsForWeek(userID int, date time.Time, calendarIDs ...int) ([]calendar.Event, error) {
+	return c.eventsForPeriod("/events_for_week", userID, date, calendarIDs)
+}
+
+func (c *Client) EventsForMonth(userID int, date time.Time, calendarIDs ...int) ([]calendar.Event, error) {
+	return c.eventsForPeriod("/events_for_month", userID, date, calendarIDs)
+}
+
+func (c *Client) CreateCalendar(userID int, name string) (int, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("name", name)
+
+	resp, err := c.do(http.MethodPost, "/create_calendar", params)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) ShareCalendar(calendarID, userID, shareWith int, perm calendar.Permission) error {
+	params := url.Values{}
+	params.Set("calendar_id", strconv.Itoa(calendarID))
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("share_with", strconv.Itoa(shareWith))
+	params.Set("permission", perm.String())
+
+	_, err := c.do(http.MethodPost, "/share_calendar", params)
+	return err
+}
+
+func (c *Client) Calendars(userID int) ([]calendar.UserCalendar, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+
+	resp, err := c.do(http.MethodGet, "/calendars", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var calendars []calendar.UserCalendar
+	if len(resp.Result) == 0 {
+		return calendars, nil
+	}
+	err = json.Unmarshal(resp.Result, &calendars)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode calendars: %v", err)
+	}
+	return calendars, nil
+}
+
+func (c *Client) QuickAdd(userID, calendarID int, text string) ([]calendar.Event, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("text", text)
+	if calendarID != 0 {
+		params.Set("calendar_id", strconv.Itoa(calendarID))
+	}
+
+	resp, err := c.do(http.MethodPost, "/quick_add", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []calendar.Event
+	err = json.Unmarshal(resp.Result, &events)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode events: %v", err)
+	}
+	return events, nil
+}
+
+func (c *Client) adminRequest(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+
+	// snapshots may be large, so admin requests are not bound by the client timeout
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	httpResp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		var resp response
+		if json.NewDecoder(httpResp.Body).Decode(&resp) != nil || resp.Error == "" {
+			resp.Error = httpResp.Status
+		}
+		return nil, fmt.Errorf("server error: %s", resp.Error)
+	}
+	return httpResp, nil
+}
+
+// Snapshot streams the server snapshot to w.
+func (c *Client) Snapshot(w io.Writer) error {
+	resp, err := c.adminRequest(http.MethodGet, "/admin/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) Restore(r io.Reader) error {
+	resp, err := c.adminRequest(http.MethodPost, "/admin/restore", r)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *Client) Workdays(from, to time.Time, country string, userID int) ([]string, error) {
+	params := url.Values{}
+	params.Set("from", from.Format("2006-01-02"))
+	params.Set("to", to.Format("2006-01-02"))
+	if country != "" {
+		params.Set("country", country)
+	}
+	if userID != 0 {
+		params.Set("user_id", strconv.Itoa(userID))
+	}
+
+	resp, err := c.do(http.MethodGet, "/workdays", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	err = json.Unmarshal(resp.Result, &days)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode workdays: %v", err)
+	}
+	return days, nil
+}
+
+func (c *Client) WorkingHours(userID int) (calendar.WorkingHours, error) {
+	var wh calendar.WorkingHours
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+
+	resp, err := c.do(http.MethodGet, "/working_hours", params)
+	if err != nil {
+		return wh, err
+	}
+	err = json.Unmarshal(resp.Result, &wh)
+	if err != nil {
+		return wh, fmt.Errorf("could not decode working hours: %v", err)
+	}
+	return wh, nil
+}
+
+func (c *Client) SetWorkingHours(userID int, wh calendar.WorkingHours) error {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("start", wh.Start)
+	params.Set("end", wh.End)
+	if wh.Timezone != "" {
+		params.Set("tz", wh.Timezone)
+	}
+	if len(wh.Days) > 0 {
+		days := make([]string, len(wh.Days))
+		for i, d := range wh.Days {
+			days[i] = strconv.Itoa(int(d))
+		}
+		params.Set("days", strings.Join(days, ","))
+	}
+
+	_, err := c.do(http.MethodPost, "/working_hours", params)
+	return err
+}
+
+func (c *Client) FreeSlots(userID int, date time.Time, days int, duration time.Duration, country string) ([]calendar.Slot, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("date", date.Format("2006-01-02"))
+	params.Set("days", strconv.Itoa(days))
+	params.Set("duration", duration.String())
+	if country != "" {
+		params.Set("country", country)
+	}
+
+	resp, err := c.do(http.MethodGet, "/free_slots", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []calendar.Slot
+	if len(resp.Result) == 0 {
+		return slots, nil
+	}
+	err = json.Unmarshal(resp.Result, &slots)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode slots: %v", err)
+	}
+	return slots, nil
+}
+
+func (c *Client) Digest(userID int, date time.Time, format digest.Format, tz string) (digest.Digest, error) {
+	var d digest.Digest
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("date", date.Format("2006-01-02"))
+	params.Set("format", string(format))
+	if tz != "" {
+		params.Set("tz", tz)
+	}
+
+	resp, err := c.do(http.MethodGet, "/digest", params)
+	if err != nil {
+		return d, err
+	}
+	err = json.Unmarshal(resp.Result, &d)
+	if err != nil {
+		return d, fmt.Errorf("could not decode digest: %v", err)
+	}
+	return d, nil
+}
+
+func (c *Client) SubscribeDigest(sub digest.Subscription) error {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(sub.UserID))
+	params.Set("at", sub.At)
+	params.Set("format", string(sub.Format))
+	if sub.Timezone != "" {
+		params.Set("tz", sub.Timezone)
+	}
+
+	_, err := c.do(http.MethodPost, "/digest_subscription", params)
+	return err
+}
+
+func (c *Client) UnsubscribeDigest(userID int) error {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("enabled", "false")
+
+	_, err := c.do(http.MethodPost, "/digest_subscription", params)
+	return err
+}
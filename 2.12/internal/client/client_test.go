@@ -0,0 +1,257 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/server"
+)
+
+func newTestServer(token string) *httptest.Server {
+	srv := &server.Server{Calendar: calendar.NewCalendar(), AdminToken: "admin"}
+	return httptest.NewServer(server.TokenMiddleware(token, srv.Routes()))
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+	c := NewClient(ts.URL, "secret")
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	id, err := c.CreateEvent(calendar.Event{UserID: 1, Date: date, Event: "meeting"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	err = c.UpdateEvent(calendar.Event{ID: id, UserID: 1, Date: date, Event: "standup"})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	events, err := c.EventsForWeek(1, date)
+	if err != nil {
+		t.Fatalf("week: %v", err)
+	}
+	if len(events) != 1 || events[0].Event != "standup" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	// an update without a date keeps the date of the event
+	err = c.UpdateEvent(calendar.Event{ID: id, UserID: 1, Event: "retro"})
+	if err != nil {
+		t.Fatalf("update without a date: %v", err)
+	}
+	events, err = c.EventsForDay(1, date)
+	if err != nil || len(events) != 1 || events[0].Event != "retro" {
+		t.Fatalf("expected the event to stay on its day, got %+v (%v)", events, err)
+	}
+	if _, err := c.CreateEvent(calendar.Event{UserID: 1, Event: "undated"}); err == nil {
+		t.Errorf("expected an event without a date to be refused")
+	}
+
+	if err := c.DeleteEvent(1, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	events, err = c.EventsForDay(1, date)
+	if err != nil {
+		t.Fatalf("day: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events, got %+v", events)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+
+	_, err := NewClient(ts.URL, "wrong").EventsForDay(1, time.Now())
+	if err == nil {
+		t.Errorf("expected unauthorized error")
+	}
+
+	err = NewClient(ts.URL, "secret").DeleteEvent(1, 42)
+	if err == nil {
+		t.Errorf("expected error for missing event")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+	c := NewClient(ts.URL, "secret")
+	c.AdminToken = "admin"
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	calendarID, _ := c.CreateCalendar(1, "Work")
+	c.CreateEvent(calendar.Event{UserID: 1, Date: date, Event: "first"})
+	c.CreateEvent(calendar.Event{UserID: 1, CalendarID: calendarID, Date: date, Event: "second"})
+
+	var buf bytes.Buffer
+	if err := c.Snapshot(&buf); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	snapshot := buf.String()
+
+	c.CreateEvent(calendar.Event{UserID: 1, Date: date, Event: "after backup"})
+	if err := c.Restore(strings.NewReader(snapshot)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	events, err := c.EventsForDay(1, date)
+	if err != nil {
+		t.Fatalf("day: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected the 2 events from the snapshot, got %+v", events)
+	}
+	id, err := c.CreateEvent(calendar.Event{UserID: 1, Date: date, Event: "third"})
+	if err != nil || id != 3 {
+		t.Fatalf("expected restored ID counter to give ID 3, got %d (%v)", id, err)
+	}
+
+	bad := strings.Replace(snapshot, `"version":2`, `"version":99`, 1)
+	if err := c.Restore(strings.NewReader(bad)); err == nil {
+		t.Errorf("expected error for unsupported snapshot version")
+	}
+
+	c.AdminToken = "secret"
+	if err := c.Snapshot(&buf); err == nil {
+		t.Errorf("expected snapshot to require the admin token")
+	}
+}
+
+func TestEventPermissions(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+	c := NewClient(ts.URL, "secret")
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	private, _ := c.CreateEvent(calendar.Event{UserID: 1, Date: date, Event: "dentist"})
+	teamID, _ := c.CreateCalendar(1, "Team")
+	shared, _ := c.CreateEvent(calendar.Event{UserID: 1, CalendarID: teamID, Date: date, Event: "retro"})
+
+	if err := c.UpdateEvent(calendar.Event{ID: private, UserID: 2, Date: date, Event: "taken"}); err == nil {
+		t.Errorf("expected another user's default calendar event to be read-only")
+	}
+	if err := c.DeleteEvent(2, private); err == nil {
+		t.Errorf("expected another user's default calendar event not to be deleted")
+	}
+
+	if err := c.ShareCalendar(teamID, 1, 2, calendar.PermissionRead); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if err := c.DeleteEvent(2, shared); err == nil {
+		t.Errorf("expected a read share not to allow deletes")
+	}
+
+	if err := c.ShareCalendar(teamID, 1, 2, calendar.PermissionWrite); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if err := c.UpdateEvent(calendar.Event{ID: shared, UserID: 2, Date: date, Event: "mine"}); err == nil {
+		t.Errorf("expected moving the event to another user's default calendar to fail")
+	}
+	if err := c.UpdateEvent(calendar.Event{ID: shared, UserID: 2, CalendarID: teamID, Date: date, Event: "retro moved"}); err != nil {
+		t.Fatalf("update with a write share: %v", err)
+	}
+	events, err := c.EventsForDay(1, date, teamID)
+	if err != nil || len(events) != 1 || events[0].UserID != 1 || events[0].Event != "retro moved" {
+		t.Errorf("expected the event to keep its owner, got %+v (%v)", events, err)
+	}
+	if err := c.DeleteEvent(2, shared); err != nil {
+		t.Errorf("delete with a write share: %v", err)
+	}
+	if err := c.DeleteEvent(1, private); err != nil {
+		t.Errorf("delete by the owner: %v", err)
+	}
+}
+
+func TestRestoreVersion1Snapshot(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+	c := NewClient(ts.URL, "secret")
+	c.AdminToken = "admin"
+
+	defaults, err := c.WorkingHours(99)
+	if err != nil {
+		t.Fatalf("working hours: %v", err)
+	}
+	custom := calendar.WorkingHours{Start: "10:00", End: "12:00", Days: []time.Weekday{time.Monday}}
+	if err := c.SetWorkingHours(1, custom); err != nil {
+		t.Fatalf("set working hours: %v", err)
+	}
+
+	// as written by a server from before working hours
+	snapshot := `{"version":1,"created_at":"2024-05-01T10:00:00Z","next_id":3,"next_calendar_id":2,` +
+		`"events":[{"id":1,"user_id":1,"date":"2024-05-10T00:00:00Z","event":"first"},` +
+		`{"id":2,"user_id":1,"calendar_id":1,"date":"2024-05-10T00:00:00Z","event":"second"}],` +
+		`"calendars":[{"id":1,"owner_id":1,"name":"Work","shares":{"2":"read"}}]}`
+	if err := c.Restore(strings.NewReader(snapshot)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	date := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	events, err := c.EventsForDay(1, date, 0, 1)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected the 2 events from the snapshot, got %+v (%v)", events, err)
+	}
+	calendars, err := c.Calendars(2)
+	if err != nil || len(calendars) != 1 || calendars[0].Shares[2] != calendar.PermissionRead {
+		t.Errorf("expected the shared calendar to be restored, got %+v (%v)", calendars, err)
+	}
+	if wh, err := c.WorkingHours(1); err != nil || !reflect.DeepEqual(wh, defaults) {
+		t.Errorf("expected the default working hours, got %+v (%v)", wh, err)
+	}
+
+	withHours := strings.Replace(snapshot, `"calendars"`, `"working_hours":{"1":{"start":"09:00","end":"17:00"}},"calendars"`, 1)
+	if err := c.Restore(strings.NewReader(withHours)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if wh, err := c.WorkingHours(1); err != nil || !reflect.DeepEqual(wh, defaults) {
+		t.Errorf("expected the working hours of a version 1 snapshot to be ignored, got %+v (%v)", wh, err)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	ts := newTestServer("secret")
+	defer ts.Close()
+	c := NewClient(ts.URL, "secret")
+
+	start := time.Date(2024, 5, 10, 14, 30, 0, 0, time.UTC)
+	if _, err := c.CreateEvent(calendar.Event{UserID: 1, Date: start, Event: "review"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// a day alone, as older clients send it
+	params := url.Values{"user_id": {"1"}, "date": {"2024-05-10"}, "event": {"all day"}}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/create_event", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("create with a day alone: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	events, err := c.EventsForDay(1, start)
+	if err != nil {
+		t.Fatalf("day: %v", err)
+	}
+	dates := map[string]time.Time{}
+	for _, e := range events {
+		dates[e.Event] = e.Date
+	}
+	if !dates["review"].Equal(start) {
+		t.Errorf("expected review at %v, got %v", start, dates["review"])
+	}
+	if day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC); !dates["all day"].Equal(day) {
+		t.Errorf("expected all day at %v, got %v", day, dates["all day"])
+	}
+}
@@ -0,0 +1,161 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"2.12/internal/calendar"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "markdown"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatText, FormatHTML, FormatMarkdown:
+		return Format(s), nil
+	case "":
+		return FormatText, nil
+	}
+	return "", fmt.Errorf("unknown digest format: %s", s)
+}
+
+type Digest struct {
+	UserID  int       `json:"user_id"`
+	Date    time.Time `json:"date"`
+	Format  Format    `json:"format"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+}
+
+type agendaItem struct {
+	Time     string
+	Title    string
+	Duration string
+}
+
+type agenda struct {
+	UserID int
+	Date   time.Time
+	Events []agendaItem
+}
+
+type Generator struct {
+	Calendar *calendar.Calendar
+
+	text     *template.Template
+	markdown *template.Template
+	html     *htmltemplate.Template
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+func NewGenerator(cal *calendar.Calendar) (*Generator, error) {
+	text, err := template.ParseFS(templates, "templates/digest.txt.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse text template: %v", err)
+	}
+	markdown, err := template.New("digest.md.tmpl").
+		Funcs(template.FuncMap{"markdown": markdownEscaper.Replace}).
+		ParseFS(templates, "templates/digest.md.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse markdown template: %v", err)
+	}
+	html, err := htmltemplate.ParseFS(templates, "templates/digest.html.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse html template: %v", err)
+	}
+
+	return &Generator{Calendar: cal, text: text, markdown: markdown, html: html}, nil
+}
+
+// isAllDay tells whether an event is date-only. Those are stored at UTC
+// midnight of their date.
+func isAllDay(e calendar.Event) bool {
+	utc := e.Date.UTC()
+	return e.Duration == 0 && utc.Hour() == 0 && utc.Minute() == 0 && utc.Second() == 0
+}
+
+// Generate renders the agenda of the calendar day that starts at day's
+// midnight in day's location: the events timed within it and the all-day
+// events of its date.
+func (g *Generator) Generate(userId int, day time.Time, format Format) (Digest, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	// the UTC day of the date may start before or end after the local day
+	from, to := start, end
+	if date.Before(from) {
+		from = date
+	}
+	if dateEnd := date.AddDate(0, 0, 1); dateEnd.After(to) {
+		to = dateEnd
+	}
+	var events []calendar.Event
+	for _, e := range g.Calendar.GetEventForPeriod(userId, from, to.Sub(from)) {
+		if isAllDay(e) {
+			if e.Date.Equal(date) {
+				events = append(events, e)
+			}
+		} else if !e.Date.Before(start) && e.Date.Before(end) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Date.Equal(events[j].Date) {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	data := agenda{UserID: userId, Date: start}
+	for _, e := range events {
+		item := agendaItem{Title: e.Event, Time: "all day"}
+		if !isAllDay(e) {
+			item.Time = e.Date.In(day.Location()).Format("15:04")
+		}
+		if e.Duration != 0 {
+			item.Duration = e.Duration.String()
+		}
+		data.Events = append(data.Events, item)
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatText:
+		err = g.text.Execute(&buf, data)
+	case FormatMarkdown:
+		err = g.markdown.Execute(&buf, data)
+	case FormatHTML:
+		err = g.html.Execute(&buf, data)
+	default:
+		return Digest{}, fmt.Errorf("unknown digest format: %s", format)
+	}
+	if err != nil {
+		return Digest{}, fmt.Errorf("could not render digest: %v", err)
+	}
+
+	return Digest{
+		UserID:  userId,
+		Date:    start,
+		Format:  format,
+		Subject: fmt.Sprintf("Your agenda for %s: %d event(s)", start.Format("Mon, 02 Jan"), len(events)),
+		Body:    buf.String(),
+	}, nil
+}
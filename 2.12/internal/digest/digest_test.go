@@ -0,0 +1,209 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"2.12/internal/calendar"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+type fakeSender struct {
+	sent []Digest
+}
+
+func (s *fakeSender) Send(d Digest) error {
+	s.sent = append(s.sent, d)
+	return nil
+}
+
+func newTestGenerator(t *testing.T) (*Generator, *calendar.Calendar) {
+	t.Helper()
+	cal := calendar.NewCalendar()
+	g, err := NewGenerator(cal)
+	if err != nil {
+		t.Fatalf("generator: %v", err)
+	}
+	return g, cal
+}
+
+func TestGenerateFormats(t *testing.T) {
+	g, cal := newTestGenerator(t)
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: day.Add(14 * time.Hour), Duration: time.Hour, Event: "Design <review> | team"})
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: day, Event: "Release day"})
+	cal.CreateEvent(calendar.Event{UserID: 2, Date: day, Event: "someone else"})
+
+	testCases := []struct {
+		format Format
+		want   []string
+	}{
+		{FormatText, []string{"Agenda for Friday, 10 May 2024", "all day  Release day", "14:00  Design <review> | team (1h0m0s)", "2 event(s) today."}},
+		{FormatMarkdown, []string{"# Agenda for Friday, 10 May 2024", "| all day | Release day |  |", `| 14:00 | Design <review> \| team | 1h0m0s |`}},
+		{FormatHTML, []string{"<h1>Agenda for Friday, 10 May 2024</h1>", "<td>Design &lt;review&gt; | team</td>"}},
+	}
+
+	for _, tc := range testCases {
+		d, err := g.Generate(1, day, tc.format)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		if strings.Contains(d.Body, "someone else") {
+			t.Errorf("%s: digest contains events of another user", tc.format)
+		}
+		if !strings.Contains(d.Body, "Release day") || strings.Index(d.Body, "Release day") > strings.Index(d.Body, "Design") {
+			t.Errorf("%s: events are not sorted by time:\n%s", tc.format, d.Body)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(d.Body, want) {
+				t.Errorf("%s: missing %q in\n%s", tc.format, want, d.Body)
+			}
+		}
+	}
+
+	d, _ := g.Generate(3, day, FormatText)
+	if !strings.Contains(d.Body, "Nothing planned") {
+		t.Errorf("expected empty agenda, got\n%s", d.Body)
+	}
+}
+
+func TestSchedulerSendsAtLocalTime(t *testing.T) {
+	g, cal := newTestGenerator(t)
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+
+	// 04:30 UTC is 07:30 in Moscow
+	clock := &fakeClock{now: time.Date(2024, 5, 10, 4, 30, 0, 0, time.UTC)}
+	sender := &fakeSender{}
+	s := NewScheduler(g, sender)
+	s.Clock = clock
+	s.Interval = 10 * time.Minute
+
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: time.Date(2024, 5, 10, 9, 0, 0, 0, moscow), Duration: time.Hour, Event: "standup"})
+	if err := s.Subscribe(Subscription{UserID: 1, At: "08:00", Timezone: "Europe/Moscow", Format: FormatText}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := s.Subscribe(Subscription{UserID: 2, At: "25:00"}); err == nil {
+		t.Errorf("expected error for invalid time")
+	}
+
+	s.Tick()
+	if len(sender.sent) != 0 {
+		t.Fatalf("digest sent before the configured time")
+	}
+
+	for i := 0; i < 4; i++ {
+		<-clock.After(s.Interval)
+		s.Tick()
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("expected one digest after 08:00 local time, got %d", len(sender.sent))
+	}
+	if !strings.Contains(sender.sent[0].Body, "09:00  standup") {
+		t.Errorf("digest must use the local time of the user:\n%s", sender.sent[0].Body)
+	}
+
+	clock.now = clock.now.Add(12 * time.Hour)
+	s.Tick()
+	if len(sender.sent) != 1 {
+		t.Fatalf("digest sent twice on the same day")
+	}
+
+	clock.now = time.Date(2024, 5, 11, 5, 0, 0, 0, time.UTC)
+	s.Tick()
+	if len(sender.sent) != 2 || !sender.sent[1].Date.Equal(time.Date(2024, 5, 11, 0, 0, 0, 0, moscow)) {
+		t.Fatalf("expected the next day's digest, got %+v", sender.sent)
+	}
+
+	s.Unsubscribe(1)
+	clock.now = clock.now.Add(24 * time.Hour)
+	s.Tick()
+	if len(sender.sent) != 2 {
+		t.Errorf("digest sent after unsubscribe")
+	}
+}
+
+func TestGenerateAllDayEventsInLocalDay(t *testing.T) {
+	g, cal := newTestGenerator(t)
+	newYork, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC), Event: "yesterday"})
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), Event: "today"})
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC), Event: "tomorrow"})
+	// 23:00 on 10 May in New York, 12:00 on 11 May in Tokyo
+	cal.CreateEvent(calendar.Event{UserID: 1, Date: time.Date(2024, 5, 11, 3, 0, 0, 0, time.UTC), Duration: time.Hour, Event: "late call"})
+
+	testCases := []struct {
+		loc      *time.Location
+		included []string
+		excluded []string
+	}{
+		{time.UTC, []string{"today"}, []string{"yesterday", "tomorrow", "late call"}},
+		{newYork, []string{"today", "late call"}, []string{"yesterday", "tomorrow"}},
+		{tokyo, []string{"today"}, []string{"yesterday", "tomorrow", "late call"}},
+	}
+
+	for _, tc := range testCases {
+		d, err := g.Generate(1, time.Date(2024, 5, 10, 8, 0, 0, 0, tc.loc), FormatText)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.loc, err)
+		}
+		for _, name := range tc.included {
+			if !strings.Contains(d.Body, name) {
+				t.Errorf("%s: expected %q in\n%s", tc.loc, name, d.Body)
+			}
+		}
+		for _, name := range tc.excluded {
+			if strings.Contains(d.Body, name) {
+				t.Errorf("%s: unexpected %q in\n%s", tc.loc, name, d.Body)
+			}
+		}
+		if !strings.Contains(d.Body, "all day  today") {
+			t.Errorf("%s: expected today's event to be all day:\n%s", tc.loc, d.Body)
+		}
+	}
+}
+
+func TestSubscribeAfterSendTime(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	clock := &fakeClock{now: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)}
+	sender := &fakeSender{}
+	s := NewScheduler(g, sender)
+	s.Clock = clock
+
+	if err := s.Subscribe(Subscription{UserID: 1, At: "08:00"}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	s.Tick()
+	if len(sender.sent) != 0 {
+		t.Fatalf("expected no digest on the day of subscription, got %+v", sender.sent)
+	}
+
+	// changing the format does not resend
+	s.Subscribe(Subscription{UserID: 1, At: "08:00", Format: FormatMarkdown})
+	s.Tick()
+	if len(sender.sent) != 0 {
+		t.Fatalf("expected no digest after updating the subscription, got %+v", sender.sent)
+	}
+
+	clock.now = time.Date(2024, 5, 11, 8, 0, 0, 0, time.UTC)
+	s.Tick()
+	if len(sender.sent) != 1 || !sender.sent[0].Date.Equal(time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the next day's digest, got %+v", sender.sent)
+	}
+}
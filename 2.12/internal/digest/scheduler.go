@@ -0,0 +1,201 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type Sender interface {
+	Send(d Digest) error
+}
+
+type LogSender struct {
+	Logger *log.Logger
+}
+
+func (s LogSender) Send(d Digest) error {
+	logger := s.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("digest for user %d (%s): %s\n%s", d.UserID, d.Format, d.Subject, d.Body)
+	return nil
+}
+
+// Subscription asks for a digest every day at At ("HH:MM") in Timezone.
+type Subscription struct {
+	UserID   int    `json:"user_id"`
+	At       string `json:"at"`
+	Timezone string `json:"timezone,omitempty"`
+	Format   Format `json:"format"`
+}
+
+func (sub Subscription) location() (*time.Location, error) {
+	if sub.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", sub.Timezone)
+	}
+	return loc, nil
+}
+
+func (sub Subscription) sendTime(now time.Time) (time.Time, error) {
+	loc, err := sub.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, err := time.Parse("15:04", sub.At)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected HH:MM", sub.At)
+	}
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc), nil
+}
+
+type Scheduler struct {
+	Generator *Generator
+	Sender    Sender
+	Clock     Clock
+	Interval  time.Duration
+
+	subscriptions map[int]Subscription
+	lastSent      map[int]string
+	mutex         *sync.Mutex
+}
+
+func NewScheduler(g *Generator, sender Sender) *Scheduler {
+	return &Scheduler{
+		Generator:     g,
+		Sender:        sender,
+		Clock:         realClock{},
+		Interval:      time.Minute,
+		subscriptions: make(map[int]Subscription),
+		lastSent:      make(map[int]string),
+		mutex:         &sync.Mutex{},
+	}
+}
+
+// Subscribe adds or replaces the subscription of a user. A new
+// subscription made after its send time starts the next day.
+func (s *Scheduler) Subscribe(sub Subscription) error {
+	if err := s.validate(sub); err != nil {
+		return err
+	}
+	now := s.Clock.Now()
+	sendAt, _ := sub.sendTime(now)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.subscriptions[sub.UserID]; !exists && !now.Before(sendAt) {
+		s.lastSent[sub.UserID] = sendAt.Format("2006-01-02")
+	}
+	s.subscriptions[sub.UserID] = sub
+	return nil
+}
+
+func (s *Scheduler) validate(sub Subscription) error {
+	if _, err := ParseFormat(string(sub.Format)); err != nil {
+		return err
+	}
+	_, err := sub.sendTime(s.Clock.Now())
+	return err
+}
+
+func (s *Scheduler) Unsubscribe(userId int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscriptions, userId)
+	delete(s.lastSent, userId)
+}
+
+func (s *Scheduler) Subscriptions() []Subscription {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		result = append(result, sub)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result
+}
+
+// Tick sends every digest whose local send time has passed today and
+// that has not been sent yet. A failed send is retried on the next tick.
+func (s *Scheduler) Tick() error {
+	now := s.Clock.Now()
+
+	s.mutex.Lock()
+	var due []Subscription
+	for _, sub := range s.subscriptions {
+		sendAt, err := sub.sendTime(now)
+		if err != nil || now.Before(sendAt) {
+			continue
+		}
+		if s.lastSent[sub.UserID] != sendAt.Format("2006-01-02") {
+			due = append(due, sub)
+		}
+	}
+	s.mutex.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].UserID < due[j].UserID })
+
+	var errs []error
+	for _, sub := range due {
+		sendAt, _ := sub.sendTime(now)
+		format := sub.Format
+		if format == "" {
+			format = FormatText
+		}
+
+		d, err := s.Generator.Generate(sub.UserID, sendAt, format)
+		if err == nil {
+			err = s.Sender.Send(d)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for user %d: %v", sub.UserID, err))
+			continue
+		}
+
+		s.mutex.Lock()
+		s.lastSent[sub.UserID] = sendAt.Format("2006-01-02")
+		s.mutex.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		if err := s.Tick(); err != nil {
+			log.Println("digest error:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Clock.After(s.Interval):
+		}
+	}
+}
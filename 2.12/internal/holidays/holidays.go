@@ -0,0 +1,264 @@
+package holidays
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"2.12/internal/ical"
+)
+
+//go:embed data/*.json
+var bundled embed.FS
+
+const dayFormat = "2006-01-02"
+
+type Holiday struct {
+	Date time.Time `json:"date"`
+	Name string    `json:"name"`
+}
+
+// rule describes a holiday in a data file, named in the language of its
+// country: a one-off Date, a fixed Month/Day, the Week-th Weekday of a
+// Month (-1 is the last one) or an offset from Western Easter.
+type rule struct {
+	Name         string   `json:"name"`
+	Date         string   `json:"date,omitempty"`
+	Month        int      `json:"month,omitempty"`
+	Day          int      `json:"day,omitempty"`
+	Weekday      string   `json:"weekday,omitempty"`
+	Week         int      `json:"week,omitempty"`
+	EasterOffset *int     `json:"easter_offset,omitempty"`
+	Regions      []string `json:"regions,omitempty"`
+}
+
+type dataFile struct {
+	Country  string `json:"country"`
+	Holidays []rule `json:"holidays"`
+}
+
+// Set is a holiday calendar of a country or a region, e.g. "de" or "de-by".
+type Set struct {
+	Code  string
+	rules []rule
+}
+
+func (s *Set) Between(from, to time.Time) []Holiday {
+	var result []Holiday
+	for year := from.Year(); year <= to.Year(); year++ {
+		for _, h := range s.forYear(year) {
+			day := h.Date.Format(dayFormat)
+			if day >= from.Format(dayFormat) && day < to.Format(dayFormat) {
+				result = append(result, h)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Date.Before(result[j].Date) })
+	return result
+}
+
+func (s *Set) Lookup(day time.Time) (Holiday, bool) {
+	key := day.Format(dayFormat)
+	for _, h := range s.forYear(day.Year()) {
+		if h.Date.Format(dayFormat) == key {
+			return h, true
+		}
+	}
+	return Holiday{}, false
+}
+
+func (s *Set) forYear(year int) []Holiday {
+	var result []Holiday
+	for _, r := range s.rules {
+		date, ok := r.dateIn(year)
+		if ok {
+			result = append(result, Holiday{Date: date, Name: r.Name})
+		}
+	}
+	return result
+}
+
+func (r rule) dateIn(year int) (time.Time, bool) {
+	switch {
+	case r.Date != "":
+		date, err := time.Parse(dayFormat, r.Date)
+		return date, err == nil && date.Year() == year
+	case r.EasterOffset != nil:
+		return easter(year).AddDate(0, 0, *r.EasterOffset), true
+	case r.Weekday != "":
+		wd, ok := weekdays[r.Weekday]
+		if !ok {
+			return time.Time{}, false
+		}
+		return nthWeekday(year, time.Month(r.Month), wd, r.Week), true
+	case r.Month != 0 && r.Day != 0:
+		return time.Date(year, time.Month(r.Month), r.Day, 0, 0, 0, 0, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -((int(last.Weekday()) - int(wd) + 7) % 7))
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(wd) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
+
+// easter returns the Western Easter Sunday (anonymous Gregorian algorithm).
+func easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+func splitCode(code string) (string, string) {
+	country, region, _ := strings.Cut(strings.ToLower(code), "-")
+	return country, strings.ToUpper(region)
+}
+
+func parseData(code string, r io.Reader) (*Set, error) {
+	var data dataFile
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid holiday data: %v", err)
+	}
+
+	_, region := splitCode(code)
+	set := &Set{Code: strings.ToLower(code)}
+	for _, r := range data.Holidays {
+		if len(r.Regions) > 0 && !contains(r.Regions, region) {
+			continue
+		}
+		set.rules = append(set.rules, r)
+	}
+	return set, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Load returns a bundled holiday set such as "ru", "us" or "de-by".
+func Load(code string) (*Set, error) {
+	country, _ := splitCode(code)
+	f, err := bundled.Open("data/" + country + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("no bundled holidays for %q", code)
+	}
+	defer f.Close()
+	return parseData(code, f)
+}
+
+// LoadFile reads a holiday set from a JSON data file or an iCal file.
+func LoadFile(code, path string) (*Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".ics") {
+		return ParseICal(code, f)
+	}
+	return parseData(code, f)
+}
+
+// ParseICal builds a holiday set from the all-day events of an iCal feed.
+func ParseICal(code string, r io.Reader) (*Set, error) {
+	events, err := ical.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{Code: strings.ToLower(code)}
+	for _, e := range events {
+		start := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+		end := start.AddDate(0, 0, 1)
+		if e.AllDay && e.End.After(end) {
+			end = time.Date(e.End.Year(), e.End.Month(), e.End.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			set.rules = append(set.rules, rule{Name: e.Summary, Date: day.Format(dayFormat)})
+		}
+	}
+	return set, nil
+}
+
+func Available() []string {
+	entries, _ := bundled.ReadDir("data")
+	var codes []string
+	for _, e := range entries {
+		codes = append(codes, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return codes
+}
+
+// Registry caches holiday sets and resolves codes that were not registered
+// explicitly to the bundled data.
+type Registry struct {
+	sets  map[string]*Set
+	mutex *sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		sets:  make(map[string]*Set),
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (r *Registry) Add(set *Set) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sets[set.Code] = set
+}
+
+func (r *Registry) Get(code string) (*Set, error) {
+	code = strings.ToLower(code)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if set, ok := r.sets[code]; ok {
+		return set, nil
+	}
+	set, err := Load(code)
+	if err != nil {
+		return nil, err
+	}
+	r.sets[code] = set
+	return set, nil
+}
@@ -0,0 +1,82 @@
+package holidays
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestBundledSets(t *testing.T) {
+	testCases := []struct {
+		code    string
+		day     string
+		name    string
+		holiday bool
+	}{
+		{"ru", "2024-05-09", "День Победы", true},
+		{"ru", "2024-05-10", "", false},
+		{"us", "2024-11-28", "Thanksgiving Day", true},
+		{"us", "2024-05-27", "Memorial Day", true},
+		{"us", "2025-01-20", "Martin Luther King Jr. Day", true},
+		{"de", "2024-03-29", "Karfreitag", true},
+		{"de", "2025-06-09", "Pfingstmontag", true},
+		{"de", "2024-01-06", "", false},
+		{"de-by", "2024-01-06", "Heilige Drei Könige", true},
+		{"de-by", "2024-10-31", "", false},
+		{"DE-SN", "2024-10-31", "Reformationstag", true},
+	}
+
+	for _, tc := range testCases {
+		set, err := Load(tc.code)
+		if err != nil {
+			t.Fatalf("load %s: %v", tc.code, err)
+		}
+		h, ok := set.Lookup(date(tc.day))
+		if ok != tc.holiday || h.Name != tc.name {
+			t.Errorf("%s %s: got %q (%v), want %q (%v)", tc.code, tc.day, h.Name, ok, tc.name, tc.holiday)
+		}
+	}
+
+	if _, err := Load("xx"); err == nil {
+		t.Errorf("expected error for unknown country")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	set, _ := Load("ru")
+	got := set.Between(date("2024-12-30"), date("2025-01-03"))
+	if len(got) != 2 || got[0].Date != date("2025-01-01") || got[1].Date != date("2025-01-02") {
+		t.Errorf("unexpected holidays across new year: %+v", got)
+	}
+}
+
+func TestParseICal(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:a\r\nDTSTART;VALUE=DATE:20240722\r\nDTEND;VALUE=DATE:20240725\r\nSUMMARY:Summer break\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:b\r\nDTSTART;VALUE=DATE:20241224\r\nSUMMARY:Christmas Eve\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	set, err := ParseICal("office", strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for _, day := range []string{"2024-07-22", "2024-07-24", "2024-12-24"} {
+		if _, ok := set.Lookup(date(day)); !ok {
+			t.Errorf("%s must be a holiday", day)
+		}
+	}
+	if _, ok := set.Lookup(date("2024-07-25")); ok {
+		t.Errorf("DTEND is exclusive")
+	}
+
+	registry := NewRegistry()
+	registry.Add(set)
+	if got, err := registry.Get("OFFICE"); err != nil || got != set {
+		t.Errorf("registry must return the registered set, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,307 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405"
+)
+
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Encode writes events as a single VCALENDAR object.
+func Encode(w io.Writer, events []Event) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//2.12//calendar//EN",
+	}
+	stamp := time.Now().UTC().Format(dateTimeFormat) + "Z"
+	for _, e := range events {
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+escapeText(e.UID), "DTSTAMP:"+stamp)
+		if e.AllDay {
+			lines = append(lines, "DTSTART;VALUE=DATE:"+e.Start.Format(dateFormat))
+			if !e.End.IsZero() {
+				lines = append(lines, "DTEND;VALUE=DATE:"+e.End.Format(dateFormat))
+			}
+		} else {
+			lines = append(lines, "DTSTART:"+e.Start.UTC().Format(dateTimeFormat)+"Z")
+			if !e.End.IsZero() {
+				lines = append(lines, "DTEND:"+e.End.UTC().Format(dateTimeFormat)+"Z")
+			}
+		}
+		lines = append(lines, "SUMMARY:"+escapeText(e.Summary), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		bw.WriteString(fold(line))
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+// Decode reads all VEVENT components from an iCalendar stream.
+func Decode(r io.Reader) ([]Event, error) {
+	props, err := readProperties(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var duration time.Duration
+	for _, p := range props {
+		switch {
+		case p.name == "BEGIN" && p.value == "VEVENT":
+			current = &Event{}
+			duration = 0
+		case p.name == "END" && p.value == "VEVENT":
+			if current == nil {
+				return nil, fmt.Errorf("unexpected END:VEVENT")
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", current.UID)
+			}
+			if current.End.IsZero() && duration != 0 {
+				current.End = current.Start.Add(duration)
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case p.name == "UID":
+			current.UID = unescapeText(p.value)
+		case p.name == "SUMMARY":
+			current.Summary = unescapeText(p.value)
+		case p.name == "DTSTART":
+			current.Start, current.AllDay, err = parseTime(p)
+			if err != nil {
+				return nil, err
+			}
+		case p.name == "DTEND":
+			current.End, _, err = parseTime(p)
+			if err != nil {
+				return nil, err
+			}
+		case p.name == "DURATION":
+			duration, err = ParseDuration(p.value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated VEVENT")
+	}
+	return events, nil
+}
+
+func readProperties(r io.Reader) ([]property, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read calendar: %v", err)
+	}
+
+	props := make([]property, 0, len(lines))
+	for _, line := range lines {
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, p)
+	}
+	return props, nil
+}
+
+func parseProperty(line string) (property, error) {
+	p := property{params: make(map[string]string)}
+
+	// the value starts at the first colon outside of a quoted parameter
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("invalid content line: %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	p.value = line[colon+1:]
+	return p, nil
+}
+
+func parseTime(p property) (time.Time, bool, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(dateFormat) {
+		t, err := time.Parse(dateFormat, p.value)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s: %v", p.name, err)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse(dateTimeFormat, strings.TrimSuffix(p.value, "Z"))
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s: %v", p.name, err)
+		}
+		return t, false, nil
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeFormat, p.value, loc)
+	if err != nil {
+		return t, false, fmt.Errorf("invalid %s: %v", p.name, err)
+	}
+	return t.UTC(), false, nil
+}
+
+// ParseDuration parses an RFC 5545 duration such as P1D or PT1H30M.
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration: %q", orig)
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	num := 0
+	hasNum := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num = num*10 + int(r-'0')
+			hasNum = true
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+		if !hasNum {
+			return 0, fmt.Errorf("invalid duration: %q", orig)
+		}
+		switch {
+		case r == 'W' && !inTime:
+			d += time.Duration(num) * 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			d += time.Duration(num) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(num) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(num) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(num) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration: %q", orig)
+		}
+		num = 0
+		hasNum = false
+	}
+	if hasNum {
+		return 0, fmt.Errorf("invalid duration: %q", orig)
+	}
+	return sign * d, nil
+}
+
+func fold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			if r == 'n' || r == 'N' {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
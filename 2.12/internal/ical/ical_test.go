@@ -0,0 +1,178 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func calendarOf(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected Event
+	}{
+		{
+			"utc",
+			calendarOf("BEGIN:VEVENT", "UID:a", "DTSTART:20240510T090000Z", "DTEND:20240510T093000Z", "SUMMARY:Standup", "END:VEVENT"),
+			Event{UID: "a", Summary: "Standup", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC), End: time.Date(2024, 5, 10, 9, 30, 0, 0, time.UTC)},
+		},
+		{
+			"folded and escaped",
+			calendarOf("BEGIN:VEVENT", "UID:b", "DTSTART:20240510T090000Z", "SUMMARY:Lunch\\, then a long", " \\;walk\\nback\\\\home", "END:VEVENT"),
+			Event{UID: "b", Summary: "Lunch, then a long;walk\nback\\home", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			"folded with a tab",
+			calendarOf("BEGIN:VEVENT", "UID:c", "DTSTART:20240510T09", "\t0000Z", "END:VEVENT"),
+			Event{UID: "c", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			"tzid",
+			calendarOf("BEGIN:VEVENT", "UID:d", "DTSTART;TZID=Europe/Moscow:20240510T120000", "DTEND;TZID=Europe/Moscow:20240510T130000", "END:VEVENT"),
+			Event{UID: "d", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC), End: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			"quoted unknown tzid",
+			calendarOf("BEGIN:VEVENT", "UID:e", `DTSTART;TZID="Custom: zone":20240510T120000`, "END:VEVENT"),
+			Event{UID: "e", Start: time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			"floating",
+			calendarOf("BEGIN:VEVENT", "UID:f", "DTSTART:20240510T120000", "END:VEVENT"),
+			Event{UID: "f", Start: time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			"all day",
+			calendarOf("BEGIN:VEVENT", "UID:g", "DTSTART;VALUE=DATE:20240601", "DTEND;VALUE=DATE:20240603", "END:VEVENT"),
+			Event{UID: "g", Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), AllDay: true},
+		},
+		{
+			"all day without value",
+			calendarOf("BEGIN:VEVENT", "UID:h", "DTSTART:20240601", "END:VEVENT"),
+			Event{UID: "h", Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), AllDay: true},
+		},
+		{
+			"duration",
+			calendarOf("BEGIN:VEVENT", "UID:i", "DTSTART:20240510T090000Z", "DURATION:PT1H30M", "END:VEVENT"),
+			Event{UID: "i", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC), End: time.Date(2024, 5, 10, 10, 30, 0, 0, time.UTC)},
+		},
+		{
+			"lower case names and other components",
+			calendarOf("BEGIN:VTIMEZONE", "TZID:X", "END:VTIMEZONE", "BEGIN:VEVENT", "uid:j", "dtstart:20240510T090000Z", "END:VEVENT"),
+			Event{UID: "j", Start: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range testCases {
+		events, err := Decode(strings.NewReader(tc.input))
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.name, err)
+			continue
+		}
+		if len(events) != 1 {
+			t.Errorf("expected 1 event for %s, got %+v", tc.name, events)
+			continue
+		}
+		e := events[0]
+		if e.UID != tc.expected.UID || e.Summary != tc.expected.Summary || !e.Start.Equal(tc.expected.Start) ||
+			!e.End.Equal(tc.expected.End) || e.AllDay != tc.expected.AllDay {
+			t.Errorf("expected %+v, got %+v for %s", tc.expected, e, tc.name)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	testCases := []string{
+		calendarOf("BEGIN:VEVENT", "UID:a", "END:VEVENT"),
+		calendarOf("BEGIN:VEVENT", "UID:a", "DTSTART:20240510T090000Z"),
+		calendarOf("END:VEVENT"),
+		calendarOf("BEGIN:VEVENT", "no colon here", "END:VEVENT"),
+		calendarOf("BEGIN:VEVENT", "DTSTART:2024-05-10", "END:VEVENT"),
+		calendarOf("BEGIN:VEVENT", "DTSTART;VALUE=DATE:2024061", "END:VEVENT"),
+		calendarOf("BEGIN:VEVENT", "DTSTART:20240510T090000Z", "DURATION:1H", "END:VEVENT"),
+	}
+
+	for _, input := range testCases {
+		if events, err := Decode(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error, got %+v for\n%s", events, input)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+		hasError bool
+	}{
+		{"P1D", 24 * time.Hour, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"P1DT2H3M4S", 26*time.Hour + 3*time.Minute + 4*time.Second, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"+PT15M", 15 * time.Minute, false},
+		{"PT1D", 0, true},
+		{"P1H", 0, true},
+		{"P1", 0, true},
+		{"PTM", 0, true},
+		{"1D", 0, true},
+	}
+
+	for _, tc := range testCases {
+		d, err := ParseDuration(tc.input)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for %q, but got none", tc.input)
+			}
+			continue
+		}
+		if err != nil || d != tc.expected {
+			t.Errorf("expected %v, got %v (%v) for %q", tc.expected, d, err, tc.input)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	events := []Event{
+		{
+			UID:     "long-1",
+			Summary: strings.Repeat("Планёрка, отдел; ", 8) + "\nend\\",
+			Start:   time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC),
+			End:     time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC),
+		},
+		{UID: "day-1", Summary: "Holiday", Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), AllDay: true},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, events); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("expected %d events, got %+v", len(events), decoded)
+	}
+	for i, e := range decoded {
+		want := events[i]
+		if e.UID != want.UID || e.Summary != want.Summary || !e.Start.Equal(want.Start) || !e.End.Equal(want.End) || e.AllDay != want.AllDay {
+			t.Errorf("expected %+v, got %+v", want, e)
+		}
+	}
+}
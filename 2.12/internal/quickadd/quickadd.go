@@ -0,0 +1,465 @@
+package quickadd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+)
+
+type Recurrence struct {
+	Frequency Frequency
+}
+
+// Result is an event extracted from a free-form phrase. AllDay is set
+// when the phrase has no time of day.
+type Result struct {
+	Title      string
+	Start      time.Time
+	AllDay     bool
+	Duration   time.Duration
+	Recurrence *Recurrence
+}
+
+// Occurrences returns the start of the first n occurrences of the event. A
+// monthly event on a day some months lack falls on their last day.
+func (r Result) Occurrences(n int) []time.Time {
+	if r.Recurrence == nil || n < 1 {
+		return []time.Time{r.Start}
+	}
+	result := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		switch r.Recurrence.Frequency {
+		case Daily:
+			result = append(result, r.Start.AddDate(0, 0, i))
+		case Weekly:
+			result = append(result, r.Start.AddDate(0, 0, 7*i))
+		case Monthly:
+			result = append(result, addMonths(r.Start, i))
+		}
+	}
+	return result
+}
+
+// addMonths moves t by n months, to the last day of the month when it
+// has fewer days than the day of t.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(t.Day(), lastDay), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// weekdays lists the whole words naming each day, with the Russian forms
+// used after "в", "каждый" and "следующий".
+var weekdays = []struct {
+	word string
+	day  time.Weekday
+}{
+	{"monday", time.Monday}, {"mon", time.Monday}, {"понедельник", time.Monday}, {"понедельника", time.Monday},
+	{"tuesday", time.Tuesday}, {"tue", time.Tuesday}, {"вторник", time.Tuesday}, {"вторника", time.Tuesday},
+	{"wednesday", time.Wednesday}, {"wed", time.Wednesday}, {"среда", time.Wednesday}, {"среду", time.Wednesday}, {"среды", time.Wednesday},
+	{"thursday", time.Thursday}, {"thu", time.Thursday}, {"четверг", time.Thursday}, {"четверга", time.Thursday},
+	{"friday", time.Friday}, {"fri", time.Friday}, {"пятница", time.Friday}, {"пятницу", time.Friday}, {"пятницы", time.Friday},
+	{"saturday", time.Saturday}, {"sat", time.Saturday}, {"суббота", time.Saturday}, {"субботу", time.Saturday}, {"субботы", time.Saturday},
+	{"sunday", time.Sunday}, {"sun", time.Sunday}, {"воскресенье", time.Sunday}, {"воскресенья", time.Sunday},
+}
+
+func parseWeekday(word string) (time.Weekday, bool) {
+	for _, w := range weekdays {
+		if word == w.word {
+			return w.day, true
+		}
+	}
+	return 0, false
+}
+
+var (
+	clockRe    = regexp.MustCompile(`^(\d{1,2})(?:([:.])(\d{2}))?(am|pm)?$`)
+	compactRe  = regexp.MustCompile(`^(?:(\d+)(?:h|ч))?(?:(\d+)(?:m|min|м|мин))?$`)
+	isoDateRe  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	dotDateRe  = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{4}))?$`)
+	numberRe   = regexp.MustCompile(`^\d+$`)
+	trimSuffix = ",.!?;"
+)
+
+type parser struct {
+	words []string
+	lower []string
+	used  []bool
+	now   time.Time
+
+	date     *time.Time
+	weekday  *time.Weekday
+	clock    *time.Duration
+	duration time.Duration
+	recur    *Recurrence
+}
+
+// Parse extracts the event title, start, duration and recurrence from text
+// written in English or Russian. Relative dates are resolved against now.
+func Parse(text string, now time.Time) (Result, error) {
+	p := &parser{words: strings.Fields(text), now: now}
+	for _, w := range p.words {
+		p.lower = append(p.lower, strings.Trim(strings.ToLower(w), trimSuffix))
+	}
+	p.used = make([]bool, len(p.words))
+
+	for i := 0; i < len(p.words); i++ {
+		if p.used[i] {
+			continue
+		}
+		for _, match := range []func(int) int{p.matchRecurrence, p.matchDate, p.matchDuration, p.matchTime} {
+			if n := match(i); n > 0 {
+				for j := i; j < i+n; j++ {
+					p.used[j] = true
+				}
+				i += n - 1
+				break
+			}
+		}
+	}
+
+	var title []string
+	for i, w := range p.words {
+		if !p.used[i] {
+			title = append(title, w)
+		}
+	}
+	if len(title) == 0 {
+		return Result{}, fmt.Errorf("no event title in %q", text)
+	}
+
+	res := Result{
+		Title:      strings.Trim(strings.Join(title, " "), trimSuffix),
+		Duration:   p.duration,
+		Recurrence: p.recur,
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch {
+	case p.date != nil:
+		day = *p.date
+	case p.weekday != nil:
+		day = nextWeekday(day, *p.weekday, false)
+	}
+
+	if p.clock != nil {
+		// the wall clock time of the day, which is not the time elapsed
+		// since midnight on the days the clocks change
+		hour, minute := int(*p.clock/time.Hour), int(*p.clock%time.Hour/time.Minute)
+		res.Start = time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	} else {
+		// date-only events are stored at UTC midnight of their date
+		res.Start = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		res.AllDay = true
+	}
+	return res, nil
+}
+
+func (p *parser) word(i int) string {
+	if i < len(p.lower) && !p.used[i] {
+		return p.lower[i]
+	}
+	return ""
+}
+
+func nextWeekday(day time.Time, wd time.Weekday, strict bool) time.Time {
+	diff := (int(wd) - int(day.Weekday()) + 7) % 7
+	if diff == 0 && strict {
+		diff = 7
+	}
+	return day.AddDate(0, 0, diff)
+}
+
+func (p *parser) today() time.Time {
+	return time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+}
+
+func (p *parser) setDate(t time.Time) {
+	p.date = &t
+}
+
+func (p *parser) matchDate(i int) int {
+	if p.date != nil {
+		return 0
+	}
+	w := p.word(i)
+	today := p.today()
+
+	switch w {
+	case "today", "сегодня":
+		p.setDate(today)
+		return 1
+	case "tomorrow", "завтра":
+		p.setDate(today.AddDate(0, 0, 1))
+		return 1
+	case "послезавтра":
+		p.setDate(today.AddDate(0, 0, 2))
+		return 1
+	case "day":
+		if p.word(i+1) == "after" && p.word(i+2) == "tomorrow" {
+			p.setDate(today.AddDate(0, 0, 2))
+			return 3
+		}
+	case "on", "в", "во":
+		// "в 10.05" is a time, left to matchTime
+		if m := dotDateRe.FindStringSubmatch(p.word(i + 1)); w != "on" && m != nil && m[3] == "" {
+			return 0
+		}
+		if n := p.matchWeekday(i + 1); n > 0 {
+			return n + 1
+		}
+		if n := p.matchDate(i + 1); n > 0 {
+			return n + 1
+		}
+		return 0
+	case "next", "следующий", "следующую", "следующее", "следующей":
+		if wd, ok := parseWeekday(p.word(i + 1)); ok {
+			p.setDate(nextWeekday(today, wd, true))
+			return 2
+		}
+		switch p.word(i + 1) {
+		case "week", "неделе", "неделю":
+			p.setDate(today.AddDate(0, 0, 7))
+			return 2
+		case "month", "месяц", "месяце":
+			p.setDate(today.AddDate(0, 1, 0))
+			return 2
+		}
+	case "in", "через":
+		if n := p.matchOffset(i + 1); n > 0 {
+			return n + 1
+		}
+	}
+
+	if n := p.matchWeekday(i); n > 0 {
+		return n
+	}
+
+	if m := isoDateRe.FindStringSubmatch(w); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		p.setDate(time.Date(year, time.Month(month), d, 0, 0, 0, 0, p.now.Location()))
+		return 1
+	}
+	if m := dotDateRe.FindStringSubmatch(w); m != nil {
+		d, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 || d < 1 || d > 31 {
+			return 0
+		}
+		year := today.Year()
+		if m[3] != "" {
+			year, _ = strconv.Atoi(m[3])
+		}
+		date := time.Date(year, time.Month(month), d, 0, 0, 0, 0, p.now.Location())
+		if m[3] == "" && date.Before(today) {
+			date = date.AddDate(1, 0, 0)
+		}
+		p.setDate(date)
+		return 1
+	}
+	return 0
+}
+
+func (p *parser) matchWeekday(i int) int {
+	if p.date != nil || p.weekday != nil {
+		return 0
+	}
+	wd, ok := parseWeekday(p.word(i))
+	if !ok {
+		return 0
+	}
+	p.weekday = &wd
+	return 1
+}
+
+// matchOffset handles "3 days", "a week", "2 недели", "неделю".
+func (p *parser) matchOffset(i int) int {
+	n, consumed := 1, 0
+	switch w := p.word(i); {
+	case numberRe.MatchString(w):
+		n, _ = strconv.Atoi(w)
+		consumed = 1
+	case w == "a" || w == "an" || w == "one":
+		consumed = 1
+	}
+
+	today := p.today()
+	switch unit := p.word(i + consumed); {
+	case unit == "day" || unit == "days" || strings.HasPrefix(unit, "дн") || unit == "день":
+		p.setDate(today.AddDate(0, 0, n))
+	case unit == "week" || unit == "weeks" || strings.HasPrefix(unit, "недел"):
+		p.setDate(today.AddDate(0, 0, 7*n))
+	case unit == "month" || unit == "months" || strings.HasPrefix(unit, "месяц"):
+		p.setDate(today.AddDate(0, n, 0))
+	default:
+		return 0
+	}
+	return consumed + 1
+}
+
+func (p *parser) matchTime(i int) int {
+	if p.clock != nil {
+		return 0
+	}
+	w := p.word(i)
+	switch w {
+	case "at", "в", "во":
+		if n := p.matchTime(i + 1); n > 0 {
+			return n + 1
+		}
+		return 0
+	case "noon", "полдень":
+		p.setClock(12, 0)
+		return 1
+	case "midnight", "полночь":
+		p.setClock(0, 0)
+		return 1
+	}
+
+	m := clockRe.FindStringSubmatch(w)
+	if m == nil {
+		return 0
+	}
+	// a bare number is a time only when written as "at 9" or with am/pm,
+	// and "10.05" only when written as "в 10.05"
+	if m[2] == "" && m[4] == "" || m[2] == "." {
+		prev := ""
+		if i > 0 {
+			prev = p.lower[i-1]
+		}
+		if prev != "at" && prev != "в" && prev != "во" {
+			return 0
+		}
+	}
+
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[3] != "" {
+		minute, _ = strconv.Atoi(m[3])
+	}
+	switch m[4] {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0
+	}
+
+	consumed := 1
+	if m[4] == "" {
+		switch p.word(i + 1) {
+		case "am":
+			if hour == 12 {
+				hour = 0
+			}
+			consumed = 2
+		case "pm":
+			if hour < 12 {
+				hour += 12
+			}
+			consumed = 2
+		}
+	}
+	p.setClock(hour, minute)
+	return consumed
+}
+
+func (p *parser) setClock(hour, minute int) {
+	d := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	p.clock = &d
+}
+
+func (p *parser) matchDuration(i int) int {
+	if p.duration != 0 {
+		return 0
+	}
+	w := p.word(i)
+	if w != "for" && w != "на" {
+		return 0
+	}
+
+	next := p.word(i + 1)
+	if m := compactRe.FindStringSubmatch(next); m != nil && next != "" {
+		hours, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		p.duration = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+		return 2
+	}
+
+	n, consumed := 1, 1
+	switch {
+	case numberRe.MatchString(next):
+		n, _ = strconv.Atoi(next)
+		consumed = 2
+	case next == "a" || next == "an" || next == "one":
+		consumed = 2
+	}
+
+	switch unit := p.word(i + consumed); {
+	case unit == "hour" || unit == "hours" || unit == "h" || strings.HasPrefix(unit, "час"):
+		p.duration = time.Duration(n) * time.Hour
+	case unit == "minute" || unit == "minutes" || unit == "min" || unit == "mins" || strings.HasPrefix(unit, "минут"):
+		p.duration = time.Duration(n) * time.Minute
+	default:
+		return 0
+	}
+	return consumed + 1
+}
+
+func (p *parser) matchRecurrence(i int) int {
+	if p.recur != nil {
+		return 0
+	}
+	w := p.word(i)
+
+	switch w {
+	case "daily", "ежедневно":
+		p.recur = &Recurrence{Frequency: Daily}
+		return 1
+	case "weekly", "еженедельно":
+		p.recur = &Recurrence{Frequency: Weekly}
+		return 1
+	case "monthly", "ежемесячно":
+		p.recur = &Recurrence{Frequency: Monthly}
+		return 1
+	case "every", "each", "каждый", "каждую", "каждое", "каждая":
+	default:
+		return 0
+	}
+
+	next := p.word(i + 1)
+	switch {
+	case next == "day" || next == "день":
+		p.recur = &Recurrence{Frequency: Daily}
+	case next == "week" || next == "неделю":
+		p.recur = &Recurrence{Frequency: Weekly}
+	case next == "month" || next == "месяц":
+		p.recur = &Recurrence{Frequency: Monthly}
+	default:
+		wd, ok := parseWeekday(next)
+		if !ok || p.date != nil {
+			return 0
+		}
+		p.weekday = &wd
+		p.recur = &Recurrence{Frequency: Weekly}
+	}
+	return 2
+}
@@ -0,0 +1,136 @@
+package quickadd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	day := func(d int, hour, minute int) time.Time {
+		return time.Date(2024, 5, d, hour, minute, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		input    string
+		title    string
+		start    time.Time
+		allDay   bool
+		duration time.Duration
+		recur    Frequency
+	}{
+		{"lunch with Anna tomorrow 13:00 for 1h", "lunch with Anna", day(16, 13, 0), false, time.Hour, ""},
+		{"dentist today at 9am", "dentist", day(15, 9, 0), false, 0, ""},
+		{"release next Friday", "release", day(17, 0, 0), true, 0, ""},
+		{"sync next wednesday", "sync", day(22, 0, 0), true, 0, ""},
+		{"demo wednesday at 4pm for 30 minutes", "demo", day(15, 16, 0), false, 30 * time.Minute, ""},
+		{"call mom in 3 days", "call mom", day(18, 0, 0), true, 0, ""},
+		{"retro in a week at 11:00 for 1h30m", "retro", day(22, 11, 0), false, 90 * time.Minute, ""},
+		{"standup every day at 10:00 for 15m", "standup", day(15, 10, 0), false, 15 * time.Minute, Daily},
+		{"gym every monday 19:00", "gym", day(20, 19, 0), false, 0, Weekly},
+		{"report 2024-06-01", "report", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), true, 0, ""},
+		{"обед с Анной завтра в 13:00 на 1ч", "обед с Анной", day(16, 13, 0), false, time.Hour, ""},
+		{"созвон в следующую пятницу в 15:30 на 30 минут", "созвон", day(17, 15, 30), false, 30 * time.Minute, ""},
+		{"отчёт через 2 недели", "отчёт", day(29, 0, 0), true, 0, ""},
+		{"планёрка каждый понедельник в 9:00", "планёрка", day(20, 9, 0), false, 0, Weekly},
+		{"зарядка ежедневно в 7:00 на 20 минут", "зарядка", day(15, 7, 0), false, 20 * time.Minute, Daily},
+		{"встреча на работе послезавтра", "встреча на работе", day(17, 0, 0), true, 0, ""},
+		{"день рождения 20.05", "день рождения", day(20, 0, 0), true, 0, ""},
+		{"созвон в 10.05", "созвон", day(15, 10, 5), false, 0, ""},
+		{"созвон 10.06 в 10.05", "созвон", time.Date(2024, 6, 10, 10, 5, 0, 0, time.UTC), false, 0, ""},
+		{"ужин в пятницу", "ужин", day(17, 0, 0), true, 0, ""},
+		{"разбор среди недели", "разбор среди недели", day(15, 0, 0), true, 0, ""},
+		{"встреча в среду среди коллег", "встреча среди коллег", day(15, 0, 0), true, 0, ""},
+		{"monitor sunset", "monitor sunset", day(15, 0, 0), true, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		res, err := Parse(tc.input, now)
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+		if res.Title != tc.title || !res.Start.Equal(tc.start) || res.AllDay != tc.allDay || res.Duration != tc.duration {
+			t.Errorf("input %q: got %q %s allDay=%v %s, want %q %s allDay=%v %s",
+				tc.input, res.Title, res.Start, res.AllDay, res.Duration, tc.title, tc.start, tc.allDay, tc.duration)
+		}
+		var recur Frequency
+		if res.Recurrence != nil {
+			recur = res.Recurrence.Frequency
+		}
+		if recur != tc.recur {
+			t.Errorf("input %q: got recurrence %q, want %q", tc.input, recur, tc.recur)
+		}
+	}
+}
+
+func TestParseAllDayInTimezone(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	testCases := []struct {
+		input string
+		now   time.Time
+		start time.Time
+	}{
+		// 21:00 on 15 May in New York is already 16 May in UTC
+		{"report today", time.Date(2024, 5, 15, 21, 0, 0, 0, newYork), time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{"report tomorrow", time.Date(2024, 5, 15, 21, 0, 0, 0, newYork), time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"report 2024-06-01", time.Date(2024, 5, 15, 21, 0, 0, 0, newYork), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		// 07:00 on 16 May in Tokyo is still 15 May in UTC
+		{"отчёт в пятницу", time.Date(2024, 5, 16, 7, 0, 0, 0, tokyo), time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"отчёт 20.05", time.Date(2024, 5, 16, 7, 0, 0, 0, tokyo), time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{"call tomorrow at 9am", time.Date(2024, 5, 15, 21, 0, 0, 0, newYork), time.Date(2024, 5, 16, 9, 0, 0, 0, newYork)},
+		// the clocks go forward on 10 March and back on 3 November
+		{"call tomorrow at 9am", time.Date(2024, 3, 9, 12, 0, 0, 0, newYork), time.Date(2024, 3, 10, 9, 0, 0, 0, newYork)},
+		{"call tomorrow at 18:30", time.Date(2024, 11, 2, 12, 0, 0, 0, newYork), time.Date(2024, 11, 3, 18, 30, 0, 0, newYork)},
+	}
+
+	for _, tc := range testCases {
+		res, err := Parse(tc.input, tc.now)
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+		if !res.Start.Equal(tc.start) {
+			t.Errorf("input %q: got %s, want %s", tc.input, res.Start, tc.start)
+		}
+		if res.AllDay && res.Start.Location() != time.UTC {
+			t.Errorf("input %q: expected an all-day start in UTC, got %s", tc.input, res.Start)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"", "tomorrow at 10:00", "завтра в 13:00 на 1ч"} {
+		if _, err := Parse(input, time.Now()); err == nil {
+			t.Errorf("expected error for input %q", input)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	res := Result{Start: start, Recurrence: &Recurrence{Frequency: Weekly}}
+	got := res.Occurrences(3)
+	if len(got) != 3 || !got[2].Equal(start.AddDate(0, 0, 14)) {
+		t.Errorf("unexpected weekly occurrences: %v", got)
+	}
+	if got := (Result{Start: start}).Occurrences(5); len(got) != 1 {
+		t.Errorf("single event must have one occurrence, got %v", got)
+	}
+
+	// the 31st falls on the last day of shorter months
+	res = Result{Start: start, Recurrence: &Recurrence{Frequency: Monthly}}
+	expected := []time.Time{
+		start,
+		time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC),
+	}
+	if got := res.Occurrences(4); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected monthly occurrences %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"2.12/internal/calendar"
+)
+
+const maxSnapshotSize = 256 << 20
+
+func (s *Server) SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	snap := s.Calendar.Snapshot()
+	filename := fmt.Sprintf("calendar-%s.json", snap.CreatedAt.Format("20060102T150405Z"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	writeJson(w, http.StatusOK, snap)
+}
+
+func (s *Server) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var snap calendar.Snapshot
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnapshotSize))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&snap)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid snapshot: %v", err)})
+		return
+	}
+
+	err = s.Calendar.Restore(snap)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"result":     fmt.Sprintf("restored %d events from snapshot of %s", len(snap.Events), snap.CreatedAt.Format(time.RFC3339)),
+		"events":     len(snap.Events),
+		"calendars":  len(snap.Calendars),
+		"created_at": snap.CreatedAt,
+	})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"2.12/internal/calendar"
+)
+
+func (s *Server) CreateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "empty field name"})
+		return
+	}
+
+	calendarId := s.Calendar.CreateCalendar(userId, name)
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": "calendar created", "id": calendarId})
+}
+
+func (s *Server) ShareCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	calendarId, err := strconv.Atoi(r.FormValue("calendar_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid calendar_id"})
+		return
+	}
+
+	shareWith, err := strconv.Atoi(r.FormValue("share_with"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid share_with"})
+		return
+	}
+
+	perm, err := calendar.ParsePermission(r.FormValue("permission"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.Calendar.ShareCalendar(calendarId, userId, shareWith, perm)
+	if err != nil {
+		writeJson(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]string{"result": "calendar shared"})
+}
+
+func (s *Server) CalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	calendars := s.Calendar.GetCalendars(userId)
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": calendars})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"2.12/internal/digest"
+)
+
+func (s *Server) DigestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if s.Digests == nil {
+		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": "digests are disabled"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	loc := time.UTC
+	if tz := r.FormValue("tz"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid tz"})
+			return
+		}
+	}
+
+	day := time.Now().In(loc)
+	if dateStr := r.FormValue("date"); dateStr != "" {
+		day, err = time.ParseInLocation("2006-01-02", dateStr, loc)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid date"})
+			return
+		}
+	}
+
+	format, err := digest.ParseFormat(r.FormValue("format"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	d, err := s.Digests.Generator.Generate(userId, day, format)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": d})
+}
+
+func (s *Server) DigestSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if s.Digests == nil {
+		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": "digests are disabled"})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	if r.FormValue("enabled") == "false" {
+		s.Digests.Unsubscribe(userId)
+		writeJson(w, http.StatusOK, map[string]string{"result": "digest disabled"})
+		return
+	}
+
+	format, err := digest.ParseFormat(r.FormValue("format"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	sub := digest.Subscription{
+		UserID:   userId,
+		At:       r.FormValue("at"),
+		Timezone: r.FormValue("tz"),
+		Format:   format,
+	}
+	err = s.Digests.Subscribe(sub)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": sub})
+}
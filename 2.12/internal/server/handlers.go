@@ -2,16 +2,26 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"2.12/internal/calendar"
+	"2.12/internal/digest"
+	"2.12/internal/holidays"
 )
 
 type Server struct {
-	Calendar *calendar.Calendar
+	Calendar   *calendar.Calendar
+	AdminToken string
+
+	Holidays       *holidays.Registry
+	HolidayCountry string
+
+	Digests *digest.Scheduler
 }
 
 func writeJson(w http.ResponseWriter, status int, data interface{}) {
@@ -20,7 +30,18 @@ func writeJson(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func parseEventParams(r *http.Request) (calendar.Event, error) {
+// parseEventDate reads the date of an event in RFC 3339, or a day alone as
+// sent by older clients.
+func parseEventDate(s string) (time.Time, error) {
+	if len(s) == len("2006-01-02") {
+		return time.Parse("2006-01-02", s)
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseEventParams reads an event from the form. Without dateRequired the
+// date may be left out, which leaves it zero.
+func parseEventParams(r *http.Request, dateRequired bool) (calendar.Event, error) {
 	var event calendar.Event
 	err := r.ParseForm()
 	if err != nil {
@@ -32,10 +53,12 @@ func parseEventParams(r *http.Request) (calendar.Event, error) {
 		return event, fmt.Errorf("invalid user_id: %v", err)
 	}
 
-	dateStr := r.FormValue("date")
-	date, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		return event, fmt.Errorf("invalid date: %v", err)
+	var date time.Time
+	if dateStr := r.FormValue("date"); dateStr != "" || dateRequired {
+		date, err = parseEventDate(dateStr)
+		if err != nil {
+			return event, fmt.Errorf("invalid date: %v", err)
+		}
 	}
 
 	eventText := r.FormValue("event")
@@ -43,37 +66,88 @@ func parseEventParams(r *http.Request) (calendar.Event, error) {
 		return event, fmt.Errorf("empty filed event")
 	}
 
+	calendarId := 0
+	if calendarIdStr := r.FormValue("calendar_id"); calendarIdStr != "" {
+		calendarId, err = strconv.Atoi(calendarIdStr)
+		if err != nil {
+			return event, fmt.Errorf("invalid calendar_id: %v", err)
+		}
+	}
+
+	var duration time.Duration
+	if durationStr := r.FormValue("duration"); durationStr != "" {
+		duration, err = time.ParseDuration(durationStr)
+		if err != nil {
+			return event, fmt.Errorf("invalid duration: %v", err)
+		}
+	}
+
 	event = calendar.Event{
-		UserID: userId,
-		Date:   date,
-		Event:  eventText,
+		UserID:     userId,
+		CalendarID: calendarId,
+		Date:       date,
+		Duration:   duration,
+		Event:      eventText,
 	}
 	return event, nil
 }
 
+// eventErrorStatus is the status for an error of UpdateEventAs or
+// DeleteEventAs: 503 for a missing event, as for any failed change, and
+// 403 for a refused permission.
+func eventErrorStatus(err error) int {
+	var notFound *calendar.NotFoundError
+	if errors.As(err, &notFound) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusForbidden
+}
+
+func parseCalendarIds(s string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar_ids: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func (s *Server) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
 	}
 
-	event, err := parseEventParams(r)
+	event, err := parseEventParams(r, true)
 	if err != nil {
 		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.Calendar.CheckPermission(event.UserID, event.CalendarID, calendar.PermissionWrite)
+	if err != nil {
+		writeJson(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
 	}
 
 	eventId := s.Calendar.CreateEvent(event)
 
-	writeJson(w, http.StatusOK, map[string]string{"result": fmt.Sprintf("event cteated with ID: %d", eventId)})
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": fmt.Sprintf("event cteated with ID: %d", eventId), "id": eventId})
 }
 
 func (s *Server) UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
 	}
 
-	event, err := parseEventParams(r)
+	event, err := parseEventParams(r, false)
 	if err != nil {
 		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
 	}
 
 	idStr := r.FormValue("id")
@@ -84,9 +158,12 @@ func (s *Server) UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	event.ID = id
 
-	err = s.Calendar.UpdateEvent(event)
+	// user_id is the user making the change; the event keeps its owner,
+	// and its date when the form has none
+	err = s.Calendar.UpdateEventAs(event.UserID, event)
 	if err != nil {
-		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		writeJson(w, eventErrorStatus(err), map[string]string{"error": err.Error()})
+		return
 	}
 
 	writeJson(w, http.StatusOK, map[string]string{"result": "event updated"})
@@ -95,11 +172,19 @@ func (s *Server) UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
 	}
 
 	err := r.ParseForm()
 	if err != nil {
 		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
 	}
 
 	idStr := r.FormValue("id")
@@ -109,9 +194,9 @@ func (s *Server) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.Calendar.DeleteEvent(id)
+	err = s.Calendar.DeleteEventAs(userId, id)
 	if err != nil {
-		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		writeJson(w, eventErrorStatus(err), map[string]string{"error": err.Error()})
 		return
 	}
 
@@ -121,11 +206,13 @@ func (s *Server) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) EventsForPeriodHandler(w http.ResponseWriter, r *http.Request, duration time.Duration) {
 	if r.Method != http.MethodGet {
 		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
 	}
 
 	err := r.ParseForm()
 	if err != nil {
 		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
 	}
 
 	userIDStr := r.FormValue("user_id")
@@ -142,8 +229,38 @@ func (s *Server) EventsForPeriodHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	events := s.Calendar.GetEventForPeriod(userID, date, duration)
-	writeJson(w, http.StatusOK, map[string]interface{}{"result": events})
+	var events []calendar.Event
+	calendarIdsStr := r.FormValue("calendar_ids")
+	if calendarIdsStr == "" {
+		events = s.Calendar.GetEventForPeriod(userID, date, duration)
+	} else {
+		calendarIds, err := parseCalendarIds(calendarIdsStr)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		events, err = s.Calendar.GetEventForCalendars(userID, calendarIds, date, duration)
+		if err != nil {
+			writeJson(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	result := map[string]interface{}{"result": events}
+	if code := r.FormValue("holidays"); code != "" {
+		set, err := s.holidaySet(code)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		offDays := set.Between(date, date.Add(duration))
+		if offDays == nil {
+			offDays = []holidays.Holiday{}
+		}
+		result["holidays"] = offDays
+	}
+	writeJson(w, http.StatusOK, result)
 }
 
 func (s *Server) EventsForDayHandler(w http.ResponseWriter, r *http.Request) {
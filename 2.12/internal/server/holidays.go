@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/holidays"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// holidaySet resolves a holiday set by code, falling back to the server's
+// default country. It returns nil when no holidays are configured.
+func (s *Server) holidaySet(code string) (*holidays.Set, error) {
+	if code == "" {
+		code = s.HolidayCountry
+	}
+	if code == "" {
+		return nil, nil
+	}
+	if s.Holidays == nil {
+		return holidays.Load(code)
+	}
+	return s.Holidays.Get(code)
+}
+
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) > 3 {
+			part = part[:3]
+		}
+		if wd, ok := weekdayNames[part]; ok {
+			days = append(days, wd)
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 6 {
+			return nil, fmt.Errorf("invalid weekday %q", part)
+		}
+		days = append(days, time.Weekday(n))
+	}
+	return days, nil
+}
+
+func (s *Server) WorkdaysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", r.FormValue("from"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+		return
+	}
+	to, err := time.Parse("2006-01-02", r.FormValue("to"))
+	if err != nil || to.Before(from) {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+		return
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "period is longer than a year"})
+		return
+	}
+
+	wh := calendar.DefaultWorkingHours
+	if userIdStr := r.FormValue("user_id"); userIdStr != "" {
+		userId, err := strconv.Atoi(userIdStr)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+			return
+		}
+		wh = s.Calendar.GetWorkingHours(userId)
+	}
+
+	set, err := s.holidaySet(r.FormValue("country"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	end := to.AddDate(0, 0, 1)
+	var offDays []holidays.Holiday
+	if set != nil {
+		offDays = set.Between(from, end)
+	}
+	off := make(map[string]bool)
+	for _, h := range offDays {
+		off[h.Date.Format("2006-01-02")] = true
+	}
+
+	workdays := []string{}
+	for day := from; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if wh.IsWorkday(day) && !off[day.Format("2006-01-02")] {
+			workdays = append(workdays, day.Format("2006-01-02"))
+		}
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": workdays, "holidays": offDays})
+}
+
+func (s *Server) WorkingHoursHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeJson(w, http.StatusOK, map[string]interface{}{"result": s.Calendar.GetWorkingHours(userId)})
+		return
+	}
+
+	wh := calendar.WorkingHours{
+		Start:    r.FormValue("start"),
+		End:      r.FormValue("end"),
+		Days:     calendar.DefaultWorkingHours.Days,
+		Timezone: r.FormValue("tz"),
+	}
+	if daysStr := r.FormValue("days"); daysStr != "" {
+		wh.Days, err = parseWeekdays(daysStr)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	err = s.Calendar.SetWorkingHours(userId, wh)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": wh})
+}
+
+func (s *Server) FreeSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid date"})
+		return
+	}
+
+	days := 1
+	if daysStr := r.FormValue("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 31 {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid days"})
+			return
+		}
+	}
+
+	duration := 30 * time.Minute
+	if durationStr := r.FormValue("duration"); durationStr != "" {
+		duration, err = time.ParseDuration(durationStr)
+		if err != nil || duration <= 0 {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid duration"})
+			return
+		}
+	}
+
+	set, err := s.holidaySet(r.FormValue("country"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	var isHoliday func(time.Time) bool
+	if set != nil {
+		isHoliday = func(day time.Time) bool {
+			_, ok := set.Lookup(day)
+			return ok
+		}
+	}
+
+	slots, err := s.Calendar.FreeSlots(userId, date, days, duration, isHoliday)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": slots})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenMiddleware(t *testing.T) {
+	handler := TokenMiddleware("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		path      string
+		bearer    string
+		user      string
+		password  string
+		status    int
+		challenge bool
+	}{
+		{"/events_for_day", "", "", "", http.StatusUnauthorized, false},
+		{"/events_for_day", "secret", "", "", http.StatusOK, false},
+		{"/dav/1/", "", "", "", http.StatusUnauthorized, true},
+		{"/dav/1/", "", "1", "wrong", http.StatusUnauthorized, true},
+		{"/dav/1/default/", "", "1", "secret", http.StatusOK, false},
+		{"/dav/1/default/", "", "2", "secret", http.StatusForbidden, false},
+		{"/dav/1/default/", "secret", "", "", http.StatusOK, false},
+		// the token is a password for CalDAV only
+		{"/events_for_day", "", "1", "secret", http.StatusUnauthorized, false},
+		{"/events_for_day", "secre", "", "", http.StatusUnauthorized, false},
+		{"/admin/snapshot", "", "", "", http.StatusOK, false},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.bearer)
+		}
+		if tc.user != "" {
+			req.SetBasicAuth(tc.user, tc.password)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("expected %d, got %d for %s as %q", tc.status, rec.Code, tc.path, tc.user)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate") != ""; challenge != tc.challenge {
+			t.Errorf("expected challenge %v, got %q for %s", tc.challenge, rec.Header().Get("WWW-Authenticate"), tc.path)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"2.12/internal/calendar"
+	"2.12/internal/quickadd"
+)
+
+const maxOccurrences = 100
+
+func (s *Server) QuickAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "could not parse form"})
+		return
+	}
+
+	userId, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid user_id"})
+		return
+	}
+
+	calendarId := 0
+	if calendarIdStr := r.FormValue("calendar_id"); calendarIdStr != "" {
+		calendarId, err = strconv.Atoi(calendarIdStr)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid calendar_id"})
+			return
+		}
+	}
+
+	loc := time.UTC
+	if tz := r.FormValue("tz"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid tz"})
+			return
+		}
+	}
+
+	count := 10
+	if countStr := r.FormValue("count"); countStr != "" {
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count < 1 || count > maxOccurrences {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid count"})
+			return
+		}
+	}
+
+	parsed, err := quickadd.Parse(r.FormValue("text"), time.Now().In(loc))
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	err = s.Calendar.CheckPermission(userId, calendarId, calendar.PermissionWrite)
+	if err != nil {
+		writeJson(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var events []calendar.Event
+	for _, start := range parsed.Occurrences(count) {
+		event := calendar.Event{
+			UserID:     userId,
+			CalendarID: calendarId,
+			Date:       start,
+			Duration:   parsed.Duration,
+			Event:      parsed.Title,
+		}
+		event.ID = s.Calendar.CreateEvent(event)
+		events = append(events, event)
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{"result": events})
+}
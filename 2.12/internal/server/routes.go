@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"2.12/internal/caldav"
+)
+
+// davPrefix is where the calendars are served over CalDAV.
+const davPrefix = "/dav/"
+
+func (s *Server) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/create_event", s.CreateEventHandler)
+	mux.HandleFunc("/update_event", s.UpdateEventHandler)
+	mux.HandleFunc("/delete_event", s.DeleteEventHandler)
+	mux.HandleFunc("/events_for_day", s.EventsForDayHandler)
+	mux.HandleFunc("/events_for_week", s.EventsForWeekHandler)
+	mux.HandleFunc("/events_for_month", s.EventsForMonthHandler)
+	mux.HandleFunc("/create_calendar", s.CreateCalendarHandler)
+	mux.HandleFunc("/share_calendar", s.ShareCalendarHandler)
+	mux.HandleFunc("/calendars", s.CalendarsHandler)
+	mux.HandleFunc("/quick_add", s.QuickAddHandler)
+	mux.HandleFunc("/workdays", s.WorkdaysHandler)
+	mux.HandleFunc("/working_hours", s.WorkingHoursHandler)
+	mux.HandleFunc("/free_slots", s.FreeSlotsHandler)
+	mux.HandleFunc("/digest", s.DigestHandler)
+	mux.HandleFunc("/digest_subscription", s.DigestSubscriptionHandler)
+	mux.Handle("/admin/snapshot", AdminMiddleware(s.AdminToken, http.HandlerFunc(s.SnapshotHandler)))
+	mux.Handle("/admin/restore", AdminMiddleware(s.AdminToken, http.HandlerFunc(s.RestoreHandler)))
+	mux.Handle(davPrefix, caldav.NewHandler(s.Calendar, davPrefix))
+	return mux
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// completion is the result of completing the word that ends at the
+// cursor: the candidates replace line[start:pos].
+type completion struct {
+	start      int
+	candidates []string
+}
+
+// complete offers built-ins and executables from $PATH for the command
+// word and file paths for everything else.
+func (sh *Shell) complete(line []rune, pos int) completion {
+	start := 0
+	for i := 0; i < pos; i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case strings.ContainsRune(" \t|;&<>()", line[i]):
+			start = i + 1
+		}
+	}
+	word := unescape(string(line[start:pos]))
+
+	before := strings.TrimRight(string(line[:start]), " \t")
+	commandWord := before == "" || strings.ContainsAny(before[len(before)-1:], "|;&(")
+	for _, kw := range []string{"then", "else", "do", "if", "while", "until", "!"} {
+		if before == kw || strings.HasSuffix(before, " "+kw) || strings.HasSuffix(before, ";"+kw) {
+			commandWord = true
+		}
+	}
+
+	var candidates []string
+	if commandWord && !strings.ContainsRune(word, '/') {
+		candidates = sh.completeCommand(word)
+	} else {
+		candidates = sh.completePath(word, commandWord)
+	}
+	for i, c := range candidates {
+		candidates[i] = escape(c)
+	}
+	return completion{start: start, candidates: candidates}
+}
+
+func (sh *Shell) completeCommand(prefix string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+
+	for _, name := range sh.aliases.names() {
+		add(name)
+	}
+	for _, name := range sh.functions.names() {
+		add(name)
+	}
+	for name := range builtins {
+		add(name)
+	}
+	if sh.hermetic {
+		for name := range coreutils {
+			add(name)
+		}
+	}
+	path, _ := sh.vars.get("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !strings.HasPrefix(e.Name(), prefix) || e.IsDir() {
+				continue
+			}
+			if info, err := e.Info(); err == nil && info.Mode()&0111 != 0 {
+				add(e.Name())
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// completePath lists the entries matching the word. Directories end with
+// a slash; with executablesOnly regular files need an execute bit.
+func (sh *Shell) completePath(word string, executablesOnly bool) []string {
+	dir, base := filepath.Split(word)
+	lookup := dir
+	if strings.HasPrefix(lookup, "~") {
+		lookup = sh.expandTilde(lookup)
+	}
+	lookup = sh.path(lookup)
+	if lookup == "" {
+		lookup = sh.dir
+	}
+
+	entries, err := os.ReadDir(lookup)
+	if err != nil {
+		return nil
+	}
+	var result []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(lookup, name))
+		if err != nil {
+			continue
+		}
+		switch {
+		case info.IsDir():
+			name += "/"
+		case executablesOnly && info.Mode()&0111 == 0:
+			continue
+		}
+		result = append(result, dir+name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := []rune(words[0])
+	for _, w := range words[1:] {
+		r := []rune(w)
+		n := 0
+		for n < len(prefix) && n < len(r) && prefix[n] == r[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(" \t\\'\"$&|;<>()*?[#`", c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "my dir"), 0755)
+	os.Mkdir(filepath.Join(dir, "bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "notes.md"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "bin", "mytool"), nil, 0755)
+	os.WriteFile(filepath.Join(dir, "bin", "mydata"), nil, 0644)
+
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, []string{"PATH=" + filepath.Join(dir, "bin"), "HOME=" + dir}, dir)
+
+	testCases := []struct {
+		line       string
+		start      int
+		candidates []string
+	}{
+		{"myt", 0, []string{"mytool"}},
+		{"ech", 0, []string{"echo"}},
+		{"ls | myt", 5, []string{"mytool"}},
+		{"if myt", 3, []string{"mytool"}},
+		{"cat not", 4, []string{"notes.md", "notes.txt"}},
+		{"cat my", 4, []string{`my\ dir/`}},
+		{`cat my\ d`, 4, []string{`my\ dir/`}},
+		{"cat .h", 4, []string{".hidden"}},
+		{"cat ~/no", 4, []string{"~/notes.md", "~/notes.txt"}},
+		{"./b", 0, []string{"./bin/"}},
+		{"bin/my", 0, []string{"bin/mytool"}},
+		{"cat zzz", 4, nil},
+	}
+
+	for _, tc := range testCases {
+		line := []rune(tc.line)
+		c := sh.complete(line, len(line))
+		if c.start != tc.start || !reflect.DeepEqual(c.candidates, tc.candidates) {
+			t.Errorf("expected %d %q, got %d %q for input %q", tc.start, tc.candidates, c.start, c.candidates, tc.line)
+		}
+	}
+
+	if prefix := commonPrefix([]string{"notes.md", "notes.txt"}); prefix != "notes." {
+		t.Errorf("expected common prefix %q, got %q", "notes.", prefix)
+	}
+}
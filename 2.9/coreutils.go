@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// coreutils are internal versions of common commands for systems that
+// lack them. They take the place of the programs in $PATH only when the
+// shell runs with -hermetic. Unlike built-ins they read stdin and report
+// problems with their operands on stderr, like the programs they replace.
+var coreutils = map[string]func(sh *Shell, args []string, stdin io.Reader, stdout, stderr io.Writer) error{
+	"ls":    (*Shell).lsCommand,
+	"cat":   (*Shell).catCommand,
+	"mkdir": (*Shell).mkdirCommand,
+	"rm":    (*Shell).rmCommand,
+	"cp":    (*Shell).cpCommand,
+	"mv":    (*Shell).mvCommand,
+	"touch": (*Shell).touchCommand,
+	"head":  (*Shell).headCommand,
+	"tail":  (*Shell).tailCommand,
+	"wc":    (*Shell).wcCommand,
+}
+
+// utilFlags splits the arguments of a utility into single-letter flags,
+// which may be combined as in -rf, and operands. A lone - and everything
+// after -- are operands.
+func utilFlags(name string, args []string, allowed string) (map[byte]bool, []string, error) {
+	flags := make(map[byte]bool)
+	var operands []string
+	for i, arg := range args {
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			operands = append(operands, arg)
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			if strings.IndexByte(allowed, arg[j]) < 0 {
+				return nil, nil, fmt.Errorf("%s: invalid option -- '%c'", name, arg[j])
+			}
+			flags[arg[j]] = true
+		}
+	}
+	return flags, operands, nil
+}
+
+// reportFileError prints the failure of a utility on one of its operands
+// as "cat: name: no such file or directory".
+func reportFileError(stderr io.Writer, name, operand string, err error) {
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &pathErr):
+		err = pathErr.Err
+	case errors.As(err, &linkErr):
+		err = linkErr.Err
+	}
+	fmt.Fprintf(stderr, "%s: %s: %v\n", name, operand, err)
+}
+
+func (sh *Shell) lsCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("ls", args[1:], "aAdl1")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 {
+		operands = []string{"."}
+	}
+	sort.Strings(operands)
+
+	w := bufio.NewWriter(stdout)
+	failed := false
+	var dirs []string
+	files := 0
+	for _, name := range operands {
+		info, err := os.Stat(sh.path(name))
+		if err != nil {
+			info, err = os.Lstat(sh.path(name))
+		}
+		if err != nil {
+			reportFileError(stderr, "ls", name, err)
+			failed = true
+			continue
+		}
+		if info.IsDir() && !flags['d'] {
+			dirs = append(dirs, name)
+			continue
+		}
+		writeLsEntry(w, sh.path(name), name, info, flags['l'])
+		files++
+	}
+
+	for i, dir := range dirs {
+		if files > 0 || i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(operands) > 1 {
+			fmt.Fprintf(w, "%s:\n", dir)
+		}
+		entries, err := os.ReadDir(sh.path(dir))
+		if err != nil {
+			reportFileError(stderr, "ls", dir, err)
+			failed = true
+			continue
+		}
+		if flags['a'] {
+			for _, name := range []string{".", ".."} {
+				if info, err := os.Stat(filepath.Join(sh.path(dir), name)); err == nil {
+					writeLsEntry(w, "", name, info, flags['l'])
+				}
+			}
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") && !flags['a'] && !flags['A'] {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				reportFileError(stderr, "ls", filepath.Join(dir, e.Name()), err)
+				failed = true
+				continue
+			}
+			writeLsEntry(w, filepath.Join(sh.path(dir), e.Name()), e.Name(), info, flags['l'])
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+// writeLsEntry prints a name, or with long a line with the mode, size and
+// modification time. Links show their target, read from path.
+func writeLsEntry(w io.Writer, path, name string, info fs.FileInfo, long bool) {
+	if !long {
+		fmt.Fprintln(w, name)
+		return
+	}
+	if info.Mode()&fs.ModeSymlink != 0 && path != "" {
+		if target, err := os.Readlink(path); err == nil {
+			name += " -> " + target
+		}
+	}
+	fmt.Fprintf(w, "%s %8d %s %s\n", info.Mode(), info.Size(), info.ModTime().Format("Jan _2 15:04"), name)
+}
+
+// openOperand opens a file operand, or stdin for "-".
+func (sh *Shell) openOperand(name string, stdin io.Reader) (io.Reader, func(), error) {
+	if name == "-" {
+		return stdin, func() {}, nil
+	}
+	f, err := os.Open(sh.path(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+func (sh *Shell) catCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("cat", args[1:], "n")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+
+	line := 0
+	failed := false
+	for _, name := range operands {
+		r, done, err := sh.openOperand(name, stdin)
+		if err != nil {
+			reportFileError(stderr, "cat", name, err)
+			failed = true
+			continue
+		}
+		if flags['n'] {
+			err = numberLines(r, stdout, &line)
+		} else {
+			_, err = io.Copy(stdout, r)
+		}
+		done()
+
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) && pathErr.Op == "read" {
+			reportFileError(stderr, "cat", name, err)
+			failed = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+// numberLines copies r to w with the line numbers of cat -n, which go on
+// from one file to the next.
+func numberLines(r io.Reader, w io.Writer, line *int) error {
+	reader := bufio.NewReader(r)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			*line++
+			if _, err := fmt.Fprintf(w, "%6d\t%s", *line, text); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (sh *Shell) mkdirCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("mkdir", args[1:], "p")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 {
+		return fmt.Errorf("mkdir: missing operand")
+	}
+
+	failed := false
+	for _, name := range operands {
+		if flags['p'] {
+			err = os.MkdirAll(sh.path(name), 0777)
+		} else {
+			err = os.Mkdir(sh.path(name), 0777)
+		}
+		if err != nil {
+			reportFileError(stderr, "mkdir", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) rmCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("rm", args[1:], "rRf")
+	if err != nil {
+		return err
+	}
+	force, recursive := flags['f'], flags['r'] || flags['R']
+	if len(operands) == 0 && !force {
+		return fmt.Errorf("rm: missing operand")
+	}
+
+	failed := false
+	for _, name := range operands {
+		path := sh.path(name)
+		info, err := os.Lstat(path)
+		switch {
+		case err != nil:
+			if force && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+		case info.IsDir() && !recursive:
+			err = errors.New("is a directory")
+		case recursive:
+			err = os.RemoveAll(path)
+		default:
+			err = os.Remove(path)
+		}
+		if err != nil {
+			reportFileError(stderr, "rm", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+// targets pairs every source of cp or mv with its destination: the last
+// operand itself, or a name inside it when it is a directory.
+func (sh *Shell) targets(name string, operands []string) ([][2]string, error) {
+	if len(operands) < 2 {
+		return nil, fmt.Errorf("%s: missing file operand", name)
+	}
+	sources, dest := operands[:len(operands)-1], operands[len(operands)-1]
+	info, err := os.Stat(sh.path(dest))
+	if err != nil || !info.IsDir() {
+		if len(sources) > 1 {
+			return nil, fmt.Errorf("%s: target %s is not a directory", name, dest)
+		}
+		return [][2]string{{sources[0], dest}}, nil
+	}
+
+	var pairs [][2]string
+	for _, src := range sources {
+		pairs = append(pairs, [2]string{src, filepath.Join(dest, filepath.Base(src))})
+	}
+	return pairs, nil
+}
+
+func (sh *Shell) cpCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("cp", args[1:], "rR")
+	if err != nil {
+		return err
+	}
+	pairs, err := sh.targets("cp", operands)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, pair := range pairs {
+		src, dest := sh.path(pair[0]), sh.path(pair[1])
+		info, err := os.Stat(src)
+		switch {
+		case err != nil:
+		case info.IsDir() && !(flags['r'] || flags['R']):
+			err = errors.New("-r not specified; omitting directory")
+		case info.IsDir():
+			err = copyTree(src, dest)
+		default:
+			err = copyFile(src, dest, info.Mode())
+		}
+		if err != nil {
+			reportFileError(stderr, "cp", pair[0], err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func copyFile(src, dest string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyTree copies the directory src to dest, which is created.
+func copyTree(src, dest string) error {
+	if rel, err := filepath.Rel(src, dest); err == nil && !strings.HasPrefix(rel, "..") {
+		return errors.New("cannot copy a directory into itself")
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+func (sh *Shell) mvCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	_, operands, err := utilFlags("mv", args[1:], "f")
+	if err != nil {
+		return err
+	}
+	pairs, err := sh.targets("mv", operands)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, pair := range pairs {
+		if err := os.Rename(sh.path(pair[0]), sh.path(pair[1])); err != nil {
+			reportFileError(stderr, "mv", pair[0], err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) touchCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("touch", args[1:], "c")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 {
+		return fmt.Errorf("touch: missing file operand")
+	}
+
+	now := time.Now()
+	failed := false
+	for _, name := range operands {
+		path := sh.path(name)
+		err := os.Chtimes(path, now, now)
+		if errors.Is(err, fs.ErrNotExist) {
+			if flags['c'] {
+				continue
+			}
+			var f *os.File
+			if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666); err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			reportFileError(stderr, "touch", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+// parseLineCount reads the options of head and tail: -n N, -nN or -N.
+// For tail, -n +N starts at line N rather than counting from the end.
+func parseLineCount(name string, args []string) (n int, fromStart bool, operands []string, err error) {
+	n = 10
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		switch {
+		case arg == "--":
+			return n, fromStart, append(operands, args[i+1:]...), nil
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			operands = append(operands, arg)
+			continue
+		case strings.HasPrefix(arg, "-n"):
+			if value, err = optionValue(args, &i, "-n"); err != nil {
+				return 0, false, nil, fmt.Errorf("%s: %v", name, err)
+			}
+		default:
+			value = arg[1:]
+		}
+
+		fromStart = false
+		if rest, ok := strings.CutPrefix(value, "+"); ok && name == "tail" {
+			value, fromStart = rest, true
+		}
+		if n, err = strconv.Atoi(value); err != nil || n < 0 {
+			return 0, false, nil, fmt.Errorf("%s: invalid number of lines: %s", name, value)
+		}
+	}
+	return n, fromStart, operands, nil
+}
+
+// eachOperand runs fn on every file operand of head or tail, or on stdin,
+// with a header before each file when there are several.
+func (sh *Shell) eachOperand(name string, operands []string, stdin io.Reader, stdout, stderr io.Writer, fn func(r io.Reader) error) error {
+	if len(operands) == 0 {
+		operands = []string{"-"}
+	}
+
+	failed := false
+	for i, operand := range operands {
+		r, done, err := sh.openOperand(operand, stdin)
+		if err != nil {
+			reportFileError(stderr, name, operand, err)
+			failed = true
+			continue
+		}
+		if len(operands) > 1 {
+			title := operand
+			if operand == "-" {
+				title = "standard input"
+			}
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "==> %s <==\n", title)
+		}
+		err = fn(r)
+		done()
+		if err != nil {
+			return err
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) headCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	n, _, operands, err := parseLineCount("head", args[1:])
+	if err != nil {
+		return err
+	}
+	return sh.eachOperand("head", operands, stdin, stdout, stderr, func(r io.Reader) error {
+		// only what is needed is read, so that a writer to a pipe stops
+		// early like it does with the real head
+		reader := bufio.NewReader(r)
+		for i := 0; i < n; i++ {
+			line, err := reader.ReadString('\n')
+			if _, err := io.WriteString(stdout, line); err != nil {
+				return err
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (sh *Shell) tailCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	n, fromStart, operands, err := parseLineCount("tail", args[1:])
+	if err != nil {
+		return err
+	}
+	return sh.eachOperand("tail", operands, stdin, stdout, stderr, func(r io.Reader) error {
+		reader := bufio.NewReader(r)
+		if fromStart {
+			for i := 1; i < n; i++ {
+				if _, err := reader.ReadString('\n'); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+			_, err := io.Copy(stdout, reader)
+			return err
+		}
+
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" && n > 0 {
+				if len(lines) == n {
+					lines = lines[1:]
+				}
+				lines = append(lines, line)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(stdout, strings.Join(lines, ""))
+		return err
+	})
+}
+
+type wcCounts struct {
+	lines, words, bytes int
+	name                string
+}
+
+func countReader(r io.Reader) (wcCounts, error) {
+	var c wcCounts
+	inWord := false
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			space := b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+			if b == '\n' {
+				c.lines++
+			}
+			if !space && !inWord {
+				c.words++
+			}
+			inWord = !space
+		}
+		c.bytes += n
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+}
+
+// wcCommand prints lines, words and bytes, or the ones selected by -l, -w
+// and -c, aligned on the widest number, with a total for several files.
+func (sh *Shell) wcCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags, operands, err := utilFlags("wc", args[1:], "lwc")
+	if err != nil {
+		return err
+	}
+	if !flags['l'] && !flags['w'] && !flags['c'] {
+		flags['l'], flags['w'], flags['c'] = true, true, true
+	}
+
+	var rows []wcCounts
+	failed := false
+	if len(operands) == 0 {
+		c, err := countReader(stdin)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, c)
+	}
+	for _, name := range operands {
+		r, done, err := sh.openOperand(name, stdin)
+		if err == nil {
+			var c wcCounts
+			c, err = countReader(r)
+			c.name = name
+			done()
+			if err == nil {
+				rows = append(rows, c)
+			}
+		}
+		if err != nil {
+			reportFileError(stderr, "wc", name, err)
+			failed = true
+		}
+	}
+	if len(rows) > 1 {
+		total := wcCounts{name: "total"}
+		for _, c := range rows {
+			total.lines += c.lines
+			total.words += c.words
+			total.bytes += c.bytes
+		}
+		rows = append(rows, total)
+	}
+
+	columns := func(c wcCounts) []int {
+		var result []int
+		for _, col := range []struct {
+			flag  byte
+			value int
+		}{{'l', c.lines}, {'w', c.words}, {'c', c.bytes}} {
+			if flags[col.flag] {
+				result = append(result, col.value)
+			}
+		}
+		return result
+	}
+	width := 1
+	for _, c := range rows {
+		for _, v := range columns(c) {
+			width = max(width, len(strconv.Itoa(v)))
+		}
+	}
+	for _, c := range rows {
+		var fields []string
+		for _, v := range columns(c) {
+			fields = append(fields, fmt.Sprintf("%*d", width, v))
+		}
+		if c.name != "" {
+			fields = append(fields, c.name)
+		}
+		if _, err := fmt.Fprintln(stdout, strings.Join(fields, " ")); err != nil {
+			return err
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
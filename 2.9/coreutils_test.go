@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLineCount(t *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		n         int
+		fromStart bool
+		operands  []string
+		hasError  bool
+	}{
+		{"head", nil, 10, false, nil, false},
+		{"head", []string{"-n", "3", "a"}, 3, false, []string{"a"}, false},
+		{"head", []string{"-n3", "a", "b"}, 3, false, []string{"a", "b"}, false},
+		{"head", []string{"-5", "-"}, 5, false, []string{"-"}, false},
+		{"tail", []string{"-n", "+2"}, 2, true, nil, false},
+		{"tail", []string{"--", "-n"}, 10, false, []string{"-n"}, false},
+		{"head", []string{"-n", "+2"}, 2, false, nil, false},
+		{"head", []string{"-n"}, 0, false, nil, true},
+		{"tail", []string{"-x"}, 0, false, nil, true},
+	}
+
+	for _, tc := range testCases {
+		n, fromStart, operands, err := parseLineCount(tc.name, tc.args)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for %s %q, but got none", tc.name, tc.args)
+			}
+			continue
+		}
+		if err != nil || n != tc.n || fromStart != tc.fromStart || !reflect.DeepEqual(operands, tc.operands) {
+			t.Errorf("expected %d %v %q, got %d %v %q (%v) for %s %q", tc.n, tc.fromStart, tc.operands, n, fromStart, operands, err, tc.name, tc.args)
+		}
+	}
+}
+
+func TestUtilFlags(t *testing.T) {
+	flags, operands, err := utilFlags("rm", []string{"-rf", "a", "-", "--", "-b"}, "rRf")
+	if err != nil || !flags['r'] || !flags['f'] || flags['R'] || !reflect.DeepEqual(operands, []string{"a", "-", "-b"}) {
+		t.Errorf("unexpected result %v %q %v", flags, operands, err)
+	}
+	if _, _, err := utilFlags("rm", []string{"-x"}, "rRf"); err == nil {
+		t.Errorf("expected error for an unknown flag")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sameFile tells whether two paths lead to the same file.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
+}
+
+// tildePath shows a path inside the home directory with ~.
+func (sh *Shell) tildePath(path string) string {
+	home, ok := sh.vars.get("HOME")
+	if !ok {
+		home, _ = os.UserHomeDir()
+	}
+	if home == "" || home == "/" {
+		return path
+	}
+	home = filepath.Clean(home)
+	if path == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+		return "~" + string(filepath.Separator) + rest
+	}
+	return path
+}
+
+// changeDir makes dir, an absolute path, the working directory of the
+// shell and updates PWD and OLDPWD. The path is kept as given, with ..
+// removed lexically, unless physical asks for the symbolic links to be
+// resolved.
+func (sh *Shell) changeDir(name, dir string, physical bool) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", name)
+	}
+	if physical {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+	}
+	sh.vars.set("OLDPWD", sh.dir)
+	sh.dir = filepath.Clean(dir)
+	sh.vars.set("PWD", sh.dir)
+	return nil
+}
+
+// cdTarget resolves the argument of cd. A relative name that does not
+// start with . or .. is searched in the directories of CDPATH first;
+// found tells whether it was found in one other than the current one.
+func (sh *Shell) cdTarget(arg string) (dir string, found bool) {
+	sep := string(filepath.Separator)
+	if filepath.IsAbs(arg) || arg == "." || arg == ".." || strings.HasPrefix(arg, "."+sep) || strings.HasPrefix(arg, ".."+sep) {
+		return sh.path(arg), false
+	}
+	cdpath, _ := sh.vars.get("CDPATH")
+	for _, prefix := range filepath.SplitList(cdpath) {
+		if prefix == "" {
+			prefix = "."
+		}
+		candidate := sh.path(filepath.Join(prefix, arg))
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, prefix != "."
+		}
+	}
+	return sh.path(arg), false
+}
+
+// cdCommand implements cd [-L|-P] [dir]. Without a directory it goes to
+// $HOME and "cd -" goes back to $OLDPWD. The new directory is printed when
+// it is not the one that was typed: for - and for a match in CDPATH.
+func (sh *Shell) cdCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	physical := false
+	for len(args) > 0 && (args[0] == "-L" || args[0] == "-P") {
+		physical, args = args[0] == "-P", args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("cd: too many arguments")
+	}
+
+	var arg string
+	if len(args) == 0 {
+		home, _ := sh.vars.get("HOME")
+		if home == "" {
+			return fmt.Errorf("cd: HOME not set")
+		}
+		arg = home
+	} else {
+		arg = args[0]
+	}
+
+	show := false
+	var dir string
+	if arg == "-" {
+		old, _ := sh.vars.get("OLDPWD")
+		if old == "" {
+			return fmt.Errorf("cd: OLDPWD not set")
+		}
+		dir, show = sh.path(old), true
+	} else {
+		dir, show = sh.cdTarget(arg)
+	}
+	if err := sh.changeDir("cd: "+arg, dir, physical); err != nil {
+		return err
+	}
+	if show {
+		fmt.Fprintln(stdout, sh.dir)
+	}
+	return nil
+}
+
+// pwdCommand prints the working directory as cd left it, or with -P with
+// the symbolic links resolved.
+func (sh *Shell) pwdCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	physical := false
+	for _, arg := range cmd[1:] {
+		switch arg {
+		case "-L", "-P":
+			physical = arg == "-P"
+		default:
+			return fmt.Errorf("pwd: %s: invalid option", arg)
+		}
+	}
+	dir := sh.dir
+	if physical {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return fmt.Errorf("pwd: %v", err)
+		}
+		dir = resolved
+	}
+	_, err := fmt.Fprintln(stdout, dir)
+	return err
+}
+
+// dirStack returns the directory stack with the working directory on top.
+func (sh *Shell) dirStack() []string {
+	return append([]string{sh.dir}, sh.dirs...)
+}
+
+// stackIndex reads +N, counting from the top of the stack, or -N, from
+// the bottom, and returns the position from the top.
+func (sh *Shell) stackIndex(name, arg string) (int, error) {
+	n, err := strconv.Atoi(arg[1:])
+	size := len(sh.dirs) + 1
+	if err != nil || n < 0 || n >= size {
+		return 0, fmt.Errorf("%s: %s: directory stack index out of range", name, arg)
+	}
+	if arg[0] == '-' {
+		n = size - 1 - n
+	}
+	return n, nil
+}
+
+func isStackIndex(arg string) bool {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return false
+	}
+	_, err := strconv.Atoi(arg[1:])
+	return err == nil
+}
+
+// setDirStack changes to the top of the new stack and keeps the rest.
+func (sh *Shell) setDirStack(name string, stack []string) error {
+	if err := sh.changeDir(name+": "+stack[0], stack[0], false); err != nil {
+		return err
+	}
+	sh.dirs = append([]string(nil), stack[1:]...)
+	return nil
+}
+
+// pushdCommand implements pushd [-n] [dir | +N | -N]. A directory is
+// changed to and the previous one pushed below it; with -n the directory
+// is only put below the top. +N and -N rotate the stack so that entry N is on top and
+// no argument exchanges the two top entries.
+func (sh *Shell) pushdCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	noChange := false
+	if len(args) > 0 && args[0] == "-n" {
+		noChange, args = true, args[1:]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("pushd: too many arguments")
+	}
+
+	stack := sh.dirStack()
+	switch {
+	case len(args) == 0:
+		if len(sh.dirs) == 0 {
+			return fmt.Errorf("pushd: no other directory")
+		}
+		stack[0], stack[1] = stack[1], stack[0]
+		if err := sh.setDirStack("pushd", stack); err != nil {
+			return err
+		}
+	case isStackIndex(args[0]):
+		n, err := sh.stackIndex("pushd", args[0])
+		if err != nil {
+			return err
+		}
+		if err := sh.setDirStack("pushd", append(stack[n:], stack[:n]...)); err != nil {
+			return err
+		}
+	case noChange:
+		dir, _ := sh.cdTarget(args[0])
+		sh.dirs = append([]string{dir}, sh.dirs...)
+	default:
+		dir, _ := sh.cdTarget(args[0])
+		old := sh.dir
+		if err := sh.changeDir("pushd: "+args[0], dir, false); err != nil {
+			return err
+		}
+		sh.dirs = append([]string{old}, sh.dirs...)
+	}
+	return sh.printDirs(stdout, false, false, false)
+}
+
+// popdCommand implements popd [-n] [+N | -N]. It removes the top entry
+// and changes to the next one, or removes entry N. With -n the entry
+// below the top goes and the working directory stays.
+func (sh *Shell) popdCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	noChange := false
+	if len(args) > 0 && args[0] == "-n" {
+		noChange, args = true, args[1:]
+	}
+	if len(args) > 1 || (len(args) == 1 && !isStackIndex(args[0])) {
+		return fmt.Errorf("popd: usage: popd [-n] [+N | -N]")
+	}
+	if len(sh.dirs) == 0 {
+		return fmt.Errorf("popd: directory stack empty")
+	}
+
+	n := 0
+	if noChange {
+		n = 1
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = sh.stackIndex("popd", args[0]); err != nil {
+			return err
+		}
+	}
+
+	stack := sh.dirStack()
+	if n == 0 {
+		if err := sh.setDirStack("popd", stack[1:]); err != nil {
+			return err
+		}
+	} else {
+		sh.dirs = append(sh.dirs[:n-1], sh.dirs[n:]...)
+	}
+	return sh.printDirs(stdout, false, false, false)
+}
+
+// dirsCommand implements dirs [-clpv] [+N | -N].
+func (sh *Shell) dirsCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	long, perLine, numbered := false, false, false
+	index := -1
+	for _, arg := range cmd[1:] {
+		switch {
+		case isStackIndex(arg):
+			n, err := sh.stackIndex("dirs", arg)
+			if err != nil {
+				return err
+			}
+			index = n
+		case len(arg) > 1 && arg[0] == '-':
+			for _, c := range arg[1:] {
+				switch c {
+				case 'c':
+					sh.dirs = nil
+				case 'l':
+					long = true
+				case 'p':
+					perLine = true
+				case 'v':
+					perLine, numbered = true, true
+				default:
+					return fmt.Errorf("dirs: -%c: invalid option", c)
+				}
+			}
+		default:
+			return fmt.Errorf("dirs: usage: dirs [-clpv] [+N] [-N]")
+		}
+	}
+
+	if index >= 0 {
+		dir := sh.dirStack()[index]
+		if !long {
+			dir = sh.tildePath(dir)
+		}
+		_, err := fmt.Fprintln(stdout, dir)
+		return err
+	}
+	return sh.printDirs(stdout, long, perLine, numbered)
+}
+
+// printDirs shows the directory stack on one line, or one entry per line,
+// with home abbreviated as ~ unless long is set.
+func (sh *Shell) printDirs(stdout io.Writer, long, perLine, numbered bool) error {
+	stack := sh.dirStack()
+	for i, dir := range stack {
+		if !long {
+			stack[i] = sh.tildePath(dir)
+		}
+		if numbered {
+			stack[i] = fmt.Sprintf("%2d  %s", i, stack[i])
+		}
+	}
+	sep := " "
+	if perLine {
+		sep = "\n"
+	}
+	_, err := fmt.Fprintln(stdout, strings.Join(stack, sep))
+	return err
+}
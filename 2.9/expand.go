@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// field is a word being built during expansion. pattern mirrors text with
+// quoted characters escaped, so that only unquoted glob characters match.
+type field struct {
+	text    strings.Builder
+	pattern strings.Builder
+	glob    bool
+	started bool
+}
+
+func (f *field) add(s string, quoted bool) {
+	f.started = true
+	f.text.WriteString(s)
+	if quoted {
+		for _, c := range s {
+			if strings.ContainsRune(`*?[\`, c) {
+				f.pattern.WriteRune('\\')
+			}
+			f.pattern.WriteRune(c)
+		}
+		return
+	}
+	f.pattern.WriteString(s)
+	if strings.ContainsAny(s, "*?[") {
+		f.glob = true
+	}
+}
+
+func (sh *Shell) expandWords(words []Word) ([]string, error) {
+	var result []string
+	for _, w := range words {
+		fields, err := sh.expandWord(w)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fields...)
+	}
+	return result, nil
+}
+
+// expandWord performs tilde, variable and command expansion on w, splits
+// unquoted expansion results on whitespace and expands globs.
+func (sh *Shell) expandWord(w Word) ([]string, error) {
+	var result []string
+	cur := &field{}
+	flush := func() {
+		if !cur.started {
+			return
+		}
+		text := cur.text.String()
+		if cur.glob {
+			matches, err := sh.glob(cur.pattern.String())
+			if err == nil && len(matches) > 0 {
+				result = append(result, matches...)
+				cur = &field{}
+				return
+			}
+		}
+		result = append(result, text)
+		cur = &field{}
+	}
+
+	for i, part := range w {
+		switch part.kind {
+		case partLiteral:
+			text := part.text
+			if i == 0 && !part.quoted && strings.HasPrefix(text, "~") {
+				text = sh.expandTilde(text)
+			}
+			cur.add(text, part.quoted)
+		case partVar, partCommand:
+			if part.kind == partVar && part.text == "@" && part.quoted {
+				// "$@" keeps every parameter a separate field
+				for j, param := range sh.positional {
+					if j > 0 {
+						flush()
+					}
+					cur.add(param, true)
+				}
+				continue
+			}
+			value, err := sh.expandPart(part)
+			if err != nil {
+				return nil, err
+			}
+			if part.quoted {
+				cur.add(value, true)
+				continue
+			}
+			if value != "" && strings.TrimLeft(value, " \t\n") != value {
+				flush()
+			}
+			for j, s := range strings.Fields(value) {
+				if j > 0 {
+					flush()
+				}
+				cur.add(s, false)
+			}
+			if value != "" && strings.TrimRight(value, " \t\n") != value {
+				flush()
+			}
+		}
+	}
+	flush()
+	return result, nil
+}
+
+// glob expands a pattern relative to the working directory of the shell.
+// Relative patterns give relative names.
+func (sh *Shell) glob(pattern string) ([]string, error) {
+	if filepath.IsAbs(pattern) {
+		return filepath.Glob(pattern)
+	}
+	matches, err := filepath.Glob(filepath.Join(escapeGlob(sh.dir), pattern))
+	for i, m := range matches {
+		if rel, err := filepath.Rel(sh.dir, m); err == nil {
+			matches[i] = rel
+		}
+	}
+	return matches, err
+}
+
+// escapeGlob quotes the characters of s that filepath.Match treats as
+// special.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (sh *Shell) expandPart(part wordPart) (string, error) {
+	if part.kind == partCommand {
+		return sh.commandSubstitution(part.text)
+	}
+	switch part.text {
+	case "?":
+		return strconv.Itoa(sh.status), nil
+	case "$":
+		return strconv.Itoa(os.Getpid()), nil
+	case "#":
+		return strconv.Itoa(len(sh.positional)), nil
+	case "@", "*":
+		return strings.Join(sh.positional, " "), nil
+	case "0":
+		return sh.scriptName, nil
+	}
+	if n, err := strconv.Atoi(part.text); err == nil {
+		if n <= len(sh.positional) {
+			return sh.positional[n-1], nil
+		}
+		return "", nil
+	}
+	value, _ := sh.vars.get(part.text)
+	return value, nil
+}
+
+func (sh *Shell) expandTilde(s string) string {
+	name, rest, found := strings.Cut(s[1:], "/")
+	if found {
+		rest = "/" + rest
+	}
+
+	var home string
+	switch name {
+	case "":
+		home, _ = sh.vars.get("HOME")
+		if home == "" {
+			home, _ = os.UserHomeDir()
+		}
+	case "+":
+		home, _ = sh.vars.get("PWD")
+	case "-":
+		home, _ = sh.vars.get("OLDPWD")
+	default:
+		if u, err := user.Lookup(name); err == nil {
+			home = u.HomeDir
+		}
+	}
+	if home == "" {
+		return s
+	}
+	return home + rest
+}
+
+// commandSubstitution runs src in a subshell and returns its output
+// without the trailing newlines.
+func (sh *Shell) commandSubstitution(src string) (string, error) {
+	list, err := sh.parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", fmt.Errorf("pipe: %v", err)
+	}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		r.Close()
+		close(done)
+	}()
+
+	sub := sh.subshell()
+	err = sub.runList(list, sh.stdin, w)
+	w.Close()
+	<-done
+	sh.status = sub.status
+	if isControl(err) {
+		// like a subshell, exit or break end only the substitution
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// expandValue expands the value of an assignment: there is no field
+// splitting and no globbing.
+func (sh *Shell) expandValue(w Word) (string, error) {
+	var value strings.Builder
+	for i, part := range w {
+		switch part.kind {
+		case partLiteral:
+			text := part.text
+			if i == 0 && !part.quoted && strings.HasPrefix(text, "~") {
+				text = sh.expandTilde(text)
+			}
+			value.WriteString(text)
+		default:
+			text, err := sh.expandPart(part)
+			if err != nil {
+				return "", err
+			}
+			value.WriteString(text)
+		}
+	}
+	return value.String(), nil
+}
+
+func (sh *Shell) expandAssignments(assignments []Assignment) (map[string]string, error) {
+	result := make(map[string]string, len(assignments))
+	for _, a := range assignments {
+		value, err := sh.expandValue(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[a.Name] = value
+	}
+	return result, nil
+}
+
+func (sh *Shell) expandTarget(w Word) (string, error) {
+	fields, err := sh.expandWord(w)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 1 {
+		return "", fmt.Errorf("%s: ambiguous redirect", quote(strings.Join(fields, " ")))
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const rcFile = ".myshellrc"
+
+// aliasTable holds the aliases. They are expanded by the parser, so a new
+// alias applies to the lines read after the one that defines it.
+type aliasTable struct {
+	aliases map[string]string
+	mutex   *sync.Mutex
+}
+
+func newAliasTable() *aliasTable {
+	return &aliasTable{aliases: make(map[string]string), mutex: &sync.Mutex{}}
+}
+
+func (at *aliasTable) get(name string) (string, bool) {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	value, ok := at.aliases[name]
+	return value, ok
+}
+
+func (at *aliasTable) set(name, value string) {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	at.aliases[name] = value
+}
+
+func (at *aliasTable) remove(name string) bool {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	_, ok := at.aliases[name]
+	delete(at.aliases, name)
+	return ok
+}
+
+func (at *aliasTable) clone() *aliasTable {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	c := newAliasTable()
+	for name, value := range at.aliases {
+		c.aliases[name] = value
+	}
+	return c
+}
+
+func (at *aliasTable) names() []string {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	names := make([]string, 0, len(at.aliases))
+	for name := range at.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type functionTable struct {
+	funcs map[string]*FuncDef
+	mutex *sync.Mutex
+}
+
+func newFunctionTable() *functionTable {
+	return &functionTable{funcs: make(map[string]*FuncDef), mutex: &sync.Mutex{}}
+}
+
+func (ft *functionTable) get(name string) *FuncDef {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	return ft.funcs[name]
+}
+
+func (ft *functionTable) define(def *FuncDef) {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	ft.funcs[def.Name] = def
+}
+
+func (ft *functionTable) remove(name string) bool {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	_, ok := ft.funcs[name]
+	delete(ft.funcs, name)
+	return ok
+}
+
+func (ft *functionTable) clone() *functionTable {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	c := newFunctionTable()
+	for name, def := range ft.funcs {
+		c.funcs[name] = def
+	}
+	return c
+}
+
+func (ft *functionTable) names() []string {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	names := make([]string, 0, len(ft.funcs))
+	for name := range ft.funcs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// returnControl is returned by the return built-in and unwinds the lists
+// up to the function call.
+type returnControl struct {
+	code int
+}
+
+func (e *returnControl) Error() string {
+	return "return: can only `return' from a function"
+}
+
+// callFunction runs the body of a function with the arguments as
+// positional parameters. The status of the call is that of the last
+// command of the body, or the one given to return.
+func (sh *Shell) callFunction(def *FuncDef, args []string, stdin, stdout *os.File) error {
+	saved := sh.positional
+	sh.positional = args[1:]
+	defer func() { sh.positional = saved }()
+
+	err := sh.runNode(def.Body, stdin, stdout)
+	var rc *returnControl
+	if errors.As(err, &rc) {
+		sh.status = rc.code
+	} else if err != nil {
+		return err
+	}
+	if sh.status != 0 {
+		return &statusError{code: sh.status}
+	}
+	return nil
+}
+
+func (sh *Shell) returnCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	code := sh.status
+	if len(cmd) > 1 {
+		n, err := strconv.Atoi(cmd[1])
+		if err != nil {
+			return fmt.Errorf("return: %s: numeric argument required", cmd[1])
+		}
+		code = n & 0xff
+	}
+	return &returnControl{code: code}
+}
+
+// loadRC runs ~/.myshellrc, if there is one, before the first prompt.
+func (sh *Shell) loadRC() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(home, rcFile))
+	if err != nil {
+		return
+	}
+	err = sh.execute(string(data))
+	var exit *exitControl
+	if errors.As(err, &exit) {
+		os.Exit(sh.status)
+	}
+	if err != nil {
+		fmt.Fprintf(sh.stderr, "%s: %v\n", rcFile, err)
+	}
+}
+
+func (sh *Shell) aliasCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		for _, name := range sh.aliases.names() {
+			value, _ := sh.aliases.get(name)
+			fmt.Fprintf(stdout, "alias %s=%s\n", name, quote(value))
+		}
+		return nil
+	}
+
+	var err error
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			value, found := sh.aliases.get(name)
+			if !found {
+				err = fmt.Errorf("alias: %s: not found", name)
+				continue
+			}
+			fmt.Fprintf(stdout, "alias %s=%s\n", name, quote(value))
+			continue
+		}
+		if funcName(Word{{kind: partLiteral, text: name}}) == "" {
+			err = fmt.Errorf("alias: `%s': invalid alias name", name)
+			continue
+		}
+		sh.aliases.set(name, value)
+	}
+	return err
+}
+
+func (sh *Shell) unaliasCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(cmd) < 2 {
+		return fmt.Errorf("unalias: usage: unalias [-a] name [name ...]")
+	}
+	if cmd[1] == "-a" {
+		for _, name := range sh.aliases.names() {
+			sh.aliases.remove(name)
+		}
+		return nil
+	}
+
+	var err error
+	for _, name := range cmd[1:] {
+		if !sh.aliases.remove(name) {
+			err = fmt.Errorf("unalias: %s: not found", name)
+		}
+	}
+	return err
+}
+
+// resolveCommand tells what a command name runs, in the order the shell
+// looks it up: alias, keyword, function, built-in, then PATH. The internal
+// coreutils of a hermetic shell count as built-ins.
+func (sh *Shell) resolveCommand(name string) (kind, detail string) {
+	if value, ok := sh.aliases.get(name); ok {
+		return "alias", value
+	}
+	if reservedWords[name] {
+		return "keyword", ""
+	}
+	if def := sh.functions.get(name); def != nil {
+		return "function", def.Text
+	}
+	if _, ok := builtins[name]; ok {
+		return "builtin", ""
+	}
+	if _, ok := coreutils[name]; ok && sh.hermetic {
+		return "builtin", ""
+	}
+	if path, err := sh.lookPath(name); err == nil {
+		return "file", sh.path(path)
+	}
+	return "", ""
+}
+
+func (sh *Shell) typeCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	short := false
+	if len(args) > 0 && args[0] == "-t" {
+		short, args = true, args[1:]
+	}
+
+	failed := false
+	for _, name := range args {
+		kind, detail := sh.resolveCommand(name)
+		switch {
+		case kind == "":
+			if !short {
+				fmt.Fprintf(stderr, "type: %s: not found\n", name)
+			}
+			failed = true
+		case short:
+			fmt.Fprintln(stdout, kind)
+		case kind == "alias":
+			fmt.Fprintf(stdout, "%s is aliased to `%s'\n", name, detail)
+		case kind == "keyword":
+			fmt.Fprintf(stdout, "%s is a shell keyword\n", name)
+		case kind == "function":
+			fmt.Fprintf(stdout, "%s is a function\n%s\n", name, detail)
+		case kind == "builtin":
+			fmt.Fprintf(stdout, "%s is a shell builtin\n", name)
+		default:
+			fmt.Fprintf(stdout, "%s is %s\n", name, detail)
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) whichCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	failed := false
+	for _, name := range cmd[1:] {
+		kind, detail := sh.resolveCommand(name)
+		switch kind {
+		case "alias":
+			fmt.Fprintf(stdout, "%s: aliased to %s\n", name, detail)
+		case "keyword":
+			fmt.Fprintf(stdout, "%s: shell reserved word\n", name)
+		case "function":
+			fmt.Fprintf(stdout, "%s: shell function\n", name)
+		case "builtin":
+			fmt.Fprintf(stdout, "%s: shell built-in command\n", name)
+		case "file":
+			fmt.Fprintln(stdout, detail)
+		default:
+			fmt.Fprintf(stdout, "%s not found\n", name)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prompt reads the repository on its own, so it works without a git
+// binary. Only SHA-1 repositories are understood.
+
+const hashSize = sha1.Size
+
+// gitRepo is a work tree with its git directory. In a linked work tree
+// the objects and refs live in the common directory.
+type gitRepo struct {
+	workTree  string
+	gitDir    string
+	commonDir string
+	packs     map[string][]byte // pack indexes by path, read once
+}
+
+// findGitRepo looks for .git in dir and its parents.
+func findGitRepo(dir string) (*gitRepo, bool) {
+	for {
+		path := filepath.Join(dir, ".git")
+		if info, err := os.Stat(path); err == nil {
+			repo := &gitRepo{workTree: dir, gitDir: path}
+			if !info.IsDir() {
+				// a work tree or submodule points to its git directory
+				data, err := os.ReadFile(path)
+				target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if err != nil || !ok {
+					return nil, false
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(dir, target)
+				}
+				repo.gitDir = target
+			}
+			repo.commonDir = repo.gitDir
+			if data, err := os.ReadFile(filepath.Join(repo.gitDir, "commondir")); err == nil {
+				common := strings.TrimSpace(string(data))
+				if !filepath.IsAbs(common) {
+					common = filepath.Join(repo.gitDir, common)
+				}
+				repo.commonDir = common
+			}
+			return repo, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, false
+		}
+		dir = parent
+	}
+}
+
+// head returns the name of the current branch, or the abbreviated commit
+// for a detached HEAD, and the commit HEAD points to. The commit is empty
+// on a branch without commits.
+func (r *gitRepo) head() (name, commit string, err error) {
+	data, err := os.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(data))
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		if len(head) < 7 {
+			return "", "", fmt.Errorf("invalid HEAD %q", head)
+		}
+		return head[:7], head, nil
+	}
+	name = strings.TrimPrefix(ref, "refs/heads/")
+	commit, err = r.resolveRef(ref)
+	return name, commit, err
+}
+
+func (r *gitRepo) resolveRef(ref string) (string, error) {
+	if data, err := os.ReadFile(filepath.Join(r.commonDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if sha, name, ok := strings.Cut(scanner.Text(), " "); ok && name == ref {
+			return sha, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+type indexEntry struct {
+	mtimeSec  uint32
+	mtimeNsec uint32
+	mode      uint32
+	size      uint32
+	sha       string
+	stage     int
+	skip      bool // assume-valid or skip-worktree
+}
+
+// readIndex parses the index file, versions 2 to 4. It also returns the
+// root tree of the cache-tree extension if that is up to date.
+func (r *gitRepo) readIndex() (map[string]indexEntry, string, error) {
+	data, err := os.ReadFile(filepath.Join(r.gitDir, "index"))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]indexEntry{}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) < 12+hashSize || string(data[:4]) != "DIRC" {
+		return nil, "", errors.New("invalid index")
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	count := binary.BigEndian.Uint32(data[8:])
+	if version < 2 || version > 4 {
+		return nil, "", fmt.Errorf("unsupported index version %d", version)
+	}
+
+	entries := make(map[string]indexEntry, count)
+	pos := 12
+	end := len(data) - hashSize
+	prev := ""
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		if pos+62 > end {
+			return nil, "", errors.New("truncated index")
+		}
+		e := indexEntry{
+			mtimeSec:  binary.BigEndian.Uint32(data[pos+8:]),
+			mtimeNsec: binary.BigEndian.Uint32(data[pos+12:]),
+			mode:      binary.BigEndian.Uint32(data[pos+24:]),
+			size:      binary.BigEndian.Uint32(data[pos+36:]),
+			sha:       hex.EncodeToString(data[pos+40 : pos+60]),
+		}
+		flags := binary.BigEndian.Uint16(data[pos+60:])
+		e.stage = int(flags>>12) & 3
+		e.skip = flags&0x8000 != 0
+		pos += 62
+		if version >= 3 && flags&0x4000 != 0 {
+			if pos+2 > end {
+				return nil, "", errors.New("truncated index")
+			}
+			e.skip = e.skip || binary.BigEndian.Uint16(data[pos:])&0x4000 != 0
+			pos += 2
+		}
+
+		var path string
+		if version == 4 {
+			// the path shares a prefix with the previous one
+			strip, n := offsetVarint(data[pos:end])
+			pos += n
+			nul := bytes.IndexByte(data[pos:end], 0)
+			if n == 0 || nul < 0 || int(strip) > len(prev) {
+				return nil, "", errors.New("invalid index entry")
+			}
+			path = prev[:len(prev)-int(strip)] + string(data[pos:pos+nul])
+			pos += nul + 1
+		} else {
+			nul := bytes.IndexByte(data[pos:end], 0)
+			if nul < 0 {
+				return nil, "", errors.New("invalid index entry")
+			}
+			path = string(data[pos : pos+nul])
+			pos = start + (pos+nul-start+8)/8*8
+		}
+		prev = path
+		if _, ok := entries[path]; !ok || e.stage != 0 {
+			entries[path] = e
+		}
+	}
+
+	// extensions follow the entries
+	for pos+8 <= end {
+		signature := string(data[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if pos+size > end {
+			break
+		}
+		if signature == "TREE" {
+			return entries, cachedRootTree(data[pos : pos+size]), nil
+		}
+		pos += size
+	}
+	return entries, "", nil
+}
+
+// cachedRootTree returns the root tree recorded by the cache-tree
+// extension, or "" if it has been invalidated.
+func cachedRootTree(ext []byte) string {
+	// the root comes first: an empty path, the entry count, the number of
+	// subtrees and, for a valid tree, its object name
+	nul := bytes.IndexByte(ext, 0)
+	if nul != 0 {
+		return ""
+	}
+	nl := bytes.IndexByte(ext, '\n')
+	if nl < 0 {
+		return ""
+	}
+	count, _, _ := strings.Cut(string(ext[1:nl]), " ")
+	if n, err := strconv.Atoi(count); err != nil || n < 0 || nl+1+hashSize > len(ext) {
+		return ""
+	}
+	return hex.EncodeToString(ext[nl+1 : nl+1+hashSize])
+}
+
+// offsetVarint decodes the variable length integer used by index version
+// 4 and by offset deltas in packs.
+func offsetVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	c := b[0]
+	value := uint64(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(b) {
+			return 0, 0
+		}
+		c = b[n]
+		n++
+		value = (value+1)<<7 | uint64(c&0x7f)
+	}
+	return value, n
+}
+
+// maxHashBytes bounds how much of the work tree one prompt hashes. A file
+// that does not fit counts as changed; it is hashed by a later prompt,
+// as the hashes are kept.
+const maxHashBytes = 16 << 20
+
+// gitCache keeps what the prompt learnt about repositories between
+// prompts: the index and how it compares with HEAD, which are read again
+// only when the index file or HEAD change, and the hashes of work tree
+// files, which are taken again only when a file changes.
+type gitCache struct {
+	repos map[string]*gitState // by git directory
+}
+
+func newGitCache() *gitCache {
+	return &gitCache{repos: make(map[string]*gitState)}
+}
+
+// gitState is a repository as seen with one index file and HEAD commit.
+type gitState struct {
+	indexTime time.Time
+	indexSize int64
+	commit    string
+
+	entries map[string]indexEntry
+	staged  bool // the index differs from HEAD
+	hashes  map[string]fileHash
+}
+
+// fileHash is the object name of a work tree file when it had the given
+// modification time and size.
+type fileHash struct {
+	mtime time.Time
+	size  int64
+	sha   string
+}
+
+// state returns the state of the repository, reading the index again if
+// it or the HEAD commit have changed since the last call.
+func (gc *gitCache) state(r *gitRepo, commit string) (*gitState, error) {
+	var indexTime time.Time
+	var indexSize int64
+	if info, err := os.Stat(filepath.Join(r.gitDir, "index")); err == nil {
+		indexTime, indexSize = info.ModTime(), info.Size()
+	}
+	if st, ok := gc.repos[r.gitDir]; ok && st.commit == commit && st.indexTime.Equal(indexTime) && st.indexSize == indexSize {
+		return st, nil
+	}
+
+	entries, cachedTree, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	staged, err := r.staged(commit, entries, cachedTree)
+	if err != nil {
+		return nil, err
+	}
+	st := &gitState{
+		indexTime: indexTime,
+		indexSize: indexSize,
+		commit:    commit,
+		entries:   entries,
+		staged:    staged,
+		hashes:    make(map[string]fileHash),
+	}
+	gc.repos[r.gitDir] = st
+	return st, nil
+}
+
+// dirty tells whether the index or the work tree differ from HEAD.
+// Untracked files do not count.
+func (r *gitRepo) dirty(commit string, cache *gitCache) (bool, error) {
+	st, err := cache.state(r, commit)
+	if err != nil {
+		return false, err
+	}
+	if st.staged {
+		return true, nil
+	}
+
+	budget := int64(maxHashBytes)
+	for path, e := range st.entries {
+		if e.skip || e.mode == 0160000 {
+			continue
+		}
+		changed, err := r.worktreeChanged(path, e, st.hashes, &budget)
+		if err != nil || changed {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// staged tells whether the index differs from the commit.
+func (r *gitRepo) staged(commit string, entries map[string]indexEntry, cachedTree string) (bool, error) {
+	for _, e := range entries {
+		if e.stage != 0 {
+			return true, nil // unresolved conflict
+		}
+	}
+	if commit == "" {
+		return len(entries) > 0, nil
+	}
+	tree, err := r.commitTree(commit)
+	if err != nil {
+		return false, err
+	}
+	if tree == cachedTree {
+		return false, nil
+	}
+	files := make(map[string]indexEntry)
+	if err := r.walkTree(tree, "", files); err != nil {
+		return false, err
+	}
+	if len(files) != len(entries) {
+		return true, nil
+	}
+	for path, f := range files {
+		if e, ok := entries[path]; !ok || e.sha != f.sha || e.mode != f.mode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// worktreeChanged compares a file with its index entry. The content is
+// hashed only when the size matches but the modification time does not,
+// and the hash is kept in hashes. Hashing takes from budget; a file larger
+// than what is left of it counts as changed.
+func (r *gitRepo) worktreeChanged(path string, e indexEntry, hashes map[string]fileHash, budget *int64) (bool, error) {
+	full := filepath.Join(r.workTree, filepath.FromSlash(path))
+	info, err := os.Lstat(full)
+	if err != nil {
+		return true, nil
+	}
+
+	switch {
+	case e.mode == 0120000:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return true, nil
+		}
+		target, err := os.Readlink(full)
+		if err != nil {
+			return true, nil
+		}
+		return hashObject("blob", []byte(target)) != e.sha, nil
+	case !info.Mode().IsRegular():
+		return true, nil
+	}
+
+	if (e.mode&0111 != 0) != (info.Mode()&0111 != 0) {
+		return true, nil
+	}
+	// an entry without stat data, as left by read-tree, has size 0
+	if uint32(info.Size()) != e.size && e.size != 0 {
+		return true, nil
+	}
+	mtime := info.ModTime()
+	if uint32(mtime.Unix()) == e.mtimeSec && uint32(mtime.Nanosecond()) == e.mtimeNsec {
+		return false, nil
+	}
+	if h, ok := hashes[path]; ok && h.mtime.Equal(mtime) && h.size == info.Size() {
+		return h.sha != e.sha, nil
+	}
+	if info.Size() > *budget {
+		return true, nil
+	}
+	*budget -= info.Size()
+
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return false, err
+	}
+	sha := hashObject("blob", content)
+	hashes[path] = fileHash{mtime: mtime, size: info.Size(), sha: sha}
+	return sha != e.sha, nil
+}
+
+func hashObject(kind string, content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", kind, len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (r *gitRepo) commitTree(commit string) (string, error) {
+	kind, data, err := r.readObject(commit)
+	if err != nil {
+		return "", err
+	}
+	tree, ok := strings.CutPrefix(string(data), "tree ")
+	if kind != "commit" || !ok || len(tree) < 2*hashSize {
+		return "", fmt.Errorf("object %s is not a commit", commit)
+	}
+	return tree[:2*hashSize], nil
+}
+
+// walkTree collects the files of a tree, with modes as in the index.
+func (r *gitRepo) walkTree(tree, prefix string, files map[string]indexEntry) error {
+	kind, data, err := r.readObject(tree)
+	if err != nil {
+		return err
+	}
+	if kind != "tree" {
+		return fmt.Errorf("object %s is not a tree", tree)
+	}
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || nul+1+hashSize > len(data) {
+			return fmt.Errorf("invalid tree %s", tree)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid tree %s", tree)
+		}
+		path := prefix + string(data[sp+1:nul])
+		sha := hex.EncodeToString(data[nul+1 : nul+1+hashSize])
+		data = data[nul+1+hashSize:]
+
+		if mode == 040000 {
+			if err := r.walkTree(sha, path+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[path] = indexEntry{mode: uint32(mode), sha: sha}
+	}
+	return nil
+}
+
+// readObject returns the type and content of a loose or packed object.
+func (r *gitRepo) readObject(sha string) (string, []byte, error) {
+	objects := filepath.Join(r.commonDir, "objects")
+	if len(sha) == 2*hashSize {
+		if f, err := os.Open(filepath.Join(objects, sha[:2], sha[2:])); err == nil {
+			defer f.Close()
+			return readLooseObject(f)
+		}
+	}
+
+	raw, err := hex.DecodeString(sha)
+	if err != nil || len(raw) != hashSize {
+		return "", nil, fmt.Errorf("invalid object name %q", sha)
+	}
+	if r.packs == nil {
+		r.packs = make(map[string][]byte)
+		indexes, _ := filepath.Glob(filepath.Join(objects, "pack", "pack-*.idx"))
+		for _, idx := range indexes {
+			if data, err := os.ReadFile(idx); err == nil {
+				r.packs[idx] = data
+			}
+		}
+	}
+	for idx, data := range r.packs {
+		offset, ok, err := findInPackIndex(data, raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", idx, err)
+		}
+		if ok {
+			return r.readPackedObject(strings.TrimSuffix(idx, ".idx")+".pack", offset)
+		}
+	}
+	return "", nil, fmt.Errorf("object %s not found", sha)
+}
+
+func readLooseObject(rd io.Reader) (string, []byte, error) {
+	z, err := zlib.NewReader(rd)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+	header, content, ok := bytes.Cut(data, []byte{0})
+	kind, _, _ := strings.Cut(string(header), " ")
+	if !ok {
+		return "", nil, errors.New("invalid object")
+	}
+	return kind, content, nil
+}
+
+// findInPackIndex looks an object up in a version 2 pack index.
+func findInPackIndex(data []byte, sha []byte) (int64, bool, error) {
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte("\xfftOc")) || binary.BigEndian.Uint32(data[4:]) != 2 {
+		return 0, false, errors.New("unsupported pack index")
+	}
+	fanout := data[8:]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	lo := 0
+	if sha[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[(int(sha[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(fanout[int(sha[0])*4:]))
+
+	names := data[8+256*4:]
+	if len(names) < count*hashSize+count*8 || hi > count || lo > hi {
+		return 0, false, errors.New("truncated pack index")
+	}
+	offsets := names[count*hashSize+count*4:]
+	large := offsets[count*4:]
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(names[(lo+i)*hashSize:(lo+i+1)*hashSize], sha) >= 0
+	})
+	if i >= hi || !bytes.Equal(names[i*hashSize:(i+1)*hashSize], sha) {
+		return 0, false, nil
+	}
+
+	offset := binary.BigEndian.Uint32(offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true, nil
+	}
+	n := int(offset &^ 0x80000000)
+	if len(large) < (n+1)*8 {
+		return 0, false, errors.New("truncated pack index")
+	}
+	return int64(binary.BigEndian.Uint64(large[n*8:])), true, nil
+}
+
+var packTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// readPackedObject reads the object at offset, applying deltas.
+func (r *gitRepo) readPackedObject(path string, offset int64) (string, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 32)
+	n, err := f.ReadAt(header, offset)
+	if n == 0 {
+		return "", nil, err
+	}
+	header = header[:n]
+
+	kind := header[0] >> 4 & 7
+	pos := 1
+	for c := header[0]; c&0x80 != 0; pos++ {
+		if pos >= len(header) {
+			return "", nil, errors.New("invalid pack entry")
+		}
+		c = header[pos]
+	}
+
+	var baseKind string
+	var base []byte
+	switch kind {
+	case 6: // delta against an object earlier in the pack
+		rel, n := offsetVarint(header[pos:])
+		if n == 0 {
+			return "", nil, errors.New("invalid pack entry")
+		}
+		pos += n
+		baseKind, base, err = r.readPackedObject(path, offset-int64(rel))
+	case 7: // delta against an object given by name
+		if pos+hashSize > len(header) {
+			return "", nil, errors.New("invalid pack entry")
+		}
+		baseKind, base, err = r.readObject(hex.EncodeToString(header[pos : pos+hashSize]))
+		pos += hashSize
+	default:
+		if packTypes[kind] == "" {
+			return "", nil, fmt.Errorf("unknown pack object type %d", kind)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	z, err := zlib.NewReader(io.NewSectionReader(f, offset+int64(pos), 1<<62))
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+	if base == nil {
+		return packTypes[kind], data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseKind, data, err
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	size := func() (int, bool) {
+		value, shift := 0, 0
+		for len(delta) > 0 {
+			c := delta[0]
+			delta = delta[1:]
+			value |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return value, true
+			}
+		}
+		return 0, false
+	}
+	baseSize, ok1 := size()
+	resultSize, ok2 := size()
+	if !ok1 || !ok2 || baseSize != len(base) {
+		return nil, errInvalid
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			// insert the next op bytes
+			if op == 0 || int(op) > len(delta) {
+				return nil, errInvalid
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		// copy from the base; the bits of op tell which bytes follow
+		var offset, length int
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errInvalid
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				length |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if length == 0 {
+			length = 0x10000
+		}
+		if offset+length > len(base) {
+			return nil, errInvalid
+		}
+		result = append(result, base[offset:offset+length]...)
+	}
+	if len(result) != resultSize {
+		return nil, errInvalid
+	}
+	return result, nil
+}
+
+// gitSegment returns the branch and a "*" when there are changes, or ""
+// outside of a repository.
+func gitSegment(dir string, cache *gitCache) string {
+	repo, ok := findGitRepo(dir)
+	if !ok {
+		return ""
+	}
+	name, commit, err := repo.head()
+	if err != nil {
+		return ""
+	}
+	if dirty, err := repo.dirty(commit, cache); err == nil && dirty {
+		return name + "*"
+	}
+	return name
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitFixture makes a repository on branch main with two commits, the
+// second changing one line of a.txt, so that a repack stores a.txt as a
+// delta. It skips the test when there is no git binary. The returned
+// function runs git in the repository and returns its output.
+func gitFixture(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_AUTHOR_DATE=2024-03-05T14:07:09Z",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_COMMITTER_DATE=2024-03-05T14:07:09Z")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of a file that is long enough to be stored as a delta", i))
+	}
+	writeFile(t, dir, "a.txt", strings.Join(lines, "\n")+"\n")
+	writeFile(t, dir, "dir/b.txt", "b\n")
+	writeFile(t, dir, "run.sh", "#!/bin/sh\n")
+	os.Chmod(filepath.Join(dir, "run.sh"), 0755)
+	os.Symlink("a.txt", filepath.Join(dir, "link"))
+
+	run("init", "-q", "-b", "main")
+	run("add", ".")
+	run("commit", "-q", "-m", "first")
+	lines[100] = "a changed line"
+	writeFile(t, dir, "a.txt", strings.Join(lines, "\n")+"\n")
+	run("commit", "-q", "-a", "-m", "second")
+	return dir, run
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitSegment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		setup    func(dir string, run func(args ...string) string)
+		expected string
+	}{
+		{"clean", func(dir string, run func(...string) string) {}, "main"},
+		{"packed", func(dir string, run func(...string) string) {
+			run("repack", "-q", "-a", "-d", "-f")
+			run("prune-packed")
+			run("pack-refs", "--all")
+		}, "main"},
+		{"index version 4", func(dir string, run func(...string) string) {
+			run("update-index", "--index-version", "4")
+		}, "main"},
+		{"subdirectory", func(dir string, run func(...string) string) {}, "main"},
+		{"touched", func(dir string, run func(...string) string) {
+			future := time.Now().Add(time.Hour)
+			os.Chtimes(filepath.Join(dir, "a.txt"), future, future)
+		}, "main"},
+		{"same size", func(dir string, run func(...string) string) {
+			writeFile(t, dir, "dir/b.txt", "c\n")
+		}, "main*"},
+		{"appended", func(dir string, run func(...string) string) {
+			writeFile(t, dir, "dir/b.txt", "b\nc\n")
+		}, "main*"},
+		{"deleted", func(dir string, run func(...string) string) {
+			os.Remove(filepath.Join(dir, "dir", "b.txt"))
+		}, "main*"},
+		{"mode", func(dir string, run func(...string) string) {
+			os.Chmod(filepath.Join(dir, "run.sh"), 0644)
+		}, "main*"},
+		{"symlink", func(dir string, run func(...string) string) {
+			os.Remove(filepath.Join(dir, "link"))
+			os.Symlink("run.sh", filepath.Join(dir, "link"))
+		}, "main*"},
+		{"staged", func(dir string, run func(...string) string) {
+			writeFile(t, dir, "new.txt", "new\n")
+			run("add", "new.txt")
+		}, "main*"},
+		{"untracked", func(dir string, run func(...string) string) {
+			writeFile(t, dir, "new.txt", "new\n")
+		}, "main"},
+		{"branch", func(dir string, run func(...string) string) {
+			run("checkout", "-q", "-b", "feature/x")
+		}, "feature/x"},
+		{"detached", func(dir string, run func(...string) string) {
+			run("checkout", "-q", "--detach", "HEAD~1")
+		}, "detached"},
+		{"detached and packed", func(dir string, run func(...string) string) {
+			run("checkout", "-q", "--detach", "HEAD~1")
+			run("repack", "-q", "-a", "-d", "-f")
+			run("prune-packed")
+		}, "detached"},
+		{"detached and dirty", func(dir string, run func(...string) string) {
+			run("checkout", "-q", "--detach", "HEAD~1")
+			writeFile(t, dir, "dir/b.txt", "c\n")
+		}, "detached*"},
+	}
+
+	for _, tc := range testCases {
+		dir, run := gitFixture(t)
+		tc.setup(dir, run)
+		expected := tc.expected
+		if strings.HasPrefix(expected, "detached") {
+			expected = strings.Replace(expected, "detached", run("rev-parse", "--short=7", "HEAD"), 1)
+		}
+		if tc.name == "subdirectory" {
+			dir = filepath.Join(dir, "dir")
+		}
+		if result := gitSegment(dir, newGitCache()); result != expected {
+			t.Errorf("expected %q, got %q for %s", expected, result, tc.name)
+		}
+	}
+
+	if result := gitSegment(t.TempDir(), newGitCache()); result != "" {
+		t.Errorf("expected nothing outside of a repository, got %q", result)
+	}
+}
+
+func TestGitSegmentWithoutCommits(t *testing.T) {
+	dir, run := gitFixture(t)
+	os.RemoveAll(filepath.Join(dir, ".git"))
+	run("init", "-q", "-b", "main")
+	if result := gitSegment(dir, newGitCache()); result != "main" {
+		t.Errorf("expected %q, got %q", "main", result)
+	}
+	run("add", "a.txt")
+	if result := gitSegment(dir, newGitCache()); result != "main*" {
+		t.Errorf("expected %q, got %q", "main*", result)
+	}
+}
+
+// TestGitReadObject reads every object of packs with offset and with
+// reference deltas and compares it with what git reads.
+func TestGitReadObject(t *testing.T) {
+	for _, offsets := range []string{"true", "false"} {
+		dir, run := gitFixture(t)
+		run("-c", "repack.useDeltaBaseOffset="+offsets, "repack", "-q", "-a", "-d", "-f")
+		run("prune-packed")
+
+		packs, _ := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+		if len(packs) != 1 {
+			t.Fatalf("expected one pack, got %v", packs)
+		}
+		deltas := 0
+		for _, line := range strings.Split(run("verify-pack", "-v", packs[0]), "\n") {
+			// a delta has its depth and base after the offset
+			if fields := strings.Fields(line); len(fields) == 7 && len(fields[0]) == 2*hashSize {
+				deltas++
+			}
+		}
+		if deltas == 0 {
+			t.Fatalf("expected deltas in the pack with offsets %s", offsets)
+		}
+
+		repo, ok := findGitRepo(dir)
+		if !ok {
+			t.Fatal("repository not found")
+		}
+		for _, line := range strings.Split(run("rev-list", "--objects", "--all"), "\n") {
+			sha, _, _ := strings.Cut(line, " ")
+			kind, data, err := repo.readObject(sha)
+			if err != nil {
+				t.Errorf("unexpected error for %s with offsets %s: %v", sha, offsets, err)
+				continue
+			}
+			if expected := run("cat-file", "-t", sha); kind != expected {
+				t.Errorf("expected %q, got %q for the type of %s", expected, kind, sha)
+			}
+			if hashObject(kind, data) != sha {
+				t.Errorf("wrong content for %s with offsets %s", sha, offsets)
+			}
+		}
+	}
+}
+
+func TestGitCache(t *testing.T) {
+	dir, run := gitFixture(t)
+	cache := newGitCache()
+	if result := gitSegment(dir, cache); result != "main" {
+		t.Fatalf("expected %q, got %q", "main", result)
+	}
+
+	// the index changes: the comparison with HEAD is made again
+	writeFile(t, dir, "dir/b.txt", "c\n")
+	run("add", "dir/b.txt")
+	if result := gitSegment(dir, cache); result != "main*" {
+		t.Errorf("expected %q after add, got %q", "main*", result)
+	}
+	run("commit", "-q", "-m", "third")
+	if result := gitSegment(dir, cache); result != "main" {
+		t.Errorf("expected %q after commit, got %q", "main", result)
+	}
+
+	// a touched file is hashed once, and not at all past the budget
+	repo, _ := findGitRepo(dir)
+	st, err := cache.state(repo, run("rev-parse", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a.txt")
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+
+	budget := int64(10)
+	if changed, _ := repo.worktreeChanged("a.txt", st.entries["a.txt"], st.hashes, &budget); !changed || budget != 10 {
+		t.Errorf("expected a file past the budget to count as changed, got %v with budget %d", changed, budget)
+	}
+	budget = maxHashBytes
+	if changed, err := repo.worktreeChanged("a.txt", st.entries["a.txt"], st.hashes, &budget); changed || err != nil {
+		t.Errorf("expected a touched file to be unchanged, got %v (%v)", changed, err)
+	}
+	if _, ok := st.hashes["a.txt"]; !ok || budget == maxHashBytes {
+		t.Errorf("expected the hash to be kept and the budget used, got %v with budget %d", st.hashes, budget)
+	}
+
+	// the same time and size are taken for the same content
+	data, _ := os.ReadFile(path)
+	data[0] = 'X'
+	os.WriteFile(path, data, 0644)
+	os.Chtimes(path, future, future)
+	budget = 0
+	if changed, err := repo.worktreeChanged("a.txt", st.entries["a.txt"], st.hashes, &budget); changed || err != nil {
+		t.Errorf("expected the kept hash to be used, got %v (%v)", changed, err)
+	}
+}
@@ -2,7 +2,11 @@ module 2.9
 
 go 1.23.0
 
-require github.com/shirou/gopsutil v3.21.11+incompatible
+require (
+	github.com/shirou/gopsutil v3.21.11+incompatible
+	golang.org/x/sys v0.26.0
+	golang.org/x/term v0.25.0
+)
 
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
@@ -10,5 +14,4 @@ require (
 	github.com/tklauser/go-sysconf v0.3.14 // indirect
 	github.com/tklauser/numcpus v0.8.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.26.0 // indirect
 )
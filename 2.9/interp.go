@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// loopControl is returned by break and continue and unwinds the lists up
+// to the enclosing loop.
+type loopControl struct {
+	stop   bool // break rather than continue
+	levels int
+}
+
+func (e *loopControl) Error() string {
+	if e.stop {
+		return "break: only meaningful in a loop"
+	}
+	return "continue: only meaningful in a loop"
+}
+
+// isControl tells whether err is break, continue, return or exit.
+func isControl(err error) bool {
+	var lc *loopControl
+	var rc *returnControl
+	var ec *exitControl
+	return errors.As(err, &lc) || errors.As(err, &rc) || errors.As(err, &ec)
+}
+
+// controlStatus is the value of $? after break, continue, return or exit.
+func controlStatus(err error) int {
+	var rc *returnControl
+	var ec *exitControl
+	switch {
+	case errors.As(err, &rc):
+		return rc.code
+	case errors.As(err, &ec):
+		return ec.code
+	}
+	return 0
+}
+
+// runList executes the and-or lists one after another. Errors of commands
+// are reported right away and only end up in $?; the returned error is
+// reserved for break, continue, return and exit.
+func (sh *Shell) runList(l *List, stdin, stdout *os.File) error {
+	for _, andOr := range l.Items {
+		if err := sh.runAndOr(andOr, stdin, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) runAndOr(andOr *AndOr, stdin, stdout *os.File) error {
+	if err := sh.runNode(andOr.Nodes[0], stdin, stdout); err != nil {
+		return err
+	}
+	for i, op := range andOr.Ops {
+		if (op == "&&") != (sh.status == 0) {
+			continue
+		}
+		if err := sh.runNode(andOr.Nodes[i+1], stdin, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) runNode(node Node, stdin, stdout *os.File) error {
+	switch n := node.(type) {
+	case *Pipeline:
+		err := sh.runPipeline(n, stdin, stdout)
+		if isControl(err) {
+			sh.status = controlStatus(err)
+			if len(n.Commands) > 1 {
+				// the commands of a pipeline run as if in a subshell
+				return nil
+			}
+			return err
+		}
+		reportError(sh.stderr, err)
+		sh.status = exitStatus(err)
+		if n.Negate {
+			if sh.status == 0 {
+				sh.status = 1
+			} else {
+				sh.status = 0
+			}
+		}
+		return nil
+	case *IfClause:
+		return sh.runIf(n, stdin, stdout)
+	case *LoopClause:
+		return sh.runLoop(n, stdin, stdout)
+	case *ForClause:
+		return sh.runFor(n, stdin, stdout)
+	case *Group:
+		return sh.runList(n.Body, stdin, stdout)
+	case *FuncDef:
+		sh.functions.define(n)
+		sh.status = 0
+		return nil
+	}
+	return fmt.Errorf("unknown node %T", node)
+}
+
+func (sh *Shell) runIf(n *IfClause, stdin, stdout *os.File) error {
+	for i, cond := range n.Conds {
+		if err := sh.runList(cond, stdin, stdout); err != nil {
+			return err
+		}
+		if sh.status == 0 {
+			return sh.runList(n.Bodies[i], stdin, stdout)
+		}
+	}
+	if n.Else != nil {
+		return sh.runList(n.Else, stdin, stdout)
+	}
+	sh.status = 0
+	return nil
+}
+
+// loopBody runs one iteration and tells whether the loop should go on.
+// A break or continue for an outer loop is passed up with one level less.
+func (sh *Shell) loopBody(body *List, stdin, stdout *os.File) (bool, error) {
+	err := sh.runList(body, stdin, stdout)
+	var lc *loopControl
+	if !errors.As(err, &lc) {
+		return true, err
+	}
+	if lc.levels > 1 {
+		return false, &loopControl{stop: lc.stop, levels: lc.levels - 1}
+	}
+	return !lc.stop, nil
+}
+
+func (sh *Shell) runLoop(n *LoopClause, stdin, stdout *os.File) error {
+	status := 0
+	for {
+		if err := sh.runList(n.Cond, stdin, stdout); err != nil {
+			return err
+		}
+		if (sh.status == 0) == n.Until {
+			break
+		}
+		more, err := sh.loopBody(n.Body, stdin, stdout)
+		status = sh.status
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	sh.status = status
+	return nil
+}
+
+func (sh *Shell) runFor(n *ForClause, stdin, stdout *os.File) error {
+	items := sh.positional
+	if n.In {
+		var err error
+		items, err = sh.expandWords(n.Words)
+		if err != nil {
+			reportError(sh.stderr, err)
+			sh.status = 1
+			return nil
+		}
+	}
+
+	sh.status = 0
+	for _, item := range items {
+		sh.vars.set(n.Name, item)
+		more, err := sh.loopBody(n.Body, stdin, stdout)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+func loopLevels(cmd []string) (int, error) {
+	if len(cmd) < 2 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(cmd[1])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s: %s: loop count out of range", cmd[0], cmd[1])
+	}
+	return n, nil
+}
+
+func (sh *Shell) breakCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	n, err := loopLevels(cmd)
+	if err != nil {
+		return err
+	}
+	return &loopControl{stop: true, levels: n}
+}
+
+func (sh *Shell) continueCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	n, err := loopLevels(cmd)
+	if err != nil {
+		return err
+	}
+	return &loopControl{levels: n}
+}
+
+func (sh *Shell) trueCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return nil
+}
+
+func (sh *Shell) falseCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return &statusError{code: 1}
+}
+
+func (sh *Shell) shiftCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	n := 1
+	if len(cmd) > 1 {
+		var err error
+		n, err = strconv.Atoi(cmd[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("shift: %s: numeric argument required", cmd[1])
+		}
+	}
+	if n > len(sh.positional) {
+		return &statusError{code: 1}
+	}
+	sh.positional = sh.positional[n:]
+	return nil
+}
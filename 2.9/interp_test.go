@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunList(t *testing.T) {
+
+	testCases := []struct {
+		input    string
+		expected string
+		status   int
+	}{
+		{"echo a; echo b", "a\nb\n", 0},
+		{"true && echo yes || echo no", "yes\n", 0},
+		{"false && echo yes || echo no", "no\n", 0},
+		{"false || false && echo unreachable", "", 1},
+		{"! false && echo negated", "negated\n", 0},
+		{"false; echo $?", "1\n", 0},
+		{"if false; then echo a; elif true; then echo b; else echo c; fi", "b\n", 0},
+		{"if false\nthen\n  echo a\nfi", "", 0},
+		{"for x in 1 2 3; do echo $x; done", "1\n2\n3\n", 0},
+		{"for x in a b\ndo\n  for y in 1 2; do echo $x$y; done\ndone", "a1\na2\nb1\nb2\n", 0},
+		{`for p; do echo "[$p]"; done`, "[one]\n[two words]\n", 0},
+		{`for p in "$@"; do echo "[$p]"; done; echo $# $1`, "[one]\n[two words]\n2 one\n", 0},
+		{"I=x; while test $I != xxx; do I=${I}x; done; echo $I", "xxx\n", 0},
+		{"I=; until test \"$I\" = xx; do I=${I}x; echo $I; done", "x\nxx\n", 0},
+		{"for x in 1 2 3 4; do if test $x = 3; then break; fi; echo $x; done", "1\n2\n", 0},
+		{"for x in 1 2 3; do if test $x = 2; then continue; fi; echo $x; done", "1\n3\n", 0},
+		{"for x in a b; do for y in 1 2; do break 2; done; echo $x; done; echo end", "end\n", 0},
+		{"echo $(for x in a b; do echo $x; done)", "a b\n", 0},
+		{"# comment\necho a # trailing\n\n", "a\n", 0},
+		{"echo a \\\n  b", "a b\n", 0},
+		{`f() { echo "[$1]" $#; }; f a "b c"; echo $1`, "[a] 2\none\n", 0},
+		{"f() { return 3; echo no; }; f; echo $?", "3\n", 0},
+		{"f() { for x in a b; do echo $x; return; done; }; f && echo ok", "a\nok\n", 0},
+		{"function up { tr a-z A-Z; }\necho abc | up", "ABC\n", 0},
+		{"{ echo a; false; }", "a\n", 1},
+		{"echo $(exit 5; echo no) $?", "5\n", 0},
+		{"exit 7 | cat; echo $?", "0\n", 0},
+	}
+
+	for _, tc := range testCases {
+		list, err := parseInput(tc.input)
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+
+		dir := t.TempDir()
+		out, err := os.Create(filepath.Join(dir, "out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sh := newShell(os.Stdin, out, os.Stderr, []string{"PATH=" + os.Getenv("PATH")}, dir)
+		sh.positional = []string{"one", "two words"}
+		err = sh.runList(list, sh.stdin, sh.stdout)
+		out.Close()
+		result, _ := os.ReadFile(out.Name())
+
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+		} else if string(result) != tc.expected || sh.status != tc.status {
+			t.Errorf("expected %q (status %d), got %q (status %d) for input %q", tc.expected, tc.status, result, sh.status, tc.input)
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	testCases := []struct {
+		input  string
+		status int
+	}{
+		{"exit 3; echo no", 3},
+		{"false; exit", 1},
+		{"for x in a b; do f() { exit 300; }; f; done", 44},
+		{"exit abc", 2},
+	}
+
+	for _, tc := range testCases {
+		sh := newShell(os.Stdin, os.Stdout, os.Stderr, nil, t.TempDir())
+		err := sh.execute(tc.input)
+		var exit *exitControl
+		if !errors.As(err, &exit) || sh.status != tc.status {
+			t.Errorf("expected exit with status %d, got %v (status %d) for input %q", tc.status, err, sh.status, tc.input)
+		}
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	testCases := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"if true; then", true},
+		{"for x in a b; do echo $x", true},
+		{"while true", true},
+		{"echo a &&", true},
+		{"echo a |", true},
+		{`echo "a`, true},
+		{"echo a \\", true},
+		{"fi", false},
+		{"if true; fi", false},
+		{"echo a;;", false},
+		{"echo a && &", false},
+		{"for 1 in a; do :; done", false},
+		{"if true; then :; fi | cat", false},
+		{"f() {", true},
+		{"f() echo a", false},
+		{"{ echo a; } | cat", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := parseInput(tc.input)
+		if err == nil {
+			t.Errorf("expected error for input %q, but got none", tc.input)
+		} else if isIncomplete(err) != tc.incomplete {
+			t.Errorf("expected incomplete=%v for input %q, got %v", tc.incomplete, tc.input, err)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	aliases := newAliasTable()
+	aliases.set("ll", "echo long")
+	aliases.set("ls", "ls -l")
+	aliases.set("sudo", "command ")
+	aliases.set("again", "ll")
+
+	testCases := []struct {
+		input    string
+		expected []string
+		text     string
+	}{
+		{"ll a", []string{"echo", "long", "a"}, "ll a"},
+		{"ls /tmp", []string{"ls", "-l", "/tmp"}, "ls /tmp"},
+		{"again", []string{"echo", "long"}, "again"},
+		{"sudo ll", []string{"command", "echo", "long"}, "sudo ll"},
+		{"echo ll", []string{"echo", "ll"}, "echo ll"},
+		{"'ll' x", []string{"ll", "x"}, "'ll' x"},
+		{"FOO=1 ll", []string{"echo", "long"}, "FOO=1 ll"},
+	}
+
+	for _, tc := range testCases {
+		list, err := parseWithAliases(tc.input, aliases)
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+		pipeline := list.Items[0].Nodes[0].(*Pipeline)
+		var args []string
+		for _, w := range pipeline.Commands[0].Args {
+			args = append(args, w[0].text)
+		}
+		if !reflect.DeepEqual(args, tc.expected) || pipeline.Text != tc.text {
+			t.Errorf("expected %q (%q), got %q (%q) for input %q", tc.expected, tc.text, args, pipeline.Text, tc.input)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+type jobProcess struct {
+	pid   int // 0 for built-ins
+	state jobState
+	err   error
+}
+
+// job is a pipeline started by the shell. Its fields are guarded by the
+// mutex of the job table.
+type job struct {
+	id    int // 0 until the job enters the table
+	pgid  int
+	text  string
+	procs []*jobProcess
+	state jobState
+	err   error // result of the last command
+}
+
+func (j *job) update() {
+	running, stopped := false, false
+	for _, p := range j.procs {
+		switch p.state {
+		case jobRunning:
+			running = true
+		case jobStopped:
+			stopped = true
+		}
+	}
+
+	switch {
+	case running:
+		j.state = jobRunning
+	case stopped:
+		j.state = jobStopped
+	default:
+		j.state = jobDone
+		j.err = j.procs[len(j.procs)-1].err
+	}
+}
+
+func (j *job) status() string {
+	switch j.state {
+	case jobRunning:
+		return "Running"
+	case jobStopped:
+		return "Stopped"
+	}
+	if code := exitStatus(j.err); code != 0 {
+		return fmt.Sprintf("Exit %d", code)
+	}
+	return "Done"
+}
+
+// reportStages prints the errors of all commands but the last one, whose
+// result is returned to the caller.
+func (j *job) reportStages(w io.Writer) {
+	for _, p := range j.procs[:len(j.procs)-1] {
+		if !isControl(p.err) {
+			reportError(w, p.err)
+		}
+	}
+}
+
+type jobTable struct {
+	jobs     []*job
+	current  *job
+	previous *job
+	fgJob    *job
+	stderr   io.Writer // for the notices of the foreground jobs
+	mutex    *sync.Mutex
+	cond     *sync.Cond
+}
+
+func newJobTable(stderr io.Writer) *jobTable {
+	mutex := &sync.Mutex{}
+	return &jobTable{stderr: stderr, mutex: mutex, cond: sync.NewCond(mutex)}
+}
+
+func (jt *jobTable) add(j *job) {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	jt.addLocked(j)
+}
+
+func (jt *jobTable) addLocked(j *job) {
+	j.id = 1
+	if len(jt.jobs) > 0 {
+		j.id = jt.jobs[len(jt.jobs)-1].id + 1
+	}
+	jt.jobs = append(jt.jobs, j)
+	jt.setCurrent(j)
+}
+
+func (jt *jobTable) setCurrent(j *job) {
+	if jt.current != j {
+		jt.previous = jt.current
+		jt.current = j
+	}
+}
+
+func (jt *jobTable) removeLocked(j *job) {
+	for i, other := range jt.jobs {
+		if other == j {
+			jt.jobs = append(jt.jobs[:i], jt.jobs[i+1:]...)
+			break
+		}
+	}
+	if jt.current == j {
+		jt.current = jt.previous
+		jt.previous = nil
+	}
+	if jt.previous == j {
+		jt.previous = nil
+	}
+	if jt.previous == nil {
+		for i := len(jt.jobs) - 1; i >= 0; i-- {
+			if jt.jobs[i] != jt.current {
+				jt.previous = jt.jobs[i]
+				break
+			}
+		}
+	}
+	if jt.current == nil {
+		jt.current, jt.previous = jt.previous, nil
+	}
+}
+
+func (jt *jobTable) marker(j *job) string {
+	switch j {
+	case jt.current:
+		return "+"
+	case jt.previous:
+		return "-"
+	}
+	return " "
+}
+
+// finish records the result of a command that does not need waiting for.
+func (jt *jobTable) finish(j *job, proc *jobProcess, err error) {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	proc.state = jobDone
+	proc.err = err
+	j.update()
+	jt.cond.Broadcast()
+}
+
+// watch makes the process the group leader if the job has none yet and
+// follows its state changes until it exits.
+func (jt *jobTable) watch(j *job, proc *jobProcess, p *os.Process) {
+	jt.mutex.Lock()
+	proc.pid = p.Pid
+	if j.pgid == 0 {
+		j.pgid = p.Pid
+	}
+	jt.mutex.Unlock()
+
+	go func() {
+		for {
+			state, err := waitProcess(p)
+
+			jt.mutex.Lock()
+			proc.state = state
+			proc.err = err
+			j.update()
+			jt.cond.Broadcast()
+			jt.mutex.Unlock()
+
+			if state == jobDone {
+				return
+			}
+		}
+	}()
+}
+
+// foreground gives the terminal to the job and waits until it finishes or
+// stops. A stopped job is kept in the table.
+func (jt *jobTable) foreground(j *job, resume bool) error {
+	jt.mutex.Lock()
+	jt.fgJob = j
+	if resume {
+		for _, p := range j.procs {
+			if p.state == jobStopped {
+				p.state = jobRunning
+			}
+		}
+		j.update()
+	}
+	pgid := j.pgid
+	jt.mutex.Unlock()
+
+	setTerminalForeground(pgid)
+	if resume {
+		continueGroup(pgid)
+	}
+
+	jt.mutex.Lock()
+	for j.state == jobRunning {
+		jt.cond.Wait()
+	}
+	jt.fgJob = nil
+	stopped := j.state == jobStopped
+	if stopped {
+		if j.id == 0 {
+			jt.addLocked(j)
+		} else {
+			jt.setCurrent(j)
+		}
+	} else if j.id != 0 {
+		jt.removeLocked(j)
+	}
+	err := j.err
+	id := j.id
+	jt.mutex.Unlock()
+
+	takeTerminal()
+	if stopped {
+		fmt.Fprintf(jt.stderr, "\n[%d]+  %-24s%s\n", id, "Stopped", j.text)
+		return errJobStopped
+	}
+	j.reportStages(jt.stderr)
+	return err
+}
+
+// wait blocks until the job is no longer running.
+func (jt *jobTable) wait(j *job) error {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	for j.state == jobRunning {
+		jt.cond.Wait()
+	}
+	return j.err
+}
+
+func (jt *jobTable) signalForeground(sig syscall.Signal) {
+	jt.mutex.Lock()
+	j := jt.fgJob
+	var pgid int
+	if j != nil {
+		pgid = j.pgid
+	}
+	jt.mutex.Unlock()
+
+	if pgid != 0 {
+		signalGroup(pgid, sig)
+	}
+}
+
+// signal sends sig to the job. Without job control its processes share
+// the group of the shell, so they are signalled one by one. A stopped job
+// is continued after SIGTERM or SIGHUP so that it can act on them.
+func (jt *jobTable) signal(j *job, sig syscall.Signal) error {
+	jt.mutex.Lock()
+	pgid, stopped := j.pgid, j.state == jobStopped
+	var pids []int
+	for _, p := range j.procs {
+		if p.pid != 0 && p.state != jobDone {
+			pids = append(pids, p.pid)
+		}
+	}
+	jt.mutex.Unlock()
+
+	if len(pids) == 0 {
+		return fmt.Errorf("job has terminated")
+	}
+	if jobControl {
+		if err := signalGroup(pgid, sig); err != nil {
+			return err
+		}
+		if stopped && (sig == syscall.SIGTERM || sig == syscall.SIGHUP) {
+			return continueGroup(pgid)
+		}
+		return nil
+	}
+	for _, pid := range pids {
+		if err := signalProcess(pid, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (jt *jobTable) hasStopped() bool {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	for _, j := range jt.jobs {
+		if j.state == jobStopped {
+			return true
+		}
+	}
+	return false
+}
+
+// notify prints and forgets the background jobs that have finished.
+func (jt *jobTable) notify(w io.Writer) {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	for _, j := range append([]*job(nil), jt.jobs...) {
+		if j.state == jobDone {
+			fmt.Fprintf(w, "[%d]%s  %-24s%s\n", j.id, jt.marker(j), j.status(), j.text)
+			jt.removeLocked(j)
+		}
+	}
+}
+
+// lookup resolves a job spec: %N, %%, %+, %-, %prefix, %?substring or a
+// bare job number.
+func (jt *jobTable) lookup(spec string) (*job, error) {
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	switch spec {
+	case "", "%", "%%", "%+":
+		if jt.current == nil {
+			return nil, fmt.Errorf("no current job")
+		}
+		return jt.current, nil
+	case "%-":
+		if jt.previous == nil {
+			return nil, fmt.Errorf("no previous job")
+		}
+		return jt.previous, nil
+	}
+
+	name := strings.TrimPrefix(spec, "%")
+	if id, err := strconv.Atoi(name); err == nil {
+		for _, j := range jt.jobs {
+			if j.id == id {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	if !strings.HasPrefix(spec, "%") {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	var found *job
+	for _, j := range jt.jobs {
+		var match bool
+		if sub, ok := strings.CutPrefix(name, "?"); ok {
+			match = strings.Contains(j.text, sub)
+		} else {
+			match = strings.HasPrefix(j.text, name)
+		}
+		if match {
+			if found != nil {
+				return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+			}
+			found = j
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+func (sh *Shell) jobsCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	long, pidsOnly := false, false
+	for _, arg := range cmd[1:] {
+		switch arg {
+		case "-l":
+			long = true
+		case "-p":
+			pidsOnly = true
+		default:
+			return fmt.Errorf("jobs: usage: jobs [-l|-p]")
+		}
+	}
+
+	sh.jobs.mutex.Lock()
+	defer sh.jobs.mutex.Unlock()
+
+	for _, j := range append([]*job(nil), sh.jobs.jobs...) {
+		text := j.text
+		if j.state == jobRunning {
+			text += " &"
+		}
+		switch {
+		case pidsOnly:
+			fmt.Fprintln(stdout, j.pgid)
+		case long:
+			fmt.Fprintf(stdout, "[%d]%s %d %-24s%s\n", j.id, sh.jobs.marker(j), j.pgid, j.status(), text)
+		default:
+			fmt.Fprintf(stdout, "[%d]%s  %-24s%s\n", j.id, sh.jobs.marker(j), j.status(), text)
+		}
+		if j.state == jobDone {
+			sh.jobs.removeLocked(j)
+		}
+	}
+	return nil
+}
+
+func jobSpec(cmd []string) string {
+	if len(cmd) > 1 {
+		return cmd[1]
+	}
+	return ""
+}
+
+func (sh *Shell) fgCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	j, err := sh.jobs.lookup(jobSpec(cmd))
+	if err != nil {
+		return fmt.Errorf("fg: %v", err)
+	}
+	fmt.Fprintln(stdout, j.text)
+	return sh.jobs.foreground(j, true)
+}
+
+func (sh *Shell) bgCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	j, err := sh.jobs.lookup(jobSpec(cmd))
+	if err != nil {
+		return fmt.Errorf("bg: %v", err)
+	}
+
+	sh.jobs.mutex.Lock()
+	if j.state == jobDone {
+		sh.jobs.mutex.Unlock()
+		return fmt.Errorf("bg: job has terminated")
+	}
+	for _, p := range j.procs {
+		if p.state == jobStopped {
+			p.state = jobRunning
+		}
+	}
+	j.update()
+	sh.jobs.setCurrent(j)
+	sh.jobs.mutex.Unlock()
+
+	fmt.Fprintf(stdout, "[%d]+ %s &\n", j.id, j.text)
+	return continueGroup(j.pgid)
+}
+
+func (sh *Shell) waitCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(cmd) == 1 {
+		sh.jobs.mutex.Lock()
+		pending := append([]*job(nil), sh.jobs.jobs...)
+		sh.jobs.mutex.Unlock()
+
+		for _, j := range pending {
+			sh.jobs.wait(j)
+		}
+		return nil
+	}
+
+	var err error
+	for _, spec := range cmd[1:] {
+		j, lookupErr := sh.jobs.lookupPid(spec)
+		if lookupErr != nil {
+			return fmt.Errorf("wait: %v", lookupErr)
+		}
+		err = sh.jobs.wait(j)
+	}
+	return err
+}
+
+// lookupPid resolves a job spec or the pid of one of the job's processes.
+func (jt *jobTable) lookupPid(spec string) (*job, error) {
+	if strings.HasPrefix(spec, "%") {
+		return jt.lookup(spec)
+	}
+	pid, err := strconv.Atoi(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a pid or valid job spec", spec)
+	}
+
+	jt.mutex.Lock()
+	defer jt.mutex.Unlock()
+
+	for _, j := range jt.jobs {
+		for _, p := range j.procs {
+			if p.pid == pid {
+				return j, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// newTestJobs fills a job table with a job per text, all running, each
+// with one process whose pid is 100 times its job number.
+func newTestJobs(texts ...string) (*jobTable, []*job) {
+	jt := newJobTable(io.Discard)
+	var jobs []*job
+	for i, text := range texts {
+		j := &job{pgid: 100 * (i + 1), text: text, procs: []*jobProcess{{pid: 100 * (i + 1)}}}
+		jt.add(j)
+		jobs = append(jobs, j)
+	}
+	return jt, jobs
+}
+
+func TestJobLookup(t *testing.T) {
+	jt, jobs := newTestJobs("sleep 100", "vim notes.txt", "sleep 200 | grep x")
+
+	testCases := []struct {
+		spec     string
+		expected int // index in jobs, -1 for an error
+	}{
+		{"", 2},
+		{"%", 2},
+		{"%%", 2},
+		{"%+", 2},
+		{"%-", 1},
+		{"%1", 0},
+		{"%3", 2},
+		{"2", 1},
+		{"%4", -1},
+		{"%vim", 1},
+		{"%sleep", -1}, // ambiguous
+		{"%sleep 1", 0},
+		{"%?grep", 2},
+		{"%?notes", 1},
+		{"%?100", 0},
+		{"%?", -1}, // ambiguous
+		{"%emacs", -1},
+		{"%?emacs", -1},
+		{"vim", -1},
+	}
+
+	for _, tc := range testCases {
+		j, err := jt.lookup(tc.spec)
+		if tc.expected < 0 {
+			if err == nil {
+				t.Errorf("expected error for %q, got job %d", tc.spec, j.id)
+			}
+			continue
+		}
+		if err != nil || j != jobs[tc.expected] {
+			t.Errorf("expected job %d, got %v (%v) for %q", jobs[tc.expected].id, j, err, tc.spec)
+		}
+	}
+
+	empty := newJobTable(io.Discard)
+	for _, spec := range []string{"%+", "%-", "%1"} {
+		if _, err := empty.lookup(spec); err == nil {
+			t.Errorf("expected error for %q in an empty table", spec)
+		}
+	}
+}
+
+func TestJobLookupPid(t *testing.T) {
+	jt, jobs := newTestJobs("sleep 100", "vim")
+	jobs[1].procs = append(jobs[1].procs, &jobProcess{pid: 201})
+
+	testCases := []struct {
+		spec     string
+		expected int
+	}{
+		{"100", 0},
+		{"201", 1},
+		{"%1", 0},
+		{"%-", 0},
+		{"300", -1},
+		{"x", -1},
+	}
+	for _, tc := range testCases {
+		j, err := jt.lookupPid(tc.spec)
+		if tc.expected < 0 {
+			if err == nil {
+				t.Errorf("expected error for %q, got job %d", tc.spec, j.id)
+			}
+			continue
+		}
+		if err != nil || j != jobs[tc.expected] {
+			t.Errorf("expected job %d, got %v (%v) for %q", jobs[tc.expected].id, j, err, tc.spec)
+		}
+	}
+}
+
+// TestJobCurrentPrevious follows %+ and %- as jobs are added, brought back
+// and removed.
+func TestJobCurrentPrevious(t *testing.T) {
+	jt, jobs := newTestJobs("a", "b", "c")
+	check := func(step string, current, previous *job) {
+		t.Helper()
+		if jt.current != current || jt.previous != previous {
+			t.Errorf("%s: expected %v and %v, got %v and %v", step, current, previous, jt.current, jt.previous)
+		}
+	}
+	check("added", jobs[2], jobs[1])
+
+	jt.setCurrent(jobs[0])
+	check("first made current", jobs[0], jobs[2])
+	jt.setCurrent(jobs[0])
+	check("current made current again", jobs[0], jobs[2])
+
+	jt.removeLocked(jobs[0])
+	check("current removed", jobs[2], jobs[1])
+	jt.removeLocked(jobs[1])
+	check("previous removed", jobs[2], nil)
+
+	d := &job{text: "d"}
+	jt.add(d)
+	if d.id != 4 {
+		t.Errorf("expected the next job number after the last one, got %d", d.id)
+	}
+	check("added after removals", d, jobs[2])
+
+	jt.removeLocked(d)
+	jt.removeLocked(jobs[2])
+	check("all removed", nil, nil)
+	e := &job{text: "e"}
+	jt.add(e)
+	if e.id != 1 {
+		t.Errorf("expected numbering to start over in an empty table, got %d", e.id)
+	}
+}
+
+func TestJobUpdate(t *testing.T) {
+	failed := &statusError{code: 2}
+	testCases := []struct {
+		states   []jobState
+		errs     []error
+		expected jobState
+		status   string
+	}{
+		{[]jobState{jobRunning}, []error{nil}, jobRunning, "Running"},
+		{[]jobState{jobStopped, jobRunning}, []error{nil, nil}, jobRunning, "Running"},
+		{[]jobState{jobStopped, jobDone}, []error{nil, nil}, jobStopped, "Stopped"},
+		{[]jobState{jobDone, jobDone}, []error{nil, nil}, jobDone, "Done"},
+		{[]jobState{jobDone, jobDone}, []error{nil, failed}, jobDone, "Exit 2"},
+		// only the last command of a pipeline sets the result
+		{[]jobState{jobDone, jobDone}, []error{failed, nil}, jobDone, "Done"},
+	}
+
+	for _, tc := range testCases {
+		j := &job{}
+		for i, state := range tc.states {
+			j.procs = append(j.procs, &jobProcess{state: state, err: tc.errs[i]})
+		}
+		j.update()
+		if j.state != tc.expected || j.status() != tc.status {
+			t.Errorf("expected %d %q, got %d %q for %v", tc.expected, tc.status, j.state, j.status(), tc.states)
+		}
+	}
+}
+
+func TestJobFinishAndNotify(t *testing.T) {
+	jt, jobs := newTestJobs("true", "sleep 100", "false")
+	jt.finish(jobs[0], jobs[0].procs[0], nil)
+	jt.finish(jobs[2], jobs[2].procs[0], &statusError{code: 1})
+
+	if err := jt.wait(jobs[2]); exitStatus(err) != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+	if jt.hasStopped() {
+		t.Errorf("expected no stopped jobs")
+	}
+
+	var out bytes.Buffer
+	jt.notify(&out)
+	expected := "[1]   Done                    true\n[3]+  Exit 1                  false\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+	if len(jt.jobs) != 1 || jt.current != jobs[1] || jt.previous != nil {
+		t.Errorf("expected only the running job to be left as current, got %v", jt.jobs)
+	}
+
+	jobs[1].procs[0].state = jobStopped
+	jobs[1].update()
+	if !jt.hasStopped() {
+		t.Errorf("expected a stopped job")
+	}
+	if err := jt.signal(&job{procs: []*jobProcess{{pid: 1, state: jobDone}}}, 0); err == nil {
+		t.Errorf("expected signalling a terminated job to fail")
+	}
+}
+
+func TestJobsCommand(t *testing.T) {
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, nil, t.TempDir())
+	jt, jobs := newTestJobs("sleep 100", "vim", "make")
+	sh.jobs = jt
+	jobs[1].procs[0].state = jobStopped
+	jobs[1].update()
+	jobs[2].procs[0].state = jobDone
+	jobs[2].update()
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"jobs", "-l"}, "" +
+			"[1]  100 Running                 sleep 100 &\n" +
+			"[2]- 200 Stopped                 vim\n" +
+			"[3]+ 300 Done                    make\n"},
+		// done jobs are reported once
+		{[]string{"jobs", "-p"}, "100\n200\n"},
+		{[]string{"jobs"}, "" +
+			"[1]-  Running                 sleep 100 &\n" +
+			"[2]+  Stopped                 vim\n"},
+	}
+
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		if err := sh.jobsCommand(tc.args, nil, &out, io.Discard); err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.args, err)
+		}
+		if out.String() != tc.expected {
+			t.Errorf("expected %q, got %q for %q", tc.expected, out.String(), tc.args)
+		}
+	}
+	if err := sh.jobsCommand([]string{"jobs", "-x"}, nil, io.Discard, io.Discard); err == nil {
+		t.Errorf("expected a usage error")
+	}
+}
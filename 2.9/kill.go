@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// parseSignal accepts a signal as a number or a name with or without the
+// SIG prefix, in any case.
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return syscall.Signal(n), nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	for _, sn := range signalNames {
+		if sn.name == name {
+			return sn.sig, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: invalid signal specification", s)
+}
+
+func signalName(sig syscall.Signal) string {
+	for _, sn := range signalNames {
+		if sn.sig == sig {
+			return sn.name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// listSignals prints the known signals, or the names of the given numbers.
+// An exit status above 128 names the signal that killed the command.
+func listSignals(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		sorted := append(signalNames[:0:0], signalNames...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].sig < sorted[j].sig })
+		for i, sn := range sorted {
+			sep := "\t"
+			if (i+1)%5 == 0 || i == len(sorted)-1 {
+				sep = "\n"
+			}
+			fmt.Fprintf(stdout, "%2d) SIG%-7s%s", int(sn.sig), sn.name, sep)
+		}
+		return nil
+	}
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n > 128 {
+				n -= 128
+			}
+			fmt.Fprintln(stdout, signalName(syscall.Signal(n)))
+			continue
+		}
+		sig, err := parseSignal(arg)
+		if err != nil {
+			return fmt.Errorf("kill: %v", err)
+		}
+		fmt.Fprintln(stdout, int(sig))
+	}
+	return nil
+}
+
+// killCommand implements kill [-s SIG | -n NUM | -SIG] target... where a
+// target is a pid, -pgid for a process group or a job spec, and
+// kill -l [SIG...].
+func (sh *Shell) killCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	sig := syscall.SIGTERM
+	if len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "-l" || arg == "-L":
+			return listSignals(args[1:], stdout)
+		case arg == "-s" || arg == "-n":
+			if len(args) < 2 {
+				return fmt.Errorf("kill: option %s requires an argument", arg)
+			}
+			s, err := parseSignal(args[1])
+			if err != nil {
+				return fmt.Errorf("kill: %v", err)
+			}
+			sig, args = s, args[2:]
+		case arg == "--":
+			args = args[1:]
+		case len(arg) > 1 && arg[0] == '-':
+			s, err := parseSignal(arg[1:])
+			if err != nil {
+				return fmt.Errorf("kill: %v", err)
+			}
+			sig, args = s, args[1:]
+		}
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("kill: usage: kill [-s sigspec | -n signum | -sigspec] pid | jobspec ... or kill -l [sigspec]")
+	}
+
+	// every target is tried; failures are reported one by one
+	failed := false
+	for _, target := range args {
+		if err := sh.killTarget(target, sig); err != nil {
+			fmt.Fprintf(stderr, "kill: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) killTarget(target string, sig syscall.Signal) error {
+	if strings.HasPrefix(target, "%") {
+		j, err := sh.jobs.lookup(target)
+		if err != nil {
+			return err
+		}
+		if err := sh.jobs.signal(j, sig); err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+		return nil
+	}
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		return fmt.Errorf("%s: arguments must be process or job IDs", target)
+	}
+	if err := signalProcess(pid, sig); err != nil {
+		return fmt.Errorf("(%d) - %v", pid, err)
+	}
+	return nil
+}
+
+type pgrepOptions struct {
+	pattern  *regexp.Regexp
+	full     bool // match against the whole command line
+	users    []string
+	newest   bool
+	oldest   bool
+	list     bool
+	listFull bool
+	count    bool
+	delim    string
+	signal   syscall.Signal
+}
+
+// parsePgrepOptions reads the options shared by pgrep and pkill. Only
+// pkill takes a signal, given as -SIG or --signal SIG.
+func parsePgrepOptions(name string, args []string) (pgrepOptions, error) {
+	opts := pgrepOptions{delim: "\n", signal: syscall.SIGTERM}
+	exact, ignoreCase := false, false
+	var pattern string
+	havePattern := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			if havePattern {
+				return opts, fmt.Errorf("only one pattern can be provided")
+			}
+			pattern, havePattern = arg, true
+		case arg == "--":
+			if i+1 < len(args) {
+				if havePattern {
+					return opts, fmt.Errorf("only one pattern can be provided")
+				}
+				pattern, havePattern = args[i+1], true
+				i++
+			}
+		case strings.HasPrefix(arg, "-u"):
+			value, err := optionValue(args, &i, "-u")
+			if err != nil {
+				return opts, err
+			}
+			opts.users = append(opts.users, splitList(value)...)
+		case name == "pgrep" && strings.HasPrefix(arg, "-d"):
+			value, err := optionValue(args, &i, "-d")
+			if err != nil {
+				return opts, err
+			}
+			opts.delim = value
+		case name == "pkill" && (arg == "--signal" || strings.HasPrefix(arg, "--signal=")):
+			value, err := optionValue(args, &i, "--signal")
+			if err != nil {
+				return opts, err
+			}
+			if opts.signal, err = parseSignal(value); err != nil {
+				return opts, err
+			}
+		default:
+			if name == "pkill" {
+				if sig, err := parseSignal(arg[1:]); err == nil {
+					opts.signal = sig
+					continue
+				}
+			}
+			for _, flag := range arg[1:] {
+				switch {
+				case flag == 'f':
+					opts.full = true
+				case flag == 'x':
+					exact = true
+				case flag == 'i':
+					ignoreCase = true
+				case flag == 'n':
+					opts.newest = true
+				case flag == 'o':
+					opts.oldest = true
+				case flag == 'l' && name == "pgrep":
+					opts.list = true
+				case flag == 'a' && name == "pgrep":
+					opts.listFull = true
+				case flag == 'c' && name == "pgrep":
+					opts.count = true
+				default:
+					return opts, fmt.Errorf("invalid option %s", arg)
+				}
+			}
+		}
+	}
+	if !havePattern && len(opts.users) == 0 {
+		return opts, fmt.Errorf("no matching criteria specified")
+	}
+	if opts.newest && opts.oldest {
+		return opts, fmt.Errorf("-n and -o are mutually exclusive")
+	}
+
+	if exact {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return opts, fmt.Errorf("invalid pattern: %v", err)
+	}
+	opts.pattern = re
+	return opts, nil
+}
+
+type pgrepMatch struct {
+	pid     int32
+	name    string
+	args    string
+	created int64
+}
+
+// findProcesses lists the processes that match, leaving out the shell
+// itself, with the same process listing as ps.
+func findProcesses(opts pgrepOptions) ([]pgrepMatch, error) {
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить список процессов: %v", err)
+	}
+
+	var matches []pgrepMatch
+	for _, p := range processes {
+		if int(p.Pid) == os.Getpid() {
+			continue
+		}
+		m := pgrepMatch{pid: p.Pid}
+		m.name, _ = p.Name()
+		m.args, _ = p.Cmdline()
+		subject := m.name
+		if opts.full && m.args != "" {
+			subject = m.args
+		}
+		if !opts.pattern.MatchString(subject) {
+			continue
+		}
+		if len(opts.users) > 0 && !matchUser(p, opts.users) {
+			continue
+		}
+		m.created, _ = p.CreateTime()
+		matches = append(matches, m)
+	}
+
+	if (opts.newest || opts.oldest) && len(matches) > 0 {
+		pick := matches[0]
+		for _, m := range matches[1:] {
+			if opts.newest && m.created > pick.created || opts.oldest && m.created < pick.created {
+				pick = m
+			}
+		}
+		matches = []pgrepMatch{pick}
+	}
+	return matches, nil
+}
+
+func matchUser(p *process.Process, users []string) bool {
+	name, _ := p.Username()
+	uid := ""
+	if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+		uid = strconv.Itoa(int(uids[0]))
+	}
+	for _, u := range users {
+		if u == name || u == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (sh *Shell) pgrepCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, err := parsePgrepOptions("pgrep", cmd[1:])
+	if err != nil {
+		return fmt.Errorf("pgrep: %v", err)
+	}
+	matches, err := findProcesses(opts)
+	if err != nil {
+		return fmt.Errorf("pgrep: %v", err)
+	}
+
+	if opts.count {
+		fmt.Fprintln(stdout, len(matches))
+	} else {
+		for i, m := range matches {
+			if i > 0 {
+				fmt.Fprint(stdout, opts.delim)
+			}
+			switch {
+			case opts.listFull && m.args != "":
+				fmt.Fprintf(stdout, "%d %s", m.pid, m.args)
+			case opts.list || opts.listFull:
+				fmt.Fprintf(stdout, "%d %s", m.pid, m.name)
+			default:
+				fmt.Fprint(stdout, m.pid)
+			}
+		}
+		if len(matches) > 0 {
+			fmt.Fprintln(stdout)
+		}
+	}
+	if len(matches) == 0 {
+		return &statusError{code: 1}
+	}
+	return nil
+}
+
+func (sh *Shell) pkillCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, err := parsePgrepOptions("pkill", cmd[1:])
+	if err != nil {
+		return fmt.Errorf("pkill: %v", err)
+	}
+	matches, err := findProcesses(opts)
+	if err != nil {
+		return fmt.Errorf("pkill: %v", err)
+	}
+
+	signalled := 0
+	for _, m := range matches {
+		if err := signalProcess(int(m.pid), opts.signal); err != nil {
+			fmt.Fprintf(stderr, "pkill: killing pid %d failed: %v\n", m.pid, err)
+			continue
+		}
+		signalled++
+	}
+	if signalled == 0 {
+		return &statusError{code: 1}
+	}
+	return nil
+}
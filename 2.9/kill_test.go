@@ -0,0 +1,70 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	testCases := []struct {
+		spec    string
+		sig     syscall.Signal
+		wantErr bool
+	}{
+		{"9", syscall.SIGKILL, false},
+		{"TERM", syscall.SIGTERM, false},
+		{"SIGHUP", syscall.SIGHUP, false},
+		{"int", syscall.SIGINT, false},
+		{"BOGUS", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, tc := range testCases {
+		sig, err := parseSignal(tc.spec)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseSignal(%q) error = %v, wantErr %v", tc.spec, err, tc.wantErr)
+			continue
+		}
+		if sig != tc.sig {
+			t.Errorf("parseSignal(%q) = %v, want %v", tc.spec, sig, tc.sig)
+		}
+	}
+}
+
+func TestParsePgrepOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		subject string
+		match   bool
+		sig     syscall.Signal
+		wantErr bool
+	}{
+		{"pgrep", []string{"sle"}, "sleep", true, syscall.SIGTERM, false},
+		{"pgrep", []string{"-x", "sle"}, "sleep", false, syscall.SIGTERM, false},
+		{"pgrep", []string{"-ix", "SLEEP"}, "sleep", true, syscall.SIGTERM, false},
+		{"pkill", []string{"-9", "sleep"}, "sleep", true, syscall.SIGKILL, false},
+		{"pkill", []string{"--signal", "HUP", "-f", "sleep 1"}, "sleep 1", true, syscall.SIGHUP, false},
+		{"pgrep", []string{"-9", "sleep"}, "", false, 0, true},
+		{"pgrep", []string{"a", "b"}, "", false, 0, true},
+		{"pkill", []string{}, "", false, 0, true},
+		{"pgrep", []string{"("}, "", false, 0, true},
+	}
+
+	for _, tc := range testCases {
+		opts, err := parsePgrepOptions(tc.name, tc.args)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s %q: error = %v, wantErr %v", tc.name, tc.args, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := opts.pattern.MatchString(tc.subject); got != tc.match {
+			t.Errorf("%s %q: match %q = %v, want %v", tc.name, tc.args, tc.subject, got, tc.match)
+		}
+		if opts.signal != tc.sig {
+			t.Errorf("%s %q: signal = %v, want %v", tc.name, tc.args, opts.signal, tc.sig)
+		}
+	}
+}
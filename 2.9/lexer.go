@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type partKind int
+
+const (
+	partLiteral partKind = iota
+	partVar              // $NAME, ${NAME}, $?, $1
+	partCommand          // $(...)
+)
+
+// wordPart is a piece of a word. Quoted parts are neither split into
+// fields nor used as glob patterns after expansion.
+type wordPart struct {
+	kind   partKind
+	text   string
+	quoted bool
+}
+
+type Word []wordPart
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPipe
+	tokenRedirect
+	tokenBackground
+	tokenSemicolon
+	tokenAnd
+	tokenOr
+	tokenNewline
+	tokenLParen
+	tokenRParen
+)
+
+// syntaxError is an error in the input. An incomplete input, such as an
+// unterminated quote, can become valid when more lines are read.
+type syntaxError struct {
+	msg        string
+	incomplete bool
+}
+
+func (e *syntaxError) Error() string {
+	return "syntax error: " + e.msg
+}
+
+func isIncomplete(err error) bool {
+	var syntaxErr *syntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.incomplete
+}
+
+type token struct {
+	kind tokenKind
+	word Word
+	op   string // operator, e.g. "&&", ">" or "2>&1"
+
+	start, end int // position in the input, in runes
+}
+
+type lexer struct {
+	input  []rune
+	pos    int
+	tokens []token
+	word   Word
+	inWord bool
+	start  int
+}
+
+func lex(input string) ([]token, error) {
+	l := &lexer{input: []rune(input)}
+	for l.pos < len(l.input) {
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+	}
+	l.endWord()
+	return l.tokens, nil
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset < len(l.input) {
+		return l.input[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) find(from int, c rune) int {
+	for i := from; i < len(l.input); i++ {
+		if l.input[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *lexer) endWord() {
+	if l.inWord {
+		l.tokens = append(l.tokens, token{kind: tokenWord, word: l.word, start: l.start, end: l.pos})
+	}
+	l.word = nil
+	l.inWord = false
+}
+
+func (l *lexer) addOperator(kind tokenKind, op string, start int) {
+	l.tokens = append(l.tokens, token{kind: kind, op: op, start: start, end: l.pos})
+}
+
+func (l *lexer) addPart(kind partKind, text string, quoted bool) {
+	l.inWord = true
+	if kind == partLiteral && len(l.word) > 0 {
+		last := &l.word[len(l.word)-1]
+		if last.kind == partLiteral && last.quoted == quoted {
+			last.text += text
+			return
+		}
+	}
+	l.word = append(l.word, wordPart{kind: kind, text: text, quoted: quoted})
+}
+
+func (l *lexer) next() error {
+	c := l.input[l.pos]
+	if !l.inWord {
+		l.start = l.pos
+	}
+	switch {
+	case c == ' ' || c == '\t' || c == '\r':
+		l.endWord()
+		l.pos++
+	case c == '\n':
+		l.endWord()
+		l.pos++
+		l.addOperator(tokenNewline, "\n", l.pos-1)
+	case c == '#' && !l.inWord:
+		for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+			l.pos++
+		}
+	case c == '|' && l.peek(1) == '|':
+		l.endWord()
+		l.pos += 2
+		l.addOperator(tokenOr, "||", l.pos-2)
+	case c == '|':
+		l.endWord()
+		l.pos++
+		l.addOperator(tokenPipe, "|", l.pos-1)
+	case c == '&' && l.peek(1) == '&':
+		l.endWord()
+		l.pos += 2
+		l.addOperator(tokenAnd, "&&", l.pos-2)
+	case c == '&':
+		l.endWord()
+		l.pos++
+		l.addOperator(tokenBackground, "&", l.pos-1)
+	case c == ';':
+		l.endWord()
+		l.pos++
+		l.addOperator(tokenSemicolon, ";", l.pos-1)
+	case c == '(' || c == ')':
+		l.endWord()
+		l.pos++
+		kind := tokenLParen
+		if c == ')' {
+			kind = tokenRParen
+		}
+		l.addOperator(kind, string(c), l.pos-1)
+	case c == '<' || c == '>' || ((c == '1' || c == '2') && !l.inWord && l.peek(1) == '>'):
+		l.endWord()
+		l.lexRedirect()
+	case c == '\\' && l.peek(1) == '\n':
+		// line continuation
+		l.pos += 2
+	case c == '\\':
+		l.pos++
+		if l.pos >= len(l.input) {
+			return &syntaxError{msg: "unexpected end of input after \\", incomplete: true}
+		}
+		l.addPart(partLiteral, string(l.input[l.pos]), true)
+		l.pos++
+	case c == '\'':
+		end := l.find(l.pos+1, '\'')
+		if end < 0 {
+			return &syntaxError{msg: "unterminated single quote", incomplete: true}
+		}
+		l.addPart(partLiteral, string(l.input[l.pos+1:end]), true)
+		l.pos = end + 1
+	case c == '"':
+		return l.lexDoubleQuoted()
+	case c == '$':
+		return l.lexDollar(false)
+	default:
+		l.addPart(partLiteral, string(c), false)
+		l.pos++
+	}
+	return nil
+}
+
+func (l *lexer) lexRedirect() {
+	start := l.pos
+	if l.input[l.pos] == '1' || l.input[l.pos] == '2' {
+		l.pos++
+	}
+	l.pos++
+	switch {
+	case l.input[l.pos-1] == '>' && l.peek(0) == '>':
+		l.pos++
+	case l.input[l.pos-1] == '>' && l.peek(0) == '&' && (l.peek(1) == '1' || l.peek(1) == '2'):
+		l.pos += 2
+	}
+	l.addOperator(tokenRedirect, string(l.input[start:l.pos]), start)
+}
+
+func (l *lexer) lexDoubleQuoted() error {
+	l.pos++
+	l.addPart(partLiteral, "", true)
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return nil
+		case c == '\\' && l.peek(1) == '\n':
+			l.pos += 2
+		case c == '\\' && strings.ContainsRune("$\"\\`", l.peek(1)):
+			l.addPart(partLiteral, string(l.peek(1)), true)
+			l.pos += 2
+		case c == '$':
+			if err := l.lexDollar(true); err != nil {
+				return err
+			}
+		default:
+			l.addPart(partLiteral, string(c), true)
+			l.pos++
+		}
+	}
+	return &syntaxError{msg: "unterminated double quote", incomplete: true}
+}
+
+func isNameChar(c rune, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+func (l *lexer) lexDollar(quoted bool) error {
+	l.pos++
+	c := l.peek(0)
+	switch {
+	case strings.ContainsRune("?$#@*0123456789", c):
+		l.addPart(partVar, string(c), quoted)
+		l.pos++
+	case c == '{':
+		end := l.find(l.pos, '}')
+		if end < 0 {
+			return &syntaxError{msg: "missing }", incomplete: true}
+		}
+		name := string(l.input[l.pos+1 : end])
+		if !isName(name) && !isSpecialParam(name) {
+			return fmt.Errorf("bad substitution: ${%s}", name)
+		}
+		l.addPart(partVar, name, quoted)
+		l.pos = end + 1
+	case c == '(':
+		src, err := l.scanSubstitution()
+		if err != nil {
+			return err
+		}
+		l.addPart(partCommand, src, quoted)
+	case isNameChar(c, true):
+		start := l.pos
+		for l.pos < len(l.input) && isNameChar(l.input[l.pos], false) {
+			l.pos++
+		}
+		l.addPart(partVar, string(l.input[start:l.pos]), quoted)
+	default:
+		l.addPart(partLiteral, "$", quoted)
+	}
+	return nil
+}
+
+// scanSubstitution returns the source between the parentheses of $(...),
+// honouring nested parentheses and quotes.
+func (l *lexer) scanSubstitution() (string, error) {
+	start := l.pos + 1
+	depth := 0
+	var quote rune
+	for ; l.pos < len(l.input); l.pos++ {
+		c := l.input[l.pos]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				l.pos++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			l.pos++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return string(l.input[start : l.pos-1]), nil
+			}
+		}
+	}
+	return "", &syntaxError{msg: "unterminated $(", incomplete: true}
+}
+
+// isSpecialParam reports whether s is $?, $$, $#, $@, $* or a
+// positional parameter.
+func isSpecialParam(s string) bool {
+	if s == "?" || s == "$" || s == "#" || s == "@" || s == "*" {
+		return true
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+")
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !isNameChar(c, i == 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInput(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.log"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=/home/test",
+		"DIR=" + dir,
+		"GREETING=hello   world",
+		"EMPTY=",
+	}, dir)
+	sh.status = 3
+
+	testCases := []struct {
+		input    string
+		expected [][]string
+		hasError bool
+	}{
+		{`echo "a | b"`, [][]string{{"echo", "a | b"}}, false},
+		{`ls | grep x | wc -l`, [][]string{{"ls"}, {"grep", "x"}, {"wc", "-l"}}, false},
+		{`cat "my file.txt" my\ other`, [][]string{{"cat", "my file.txt", "my other"}}, false},
+		{`echo 'single $HOME "x"'`, [][]string{{"echo", `single $HOME "x"`}}, false},
+		{`echo "double $HOME \"x\" \$ \a"`, [][]string{{"echo", `double /home/test "x" $ \a`}}, false},
+		{`echo a""b '' ""`, [][]string{{"echo", "ab", "", ""}}, false},
+		{`echo $GREETING`, [][]string{{"echo", "hello", "world"}}, false},
+		{`echo "$GREETING"`, [][]string{{"echo", "hello   world"}}, false},
+		{`echo x${GREETING}y`, [][]string{{"echo", "xhello", "worldy"}}, false},
+		{`echo $EMPTY $NOT_SET_ANYWHERE end`, [][]string{{"echo", "end"}}, false},
+		{`echo $? ${?} "$?"`, [][]string{{"echo", "3", "3", "3"}}, false},
+		{`echo $ a$`, [][]string{{"echo", "$", "a$"}}, false},
+		{`echo ~ ~/bin "~" a~`, [][]string{{"echo", "/home/test", "/home/test/bin", "~", "a~"}}, false},
+		{`echo $(echo inner) "$(echo "a  b" | cat)"`, [][]string{{"echo", "inner", "a  b"}}, false},
+		{`echo $(echo $(echo nested))`, [][]string{{"echo", "nested"}}, false},
+		{`ls $DIR/*.txt`, [][]string{{"ls", filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}}, false},
+		{`ls "$DIR"/*.log "$DIR/*.log"`, [][]string{{"ls", filepath.Join(dir, "c.log"), filepath.Join(dir, "*.log")}}, false},
+		{`ls $DIR/*.none`, [][]string{{"ls", filepath.Join(dir, "*.none")}}, false},
+		{`echo a # comment`, [][]string{{"echo", "a"}}, false},
+		{`echo a#b`, [][]string{{"echo", "a#b"}}, false},
+		{``, nil, false},
+		{`echo "unterminated`, nil, true},
+		{`echo 'unterminated`, nil, true},
+		{`echo $(echo`, nil, true},
+		{`echo ${`, nil, true},
+		{`| wc`, nil, true},
+		{`ls |`, nil, true},
+		{`ls > `, nil, true},
+	}
+
+	for _, tc := range testCases {
+		p, err := parseInput(tc.input)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for input %q, but got none", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+
+		var result [][]string
+		for _, c := range commands(p) {
+			args, err := sh.expandWords(c.Args)
+			if err != nil {
+				t.Errorf("unexpected expansion error for input %q: %v", tc.input, err)
+			}
+			result = append(result, args)
+		}
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("expected %q, got %q for input %q", tc.expected, result, tc.input)
+		}
+	}
+}
+
+func TestParseRedirects(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []Redirect
+	}{
+		{`cmd > out`, []Redirect{{Fd: 1, Target: Word{{text: "out"}}, DupFd: -1}}},
+		{`cmd >>out <in`, []Redirect{
+			{Fd: 1, Target: Word{{text: "out"}}, Append: true, DupFd: -1},
+			{Fd: 0, Target: Word{{text: "in"}}, DupFd: -1},
+		}},
+		{`cmd 2> err 2>&1`, []Redirect{
+			{Fd: 2, Target: Word{{text: "err"}}, DupFd: -1},
+			{Fd: 2, DupFd: 1},
+		}},
+		{`cmd >"a b"`, []Redirect{{Fd: 1, Target: Word{{text: "a b", quoted: true}}, DupFd: -1}}},
+		{`cmd a2>x`, []Redirect{{Fd: 1, Target: Word{{text: "x"}}, DupFd: -1}}},
+	}
+
+	for _, tc := range testCases {
+		p, err := parseInput(tc.input)
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", tc.input, err)
+			continue
+		}
+		if result := commands(p)[0].Redirects; !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("expected %+v, got %+v for input %q", tc.expected, result, tc.input)
+		}
+	}
+}
+
+func commands(l *List) []*Command {
+	var result []*Command
+	for _, andOr := range l.Items {
+		for _, node := range andOr.Nodes {
+			if p, ok := node.(*Pipeline); ok {
+				result = append(result, p.Commands...)
+			}
+		}
+	}
+	return result
+}
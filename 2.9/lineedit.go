@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// errInterrupted is returned when the line is abandoned with Ctrl+C.
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// plainReader reads lines as they come, for input that is not a terminal.
+type plainReader struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.reader.ReadString('\n')
+	if err != nil && line != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+func newLineReader(in *os.File, out *os.File, complete func([]rune, int) completion) lineReader {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return &plainReader{reader: bufio.NewReader(in), out: out}
+	}
+	return &lineEditor{in: in, out: out, reader: bufio.NewReader(in), history: loadHistory(), complete: complete}
+}
+
+// lineEditor reads lines in raw mode with Emacs-style key bindings.
+type lineEditor struct {
+	in      *os.File
+	out     *os.File
+	reader  *bufio.Reader
+	history *history
+
+	// complete offers the candidates for the word before the cursor
+	complete func(line []rune, pos int) completion
+
+	prompt  string
+	line    []rune
+	pos     int
+	buf     strings.Builder
+	lastTab bool
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+
+	// escape sequences are mapped to negative keys
+	keyUp = -iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyWordLeft
+	keyWordRight
+	keyUnknown
+)
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(int(e.in.Fd()))
+	if err != nil {
+		return (&plainReader{reader: e.reader, out: e.out}).readLine(prompt)
+	}
+	defer term.Restore(int(e.in.Fd()), state)
+
+	// only the last line of the prompt is redrawn while editing
+	if i := strings.LastIndexByte(prompt, '\n'); i >= 0 {
+		e.write(strings.ReplaceAll(prompt[:i+1], "\n", "\r\n"))
+		prompt = prompt[i+1:]
+	}
+	e.prompt = prompt
+	e.line = e.line[:0]
+	e.pos = 0
+	e.lastTab = false
+	e.refresh()
+
+	histIndex := len(e.history.lines)
+	var saved []rune
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		tab := key == keyTab
+
+		switch key {
+		case keyEnter, '\n':
+			e.write("\r\n")
+			line := string(e.line)
+			e.history.add(line)
+			return line, nil
+		case keyCtrlC:
+			e.write("^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyDeleteForward:
+			e.deleteForward()
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+				e.pos--
+			}
+		case keyLeft, keyCtrlB:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyRight, keyCtrlF:
+			if e.pos < len(e.line) {
+				e.pos++
+			}
+		case keyHome, keyCtrlA:
+			e.pos = 0
+		case keyEnd, keyCtrlE:
+			e.pos = len(e.line)
+		case keyWordLeft:
+			e.pos = e.wordStart()
+		case keyWordRight:
+			for e.pos < len(e.line) && e.line[e.pos] == ' ' {
+				e.pos++
+			}
+			for e.pos < len(e.line) && e.line[e.pos] != ' ' {
+				e.pos++
+			}
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+		case keyCtrlU:
+			e.line = append(e.line[:0], e.line[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.wordStart()
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyUp, keyCtrlP, keyDown, keyCtrlN:
+			if histIndex == len(e.history.lines) {
+				saved = append(saved[:0], e.line...)
+			}
+			if key == keyUp || key == keyCtrlP {
+				if histIndex == 0 {
+					break
+				}
+				histIndex--
+			} else {
+				if histIndex == len(e.history.lines) {
+					break
+				}
+				histIndex++
+			}
+			if histIndex == len(e.history.lines) {
+				e.line = append(e.line[:0], saved...)
+			} else {
+				e.line = []rune(e.history.lines[histIndex])
+			}
+			e.pos = len(e.line)
+		case keyCtrlR:
+			accepted, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				e.write("\r\n")
+				line := string(e.line)
+				e.history.add(line)
+				return line, nil
+			}
+		case keyTab:
+			e.completeWord()
+		default:
+			if key >= ' ' {
+				e.insert(rune(key))
+			}
+		}
+		e.lastTab = tab
+		e.refresh()
+	}
+}
+
+func (e *lineEditor) readKey() (int, error) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != keyEscape {
+		return int(r), nil
+	}
+
+	r, _, err = e.reader.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+
+	// CSI: parameters followed by a final byte
+	var seq strings.Builder
+	for {
+		r, _, err = e.reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		seq.WriteRune(r)
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+	}
+	switch seq.String() {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDeleteForward, nil
+	case "1;5D", "1;3D":
+		return keyWordLeft, nil
+	case "1;5C", "1;3C":
+		return keyWordRight, nil
+	}
+	return keyUnknown, nil
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.pos+1:], e.line[e.pos:])
+	e.line[e.pos] = r
+	e.pos++
+}
+
+func (e *lineEditor) deleteForward() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && e.line[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && e.line[i-1] != ' ' {
+		i--
+	}
+	return i
+}
+
+func (e *lineEditor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+// refresh redraws the prompt and the line and puts the cursor back.
+func (e *lineEditor) refresh() {
+	e.buf.Reset()
+	e.buf.WriteString("\r")
+	e.buf.WriteString(e.prompt)
+	e.buf.WriteString(string(e.line))
+	e.buf.WriteString("\x1b[K")
+	if back := len(e.line) - e.pos; back > 0 {
+		fmt.Fprintf(&e.buf, "\x1b[%dD", back)
+	}
+	e.write(e.buf.String())
+}
+
+func (e *lineEditor) completeWord() {
+	c := e.complete(e.line, e.pos)
+	if len(c.candidates) == 0 {
+		e.write("\a")
+		return
+	}
+
+	replacement := commonPrefix(c.candidates)
+	if len(c.candidates) == 1 && !strings.HasSuffix(replacement, "/") {
+		replacement += " "
+	}
+	if replacement != string(e.line[c.start:e.pos]) {
+		rest := append([]rune(replacement), e.line[e.pos:]...)
+		e.line = append(e.line[:c.start], rest...)
+		e.pos = c.start + len([]rune(replacement))
+		return
+	}
+
+	// a second Tab without progress lists the candidates
+	if !e.lastTab {
+		e.write("\a")
+		return
+	}
+	names := make([]string, len(c.candidates))
+	for i, candidate := range c.candidates {
+		dir := strings.HasSuffix(candidate, "/")
+		names[i] = filepath.Base(candidate)
+		if dir {
+			names[i] += "/"
+		}
+	}
+	e.write("\r\n")
+	e.write(columns(names, e.width()))
+}
+
+func (e *lineEditor) width() int {
+	width, _, err := term.GetSize(int(e.out.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return width
+}
+
+// columns lays the words out in columns that fit into width, in raw-mode
+// line endings.
+func columns(words []string, width int) string {
+	longest := 0
+	for _, w := range words {
+		if n := len([]rune(w)); n > longest {
+			longest = n
+		}
+	}
+	colWidth := longest + 2
+	perRow := width / colWidth
+	if perRow < 1 {
+		perRow = 1
+	}
+	rows := (len(words) + perRow - 1) / perRow
+
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		for col := 0; col < perRow; col++ {
+			i := col*rows + row
+			if i >= len(words) {
+				break
+			}
+			fmt.Fprintf(&b, "%-*s", colWidth, words[i])
+		}
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// reverseSearch implements Ctrl+R. It reports whether the line was
+// accepted with Enter; other keys leave the match in the line for editing.
+func (e *lineEditor) reverseSearch() (bool, error) {
+	original := append([]rune(nil), e.line...)
+	var query []rune
+	index := len(e.history.lines)
+	match := -1
+	failed := false
+
+	for {
+		status := "reverse-i-search"
+		if failed {
+			status = "failing reverse-i-search"
+		}
+		text := ""
+		if match >= 0 {
+			text = e.history.lines[match]
+		}
+		e.write(fmt.Sprintf("\r(%s)`%s': %s\x1b[K", status, string(query), text))
+
+		key, err := e.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case keyCtrlR:
+			from := index
+			if match >= 0 {
+				from = match
+			}
+			if next := e.history.search(string(query), from); next >= 0 {
+				match = next
+				failed = false
+			} else {
+				failed = true
+			}
+			continue
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+		case keyCtrlG, keyCtrlC:
+			e.line = original
+			e.pos = len(e.line)
+			return false, nil
+		case keyEnter, '\n':
+			if match >= 0 {
+				e.line = []rune(e.history.lines[match])
+			}
+			return true, nil
+		default:
+			if key >= ' ' {
+				query = append(query, rune(key))
+				break
+			}
+			if match >= 0 {
+				e.line = []rune(e.history.lines[match])
+			}
+			e.pos = len(e.line)
+			return false, nil
+		}
+
+		match = e.history.search(string(query), index)
+		failed = match < 0 && len(query) > 0
+	}
+}
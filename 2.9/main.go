@@ -1,156 +1,197 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/shirou/gopsutil/process"
+	"time"
 )
 
 func main() {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Print("my-shell> ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("input error: ", err)
-			continue
-		}
-		input = strings.TrimSpace(input)
-		if input == "" {
-			continue
-		}
-		if input == "\\quit" {
-			break
-		}
-		err = executeCommand(input)
-		if err != nil {
-			fmt.Println("error: ", err)
-		}
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "my-shell:", err)
+		os.Exit(1)
 	}
-}
+	// an inherited PWD keeps the symbolic links of the path that led here
+	if pwd := os.Getenv("PWD"); filepath.IsAbs(pwd) && pwd != dir && sameFile(pwd, dir) {
+		dir = filepath.Clean(pwd)
+	}
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, os.Environ(), dir)
 
-func executeCommand(input string) error {
-	commands := parseInput(input)
-	if len(commands) == 0 {
-		return nil
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "-hermetic" {
+		sh.hermetic, args = true, args[1:]
 	}
-	if len(commands) == 1 {
-		handled, err := handleBuildInCommand(commands[0])
-		if handled {
-			return err
+	switch {
+	case len(args) > 0 && args[0] == "-c":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "my-shell: -c: option requires an argument")
+			os.Exit(2)
 		}
-		return executeExturnalCommand(commands[0])
+		os.Exit(sh.runCommand(args[1], args[2:]))
+	case len(args) > 0:
+		os.Exit(sh.runScript(args[0], args[1:]))
 	}
 
-	return fmt.Errorf("pipeline is not supported yet")
-}
-
-func executeExturnalCommand(cmd []string) error {
-	command := exec.Command(cmd[0], cmd[1:]...)
-	command.Stdin = os.Stdin
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	return command.Run()
+	initJobControl(sh.jobs)
+	sh.loadRC()
+	os.Exit(sh.interact(newLineReader(sh.stdin, sh.stdout, sh.complete)))
 }
 
-func parseInput(input string) [][]string {
-	pipeCommands := strings.Split(input, "|")
-	commands := [][]string{}
-	for _, cmd := range pipeCommands {
-		cmd = strings.TrimSpace(cmd)
-		if cmd == "" {
+// interact reads and runs lines until the end of the input, \quit or exit
+// and returns the exit status of the shell.
+func (sh *Shell) interact(reader lineReader) int {
+	pending := ""
+	for {
+		ps := sh.prompt("PS2", "> ")
+		if pending == "" {
+			sh.jobs.notify(sh.stderr)
+			ps = sh.prompt("PS1", "my-shell> ")
+		}
+		line, err := reader.readLine(ps)
+		if errors.Is(err, errInterrupted) {
+			pending = ""
+			sh.status = 130
 			continue
 		}
-		parts := strings.Fields(cmd)
-		commands = append(commands, parts)
-	}
-	return commands
-}
-
-func handleBuildInCommand(cmd []string) (bool, error) {
-	switch cmd[0] {
-	case "cd":
-		if len(cmd) < 2 {
-			return true, fmt.Errorf("cd: missing argument")
+		if err == io.EOF {
+			break
 		}
-		err := os.Chdir(cmd[1])
-		return true, err
-	case "pwd":
-		dir, err := os.Getwd()
 		if err != nil {
-			return true, err
+			fmt.Fprintf(sh.stderr, "%s: %v\n", sh.scriptName, err)
+			continue
 		}
-		fmt.Println(dir)
-		return true, nil
-	case "echo":
-		fmt.Println(strings.Join(cmd[1:], " "))
-		return true, nil
-	case "kill":
-		if len(cmd) < 2 {
-			return true, fmt.Errorf("kill: missing PID")
+		if pending == "" {
+			input := strings.TrimSpace(line)
+			if input == "" {
+				continue
+			}
+			if input == "\\quit" {
+				break
+			}
 		}
-		pid, err := strconv.Atoi(cmd[1])
-		if err != nil {
-			return true, fmt.Errorf("kill: incorrect PID")
+
+		input := pending + line + "\n"
+		warned := sh.exitWarned
+		start := time.Now()
+		err = sh.execute(input)
+		sh.duration = time.Since(start)
+		if isIncomplete(err) {
+			pending = input
+			continue
 		}
-		prosess, err := os.FindProcess(pid)
-		if err != nil {
-			return true, err
+		pending = ""
+		if warned {
+			sh.exitWarned = false
+		}
+		var exit *exitControl
+		if errors.As(err, &exit) {
+			break
 		}
-		err = prosess.Kill()
-		return true, err
-	case "ps":
-		err := handlePsCommand()
-		return true, err
-	default:
-		return false, nil
+		reportError(sh.stderr, err)
 	}
+	return sh.status
 }
 
-func handlePsCommand() error {
-	processes, err := process.Processes()
+// runScript executes a script file with the given positional parameters
+// and returns the exit status of the shell.
+func (sh *Shell) runScript(path string, args []string) int {
+	data, err := os.ReadFile(sh.path(path))
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = path
+	}
 	if err != nil {
-		return fmt.Errorf("не удалось получить список процессов: %v", err)
+		reportError(sh.stderr, err)
+		return 127
 	}
+	return sh.runCommand(string(data), append([]string{path}, args...))
+}
 
-	fmt.Println("PID\tTTY\t\tTIME\tCMD")
+// runCommand executes the commands of -c. The first argument, if any, is
+// $0 and the rest are the positional parameters.
+func (sh *Shell) runCommand(input string, args []string) int {
+	if len(args) > 0 {
+		sh.scriptName, sh.positional = args[0], args[1:]
+	}
+	err := sh.execute(input)
+	var exit *exitControl
+	if !errors.As(err, &exit) {
+		reportError(sh.stderr, err)
+	}
+	return sh.status
+}
 
-	for _, p := range processes {
-		pid := p.Pid
+var builtins map[string]func(sh *Shell, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+func init() {
+	builtins = map[string]func(sh *Shell, args []string, stdin io.Reader, stdout, stderr io.Writer) error{
+		"cd":       (*Shell).cdCommand,
+		"pwd":      (*Shell).pwdCommand,
+		"exit":     (*Shell).exitCommand,
+		"echo":     (*Shell).echoCommand,
+		"pushd":    (*Shell).pushdCommand,
+		"popd":     (*Shell).popdCommand,
+		"dirs":     (*Shell).dirsCommand,
+		"kill":     (*Shell).killCommand,
+		"pkill":    (*Shell).pkillCommand,
+		"pgrep":    (*Shell).pgrepCommand,
+		"ps":       (*Shell).psCommand,
+		"jobs":     (*Shell).jobsCommand,
+		"fg":       (*Shell).fgCommand,
+		"bg":       (*Shell).bgCommand,
+		"wait":     (*Shell).waitCommand,
+		"alias":    (*Shell).aliasCommand,
+		"unalias":  (*Shell).unaliasCommand,
+		"type":     (*Shell).typeCommand,
+		"which":    (*Shell).whichCommand,
+		"return":   (*Shell).returnCommand,
+		"export":   (*Shell).exportCommand,
+		"unset":    (*Shell).unsetCommand,
+		"env":      (*Shell).envCommand,
+		"break":    (*Shell).breakCommand,
+		"continue": (*Shell).continueCommand,
+		"shift":    (*Shell).shiftCommand,
+		"true":     (*Shell).trueCommand,
+		"false":    (*Shell).falseCommand,
+		":":        (*Shell).trueCommand,
+	}
+}
 
-		cmd, err := p.Name()
-		if err != nil {
-			cmd = "Unknown"
-		}
+// exitControl is returned by the exit built-in and unwinds everything up
+// to the main loop.
+type exitControl struct {
+	code int
+}
 
-		tty, err := p.Terminal()
-		if err != nil || tty == "" {
-			tty = "?"
-		}
+func (e *exitControl) Error() string {
+	return fmt.Sprintf("exit %d", e.code)
+}
 
-		cpuTimes, err := p.Times()
+func (sh *Shell) exitCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	code := sh.status
+	if len(cmd) > 1 {
+		n, err := strconv.Atoi(cmd[1])
 		if err != nil {
-			continue
+			fmt.Fprintf(stderr, "exit: %s: numeric argument required\n", cmd[1])
+			return &exitControl{code: 2}
 		}
-		totalTime := cpuTimes.User + cpuTimes.System
-		timeStr := formatCPUTime(totalTime)
-
-		fmt.Printf("%d\t%s\t%s\t%s\n", pid, tty, timeStr, cmd)
+		code = n & 0xff
 	}
-
-	return nil
+	if jobControl && !sh.exitWarned && sh.jobs.hasStopped() {
+		sh.exitWarned = true
+		fmt.Fprintln(stderr, "There are stopped jobs.")
+		return &statusError{code: 1}
+	}
+	return &exitControl{code: code}
 }
 
-func formatCPUTime(totalSeconds float64) string {
-	total := int(totalSeconds)
-	hours := total / 3600
-	minutes := (total % 3600) / 60
-	seconds := total % 60
-
-	return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+func (sh *Shell) echoCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	_, err := fmt.Fprintln(stdout, strings.Join(cmd[1:], " "))
+	return err
 }
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Redirect sends Fd to the file named by Target, or makes it a copy of
+// DupFd for operators like 2>&1.
+type Redirect struct {
+	Fd     int
+	Target Word
+	Append bool
+	DupFd  int
+}
+
+// Assignment is a NAME=value word in front of a command. Without a
+// command it sets a shell variable.
+type Assignment struct {
+	Name  string
+	Value Word
+}
+
+type Command struct {
+	Assignments []Assignment
+	Args        []Word
+	Redirects   []Redirect
+}
+
+// Node is a command of a list: a *Pipeline, *IfClause, *LoopClause,
+// *ForClause, *Group or *FuncDef.
+type Node interface {
+	node()
+}
+
+type Pipeline struct {
+	Commands   []*Command
+	Background bool
+	Negate     bool
+	Text       string // source of the pipeline, shown by jobs
+}
+
+// AndOr is a chain of nodes joined by Ops, each of them "&&" or "||".
+type AndOr struct {
+	Nodes []Node
+	Ops   []string
+}
+
+type List struct {
+	Items []*AndOr
+}
+
+// IfClause runs the body of the first condition that succeeds, or Else.
+type IfClause struct {
+	Conds  []*List
+	Bodies []*List
+	Else   *List
+}
+
+type LoopClause struct {
+	Cond  *List
+	Body  *List
+	Until bool
+}
+
+// ForClause runs Body for every word, or for every positional parameter
+// when there is no "in".
+type ForClause struct {
+	Name  string
+	Words []Word
+	In    bool
+	Body  *List
+}
+
+// Group is a list in braces: { list; }
+type Group struct {
+	Body *List
+}
+
+// FuncDef defines a function: name() compound-command.
+type FuncDef struct {
+	Name string
+	Body Node
+	Text string // source of the definition, shown by type
+}
+
+func (*Pipeline) node()   {}
+func (*IfClause) node()   {}
+func (*LoopClause) node() {}
+func (*ForClause) node()  {}
+func (*Group) node()      {}
+func (*FuncDef) node()    {}
+
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "in": true, "while": true, "until": true, "do": true, "done": true,
+	"!": true, "{": true, "}": true, "function": true,
+}
+
+type parser struct {
+	source  []rune
+	tokens  []token
+	pos     int
+	aliases *aliasTable // nil when aliases are not expanded
+
+	// aliasEnd keeps, for every alias being expanded, the position after
+	// its replacement; the alias is not expanded again before it
+	aliasEnd map[string]int
+	// aliasNext is the position of the word after an alias whose value
+	// ends with a blank; that word is checked for an alias too
+	aliasNext int
+}
+
+func parseInput(input string) (*List, error) {
+	return parseWithAliases(input, nil)
+}
+
+// parseWithAliases parses the input, replacing the aliases defined in the
+// table.
+func parseWithAliases(input string, aliases *aliasTable) (*List, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{source: []rune(input), tokens: tokens, aliases: aliases, aliasEnd: make(map[string]int), aliasNext: -1}
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	return list, nil
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// keyword returns the reserved word at the current position, if any.
+func (p *parser) keyword() string {
+	tok := p.peek()
+	if tok == nil || tok.kind != tokenWord || len(tok.word) != 1 {
+		return ""
+	}
+	part := tok.word[0]
+	if part.kind != partLiteral || part.quoted || !reservedWords[part.text] {
+		return ""
+	}
+	return part.text
+}
+
+func (p *parser) unexpected() error {
+	tok := p.peek()
+	if tok == nil {
+		return &syntaxError{msg: "unexpected end of input", incomplete: true}
+	}
+	text := tok.op
+	if tok.kind == tokenWord {
+		text = string(p.source[tok.start:tok.end])
+	}
+	if tok.kind == tokenNewline {
+		text = "newline"
+	}
+	return &syntaxError{msg: fmt.Sprintf("unexpected token `%s'", text)}
+}
+
+func (p *parser) expect(keyword string) error {
+	if p.keyword() != keyword {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) skipNewlines() {
+	for tok := p.peek(); tok != nil && tok.kind == tokenNewline; tok = p.peek() {
+		p.pos++
+	}
+}
+
+// parseList parses and-or lists up to the end of the input or up to one
+// of the reserved words that may end a list.
+func (p *parser) parseList() (*List, error) {
+	list := &List{}
+	for {
+		p.skipNewlines()
+		switch p.keyword() {
+		case "then", "else", "elif", "fi", "do", "done", "}":
+			return list, nil
+		}
+		tok := p.peek()
+		if tok == nil {
+			return list, nil
+		}
+		if tok.kind != tokenWord && tok.kind != tokenRedirect {
+			return nil, p.unexpected()
+		}
+
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		tok = p.peek()
+		switch {
+		case tok == nil:
+			return list, nil
+		case tok.kind == tokenBackground:
+			pipeline, ok := andOr.Nodes[0].(*Pipeline)
+			if len(andOr.Nodes) > 1 || !ok {
+				return nil, &syntaxError{msg: "only a pipeline can run in the background"}
+			}
+			pipeline.Background = true
+			p.pos++
+		case tok.kind == tokenSemicolon || tok.kind == tokenNewline:
+			p.pos++
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// parseBody parses a list that must not be empty.
+func (p *parser) parseBody() (*List, error) {
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, p.unexpected()
+	}
+	return list, nil
+}
+
+func (p *parser) parseAndOr() (*AndOr, error) {
+	node, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+	andOr := &AndOr{Nodes: []Node{node}}
+
+	for tok := p.peek(); tok != nil && (tok.kind == tokenAnd || tok.kind == tokenOr); tok = p.peek() {
+		p.pos++
+		p.skipNewlines()
+		node, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Ops = append(andOr.Ops, tok.op)
+		andOr.Nodes = append(andOr.Nodes, node)
+	}
+	return andOr, nil
+}
+
+func (p *parser) parsePipeline() (Node, error) {
+	negate := false
+	if p.keyword() == "!" {
+		negate = true
+		p.pos++
+	}
+	if err := p.expandAlias(); err != nil {
+		return nil, err
+	}
+
+	compound, err := p.parseCompound()
+	if err == nil && compound == nil && p.isFuncDef() {
+		compound, err = p.parseFuncDef()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if compound != nil {
+		if negate {
+			return nil, &syntaxError{msg: "! is only supported before simple commands"}
+		}
+		if tok := p.peek(); tok != nil && tok.kind == tokenPipe {
+			return nil, &syntaxError{msg: "compound commands cannot be used in a pipeline"}
+		}
+		return compound, nil
+	}
+
+	pipeline := &Pipeline{Negate: negate}
+	start := p.pos
+	for {
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Commands = append(pipeline.Commands, cmd)
+
+		tok := p.peek()
+		if tok == nil || tok.kind != tokenPipe {
+			break
+		}
+		p.pos++
+		p.skipNewlines()
+	}
+	pipeline.Text = string(p.source[p.tokens[start].start:p.tokens[p.pos-1].end])
+	return pipeline, nil
+}
+
+func (p *parser) parseCommand() (*Command, error) {
+	if kw := p.keyword(); kw != "" && kw != "in" {
+		return nil, p.unexpected()
+	}
+
+	cmd := &Command{}
+	for tok := p.peek(); tok != nil; tok = p.peek() {
+		switch tok.kind {
+		case tokenWord:
+			if len(cmd.Args) == 0 || p.pos == p.aliasNext {
+				if err := p.expandAlias(); err != nil {
+					return nil, err
+				}
+				if tok = p.peek(); tok == nil || tok.kind != tokenWord {
+					continue
+				}
+			}
+			if a, ok := parseAssignment(tok.word); ok && len(cmd.Args) == 0 {
+				cmd.Assignments = append(cmd.Assignments, a)
+			} else {
+				cmd.Args = append(cmd.Args, tok.word)
+			}
+			p.pos++
+		case tokenRedirect:
+			r, err := parseRedirect(tok.op)
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			if r.DupFd < 0 {
+				target := p.peek()
+				if target == nil || target.kind != tokenWord {
+					return nil, p.unexpected()
+				}
+				r.Target = target.word
+				p.pos++
+			}
+			cmd.Redirects = append(cmd.Redirects, r)
+		default:
+			if cmd.empty() {
+				return nil, p.unexpected()
+			}
+			return cmd, nil
+		}
+	}
+	if cmd.empty() {
+		return nil, p.unexpected()
+	}
+	return cmd, nil
+}
+
+// parseCompound parses the compound command at the current position, or
+// returns nil if there is none.
+func (p *parser) parseCompound() (Node, error) {
+	switch p.keyword() {
+	case "if":
+		return p.parseIf()
+	case "for":
+		return p.parseFor()
+	case "while", "until":
+		return p.parseLoop()
+	case "{":
+		return p.parseGroup()
+	case "function":
+		return p.parseFuncDef()
+	}
+	return nil, nil
+}
+
+func (p *parser) parseGroup() (Node, error) {
+	p.pos++
+	body, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return &Group{Body: body}, p.expect("}")
+}
+
+// isFuncDef tells whether the input continues with "name()".
+func (p *parser) isFuncDef() bool {
+	if p.pos+2 >= len(p.tokens) {
+		return false
+	}
+	name := p.tokens[p.pos]
+	return funcName(name.word) != "" &&
+		p.tokens[p.pos+1].kind == tokenLParen && p.tokens[p.pos+2].kind == tokenRParen
+}
+
+// parseFuncDef parses "name() body" or "function name [()] body", where
+// the body is a compound command.
+func (p *parser) parseFuncDef() (Node, error) {
+	start := p.pos
+	if p.keyword() == "function" {
+		p.pos++
+	}
+	tok := p.peek()
+	if tok == nil || tok.kind != tokenWord || funcName(tok.word) == "" {
+		return nil, p.unexpected()
+	}
+	def := &FuncDef{Name: funcName(tok.word)}
+	p.pos++
+	if tok := p.peek(); tok != nil && tok.kind == tokenLParen {
+		p.pos++
+		if tok := p.peek(); tok == nil || tok.kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+
+	p.skipNewlines()
+	body, err := p.parseCompound()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := body.(*FuncDef); ok || body == nil {
+		return nil, p.unexpected()
+	}
+	def.Body = body
+	def.Text = string(p.source[p.tokens[start].start:p.tokens[p.pos-1].end])
+	return def, nil
+}
+
+// funcName returns the word as a function name, or "" if it cannot be
+// one. Unlike variables, functions may have dashes and dots in the name.
+func funcName(w Word) string {
+	if len(w) != 1 || w[0].kind != partLiteral || w[0].quoted || reservedWords[w[0].text] {
+		return ""
+	}
+	for _, c := range w[0].text {
+		if !isNameChar(c, false) && c != '-' && c != '.' {
+			return ""
+		}
+	}
+	return w[0].text
+}
+
+// expandAlias replaces an unquoted word that names an alias by the
+// tokens of its value. The replacement keeps the position of the word in
+// the source, so that the text of a pipeline shows what was typed.
+func (p *parser) expandAlias() error {
+	tok := p.peek()
+	if p.aliases == nil || tok == nil || tok.kind != tokenWord || len(tok.word) != 1 || tok.word[0].kind != partLiteral || tok.word[0].quoted {
+		return nil
+	}
+	name := tok.word[0].text
+	if end, ok := p.aliasEnd[name]; ok && p.pos < end {
+		return nil
+	}
+	value, ok := p.aliases.get(name)
+	if !ok {
+		return nil
+	}
+	replacement, err := lex(value)
+	if err != nil {
+		return fmt.Errorf("alias %s: %v", name, err)
+	}
+	for i := range replacement {
+		replacement[i].start, replacement[i].end = tok.start, tok.end
+	}
+
+	tokens := append([]token(nil), p.tokens[:p.pos]...)
+	tokens = append(tokens, replacement...)
+	p.tokens = append(tokens, p.tokens[p.pos+1:]...)
+	for other, end := range p.aliasEnd {
+		if end > p.pos {
+			p.aliasEnd[other] = end + len(replacement) - 1
+		}
+	}
+	p.aliasEnd[name] = p.pos + len(replacement)
+	p.aliasNext = -1
+	if strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t") {
+		p.aliasNext = p.pos + len(replacement)
+	}
+	if len(replacement) > 0 {
+		return p.expandAlias()
+	}
+	return nil
+}
+
+func (p *parser) parseIf() (Node, error) {
+	clause := &IfClause{}
+	p.pos++
+	for {
+		cond, err := p.parseBody()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseBody()
+		if err != nil {
+			return nil, err
+		}
+		clause.Conds = append(clause.Conds, cond)
+		clause.Bodies = append(clause.Bodies, body)
+
+		switch p.keyword() {
+		case "elif":
+			p.pos++
+			continue
+		case "else":
+			p.pos++
+			clause.Else, err = p.parseBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return clause, p.expect("fi")
+	}
+}
+
+func (p *parser) parseLoop() (Node, error) {
+	clause := &LoopClause{Until: p.keyword() == "until"}
+	p.pos++
+
+	var err error
+	clause.Cond, err = p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	clause.Body, err = p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return clause, p.expect("done")
+}
+
+func (p *parser) parseFor() (Node, error) {
+	p.pos++
+	tok := p.peek()
+	if tok == nil || tok.kind != tokenWord || len(tok.word) != 1 || tok.word[0].quoted || !isName(tok.word[0].text) {
+		return nil, p.unexpected()
+	}
+	clause := &ForClause{Name: tok.word[0].text}
+	p.pos++
+
+	p.skipNewlines()
+	if p.keyword() == "in" {
+		clause.In = true
+		p.pos++
+		for tok := p.peek(); tok != nil && tok.kind == tokenWord; tok = p.peek() {
+			clause.Words = append(clause.Words, tok.word)
+			p.pos++
+		}
+	}
+	if tok := p.peek(); tok != nil && (tok.kind == tokenSemicolon || tok.kind == tokenNewline) {
+		p.pos++
+	}
+	p.skipNewlines()
+
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	var err error
+	clause.Body, err = p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return clause, p.expect("done")
+}
+
+func (c *Command) empty() bool {
+	return len(c.Args) == 0 && len(c.Assignments) == 0 && len(c.Redirects) == 0
+}
+
+func parseAssignment(w Word) (Assignment, bool) {
+	if len(w) == 0 || w[0].kind != partLiteral || w[0].quoted {
+		return Assignment{}, false
+	}
+	name, value, ok := strings.Cut(w[0].text, "=")
+	if !ok || !isName(name) {
+		return Assignment{}, false
+	}
+
+	a := Assignment{Name: name}
+	if value != "" {
+		a.Value = append(a.Value, wordPart{kind: partLiteral, text: value})
+	}
+	a.Value = append(a.Value, w[1:]...)
+	return a, true
+}
+
+func parseRedirect(op string) (Redirect, error) {
+	r := Redirect{Fd: 1, DupFd: -1}
+	if op[0] == '1' || op[0] == '2' {
+		r.Fd = int(op[0] - '0')
+		op = op[1:]
+	}
+	switch op {
+	case "<":
+		if r.Fd != 1 {
+			return r, &syntaxError{msg: "unexpected token `" + op + "'"}
+		}
+		r.Fd = 0
+	case ">":
+	case ">>":
+		r.Append = true
+	case ">&1", ">&2":
+		r.DupFd = int(op[2] - '0')
+	default:
+		return r, &syntaxError{msg: "unexpected token `" + op + "'"}
+	}
+	return r, nil
+}
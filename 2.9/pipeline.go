@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// statusError is returned for a process that exited with a non-zero
+// status or was killed by a signal.
+type statusError struct {
+	code   int
+	signal syscall.Signal
+}
+
+func (e *statusError) Error() string {
+	if e.signal != 0 {
+		return "signal: " + e.signal.String()
+	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+var errJobStopped = errors.New("job stopped")
+
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		if statusErr.signal != 0 {
+			return 128 + int(statusErr.signal)
+		}
+		return statusErr.code
+	}
+	if errors.Is(err, errJobStopped) {
+		return 148
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return 127
+	}
+	return 1
+}
+
+// reportError prints errors other than a non-zero exit status, which the
+// command has already explained on its own. A built-in writing to a pipe
+// whose reader has gone away stays silent, as a process killed by SIGPIPE.
+func reportError(w io.Writer, err error) {
+	var statusErr *statusError
+	if err != nil && !errors.As(err, &statusErr) && !errors.Is(err, errJobStopped) && !errors.Is(err, syscall.EPIPE) {
+		fmt.Fprintln(w, errorMessage(err))
+	}
+}
+
+// errorMessage formats an error as "name: message", where name is the
+// command or the file it is about. Built-ins and the parser name the
+// culprit in their errors already.
+func errorMessage(err error) string {
+	var execErr *exec.Error
+	if errors.As(err, &execErr) && errors.Is(execErr.Err, exec.ErrNotFound) {
+		return execErr.Name + ": command not found"
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Path + ": " + pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// stageError reports the error of a command on the stderr of its stage, so
+// that a 2> redirection applies to it, and leaves only its exit status.
+// Control errors pass through to unwind loops, functions and the shell.
+func stageError(stderr io.Writer, err error) error {
+	if err == nil || isControl(err) {
+		return err
+	}
+	reportError(stderr, err)
+	return &statusError{code: exitStatus(err)}
+}
+
+// stageIO holds the files of one pipeline stage. Files in owned were
+// opened for this stage and are closed once the stage no longer needs them.
+type stageIO struct {
+	files [3]*os.File
+	owned []*os.File
+}
+
+func (s *stageIO) close() {
+	for _, f := range s.owned {
+		f.Close()
+	}
+}
+
+// applyRedirects opens the files of the redirections, relative to the
+// directory of the shell.
+func (s *stageIO) applyRedirects(sh *Shell, redirects []Redirect) error {
+	for _, r := range redirects {
+		if r.DupFd >= 0 {
+			s.files[r.Fd] = s.files[r.DupFd]
+			continue
+		}
+
+		path, err := sh.expandTarget(r.Target)
+		if err != nil {
+			return err
+		}
+		var f *os.File
+		switch {
+		case r.Fd == 0:
+			f, err = os.Open(sh.path(path))
+		case r.Append:
+			f, err = os.OpenFile(sh.path(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		default:
+			f, err = os.OpenFile(sh.path(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		}
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		if err != nil {
+			return err
+		}
+		s.owned = append(s.owned, f)
+		s.files[r.Fd] = f
+	}
+	return nil
+}
+
+// runPipeline runs p in the foreground and returns the result of its last
+// command, or starts it as a background job.
+func (sh *Shell) runPipeline(p *Pipeline, stdin, stdout *os.File) error {
+	if p.Background {
+		j := sh.startJob(p, stdin, stdout, false)
+		sh.jobs.add(j)
+		fmt.Fprintf(sh.stderr, "[%d] %d\n", j.id, j.pgid)
+		return nil
+	}
+	return sh.jobs.foreground(sh.startJob(p, stdin, stdout, true), false)
+}
+
+// startJob connects the commands with pipes and starts them in a new
+// process group. The first command reads stdin and the last one writes
+// to stdout.
+func (sh *Shell) startJob(p *Pipeline, stdin, stdout *os.File, foreground bool) *job {
+	j := &job{text: p.Text, procs: make([]*jobProcess, len(p.Commands))}
+	for i := range j.procs {
+		j.procs[i] = &jobProcess{}
+	}
+
+	var prev *os.File
+	for i, c := range p.Commands {
+		stage := &stageIO{files: [3]*os.File{stdin, stdout, sh.stderr}}
+		if prev != nil {
+			stage.files[0] = prev
+			stage.owned = append(stage.owned, prev)
+			prev = nil
+		} else if !foreground && terminalFd < 0 && stdin == sh.stdin {
+			// without job control a background job must not steal the input
+			if null, err := os.Open(os.DevNull); err == nil {
+				stage.files[0] = null
+				stage.owned = append(stage.owned, null)
+			}
+		}
+		if i < len(p.Commands)-1 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				stage.close()
+				sh.jobs.finish(j, j.procs[i], fmt.Errorf("pipe: %v", err))
+				continue
+			}
+			stage.files[1] = w
+			stage.owned = append(stage.owned, w)
+			prev = r
+		}
+
+		sh.startStage(j, j.procs[i], c, stage, foreground, i == len(p.Commands)-1)
+	}
+	if prev != nil {
+		prev.Close()
+	}
+	return j
+}
+
+func (sh *Shell) startStage(j *job, proc *jobProcess, c *Command, stage *stageIO, foreground, last bool) {
+	assignments, err := sh.expandAssignments(c.Assignments)
+	var args []string
+	if err == nil {
+		args, err = sh.expandWords(c.Args)
+	}
+	if err == nil {
+		err = stage.applyRedirects(sh, c.Redirects)
+	}
+	if err != nil {
+		stage.close()
+		sh.jobs.finish(j, proc, err)
+		return
+	}
+
+	if len(args) == 0 {
+		// plain assignments change the shell only outside of pipelines
+		if foreground && last {
+			for _, a := range c.Assignments {
+				sh.vars.set(a.Name, assignments[a.Name])
+			}
+		}
+		stage.close()
+		sh.jobs.finish(j, proc, nil)
+		return
+	}
+
+	// env with a command runs it as an external command or an internal
+	// utility, never as a function or built-in, with the NAME=VALUE
+	// arguments of env added to the prefix assignments
+	viaEnv := false
+	if args[0] == "env" {
+		if extra, rest := envArgs(args[1:]); len(rest) > 0 {
+			for name, value := range extra {
+				assignments[name] = value
+			}
+			args, viaEnv = rest, true
+		}
+	}
+
+	// functions, built-ins and internal utilities run in the shell itself
+	// when they end a foreground pipeline, and otherwise in a goroutine on
+	// a subshell, so that what they change stays within their stage
+	internal := func(run func(sh *Shell) error) {
+		wrapped := func(sh *Shell) error {
+			defer stage.close()
+			return stageError(stage.files[2], sh.vars.withAssignments(assignments, func() error {
+				return run(sh)
+			}))
+		}
+		if foreground && last {
+			sh.jobs.finish(j, proc, wrapped(sh))
+			return
+		}
+		sub := sh.subshell()
+		go func() { sh.jobs.finish(j, proc, wrapped(sub)) }()
+	}
+	if def := sh.functions.get(args[0]); def != nil && !viaEnv {
+		internal(func(sh *Shell) error {
+			return sh.callFunction(def, args, stage.files[0], stage.files[1])
+		})
+		return
+	}
+	if builtin, ok := builtins[args[0]]; ok && !viaEnv {
+		internal(func(sh *Shell) error {
+			return builtin(sh, args, stage.files[0], stage.files[1], stage.files[2])
+		})
+		return
+	}
+	if util, ok := coreutils[args[0]]; ok && sh.hermetic {
+		internal(func(sh *Shell) error {
+			return util(sh, args, stage.files[0], stage.files[1], stage.files[2])
+		})
+		return
+	}
+
+	path, err := sh.lookPath(args[0])
+	if err != nil {
+		sh.jobs.finish(j, proc, stageError(stage.files[2], err))
+		stage.close()
+		return
+	}
+	start := func(path string, args []string) (*exec.Cmd, error) {
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Args[0] = args[0]
+		cmd.Env = sh.vars.environ(assignments)
+		cmd.Dir = sh.dir
+		cmd.Stdin = stage.files[0]
+		cmd.Stdout = stage.files[1]
+		cmd.Stderr = stage.files[2]
+		setProcessGroup(cmd, j.pgid, foreground)
+		return cmd, cmd.Start()
+	}
+	cmd, err := start(path, args)
+	if errors.Is(err, syscall.ENOEXEC) {
+		// a script without a shebang line is run by the shell itself
+		if self, selfErr := os.Executable(); selfErr == nil {
+			cmd, err = start(self, append([]string{args[0], path}, args[1:]...))
+		}
+	}
+	stage.close()
+	if err != nil {
+		sh.jobs.finish(j, proc, err)
+		return
+	}
+	sh.jobs.watch(j, proc, cmd.Process)
+}
@@ -0,0 +1,69 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+var terminalFd = -1
+
+var jobControl bool
+
+func initJobControl(jt *jobTable) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			jt.signalForeground(syscall.SIGINT)
+		}
+	}()
+}
+
+func setProcessGroup(cmd *exec.Cmd, pgid int, foreground bool) {}
+
+func setTerminalForeground(pgid int) {}
+
+func takeTerminal() {}
+
+func signalGroup(pgid int, sig syscall.Signal) error {
+	return errors.New("process groups are not supported on this platform")
+}
+
+func continueGroup(pgid int) error {
+	return errors.New("job control is not supported on this platform")
+}
+
+func waitProcess(p *os.Process) (jobState, error) {
+	state, err := p.Wait()
+	if err != nil {
+		return jobDone, err
+	}
+	if code := state.ExitCode(); code != 0 {
+		return jobDone, &statusError{code: code}
+	}
+	return jobDone, nil
+}
+
+var signalNames = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"HUP", syscall.SIGHUP}, {"INT", syscall.SIGINT}, {"QUIT", syscall.SIGQUIT},
+	{"KILL", syscall.SIGKILL}, {"TERM", syscall.SIGTERM},
+}
+
+func signalProcess(pid int, sig syscall.Signal) error {
+	if pid <= 0 {
+		return errors.New("process groups are not supported on this platform")
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
@@ -0,0 +1,133 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalFd is the controlling terminal of an interactive shell, or -1
+// when stdin is not a terminal and job control is limited to signals.
+var terminalFd = -1
+
+var shellPgid int
+
+// jobControl is enabled for interactive shells. Scripts keep their
+// commands in the process group of the shell.
+var jobControl bool
+
+func initJobControl(jt *jobTable) {
+	jobControl = true
+	shellPgid = syscall.Getpgrp()
+	fd := int(os.Stdin.Fd())
+	if pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP); err == nil && pgrp == shellPgid {
+		terminalFd = fd
+	}
+
+	// keyboard signals reach the shell only while it owns the terminal
+	// or when it has no terminal at all; pass them on to the foreground job
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP)
+	go func() {
+		for sig := range signals {
+			jt.signalForeground(sig.(syscall.Signal))
+		}
+	}()
+}
+
+// setProcessGroup puts the process into the group pgid, or into a new
+// group when pgid is 0. A foreground leader also takes the terminal.
+func setProcessGroup(cmd *exec.Cmd, pgid int, foreground bool) {
+	if !jobControl {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+	if foreground && pgid == 0 && terminalFd >= 0 {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = terminalFd
+	}
+}
+
+func setTerminalForeground(pgid int) {
+	if terminalFd < 0 || pgid == 0 {
+		return
+	}
+	// a background process changing the foreground group gets SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(terminalFd, unix.TIOCSPGRP, pgid)
+}
+
+func takeTerminal() {
+	setTerminalForeground(shellPgid)
+}
+
+func signalGroup(pgid int, sig syscall.Signal) error {
+	if pgid == 0 {
+		return errors.New("no such process group")
+	}
+	return syscall.Kill(-pgid, sig)
+}
+
+func continueGroup(pgid int) error {
+	return signalGroup(pgid, syscall.SIGCONT)
+}
+
+// waitProcess waits until the process exits, stops or continues.
+func waitProcess(p *os.Process) (jobState, error) {
+	var ws syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(p.Pid, &ws, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return jobDone, err
+		}
+		break
+	}
+
+	switch {
+	case ws.Stopped():
+		return jobStopped, nil
+	case ws.Continued():
+		return jobRunning, nil
+	case ws.Signaled():
+		p.Release()
+		return jobDone, &statusError{signal: ws.Signal()}
+	case ws.ExitStatus() != 0:
+		p.Release()
+		return jobDone, &statusError{code: ws.ExitStatus()}
+	}
+	p.Release()
+	return jobDone, nil
+}
+
+// signalNames lists the signals kill knows by name.
+var signalNames = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"HUP", syscall.SIGHUP}, {"INT", syscall.SIGINT}, {"QUIT", syscall.SIGQUIT},
+	{"ILL", syscall.SIGILL}, {"TRAP", syscall.SIGTRAP}, {"ABRT", syscall.SIGABRT},
+	{"BUS", syscall.SIGBUS}, {"FPE", syscall.SIGFPE}, {"KILL", syscall.SIGKILL},
+	{"USR1", syscall.SIGUSR1}, {"SEGV", syscall.SIGSEGV}, {"USR2", syscall.SIGUSR2},
+	{"PIPE", syscall.SIGPIPE}, {"ALRM", syscall.SIGALRM}, {"TERM", syscall.SIGTERM},
+	{"CHLD", syscall.SIGCHLD}, {"CONT", syscall.SIGCONT}, {"STOP", syscall.SIGSTOP},
+	{"TSTP", syscall.SIGTSTP}, {"TTIN", syscall.SIGTTIN}, {"TTOU", syscall.SIGTTOU},
+	{"URG", syscall.SIGURG}, {"XCPU", syscall.SIGXCPU}, {"XFSZ", syscall.SIGXFSZ},
+	{"VTALRM", syscall.SIGVTALRM}, {"PROF", syscall.SIGPROF}, {"WINCH", syscall.SIGWINCH},
+	{"IO", syscall.SIGIO}, {"SYS", syscall.SIGSYS},
+}
+
+// signalProcess sends sig to the process pid, or to the process group
+// -pid when pid is negative.
+func signalProcess(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prompt returns the expanded value of the PS1 or PS2 variable, or def if
+// the variable is not set.
+func (sh *Shell) prompt(name, def string) string {
+	value, ok := sh.vars.get(name)
+	if !ok {
+		return def
+	}
+	return sh.expandPrompt(value, time.Now())
+}
+
+// expandPrompt replaces the escapes of a prompt template:
+//
+//	\u  user name            \h  host name up to the first dot
+//	\H  host name            \w  working directory, with ~ for home
+//	\W  last element of \w   \t  time as HH:MM:SS
+//	\T  time as 12-hour      \A  time as HH:MM
+//	\@  time with am/pm      \d  date as "Mon Jan 02"
+//	\?  exit status          \c  duration of the last command
+//	\g  git branch, followed by * if there are changes
+//	\$  # for root, $ otherwise
+//	\n  newline              \e  escape, for colors
+//	\a  bell                 \\  backslash
+//
+// \[ and \] around non-printing characters are accepted and dropped.
+func (sh *Shell) expandPrompt(ps string, now time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(ps); i++ {
+		if ps[i] != '\\' || i+1 == len(ps) {
+			b.WriteByte(ps[i])
+			continue
+		}
+		i++
+		switch ps[i] {
+		case 'u':
+			if u, err := user.Current(); err == nil {
+				b.WriteString(u.Username)
+			}
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if ps[i] == 'h' {
+				host, _, _ = strings.Cut(host, ".")
+			}
+			b.WriteString(host)
+		case 'w', 'W':
+			b.WriteString(sh.promptDir(ps[i] == 'W'))
+		case 't':
+			b.WriteString(now.Format("15:04:05"))
+		case 'T':
+			b.WriteString(now.Format("03:04:05"))
+		case 'A':
+			b.WriteString(now.Format("15:04"))
+		case '@':
+			b.WriteString(now.Format("03:04 PM"))
+		case 'd':
+			b.WriteString(now.Format("Mon Jan 02"))
+		case '?':
+			b.WriteString(strconv.Itoa(sh.status))
+		case 'c':
+			b.WriteString(formatDuration(sh.duration))
+		case 'g':
+			b.WriteString(gitSegment(sh.dir, sh.git))
+		case '$':
+			if os.Geteuid() == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('$')
+			}
+		case 'n':
+			b.WriteByte('\n')
+		case 'e':
+			b.WriteByte('\x1b')
+		case 'a':
+			b.WriteByte('\a')
+		case '\\':
+			b.WriteByte('\\')
+		case '[', ']':
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(ps[i])
+		}
+	}
+	return b.String()
+}
+
+// promptDir returns the working directory with the home directory shown
+// as ~, or only its last element.
+func (sh *Shell) promptDir(base bool) string {
+	wd := sh.tildePath(sh.dir)
+	if base && wd != "~" && wd != string(filepath.Separator) {
+		return filepath.Base(wd)
+	}
+	return wd
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
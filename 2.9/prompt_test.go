@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpandPrompt(t *testing.T) {
+	home := t.TempDir()
+	os.Mkdir(filepath.Join(home, "src"), 0755)
+
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, []string{"HOME=" + home}, filepath.Join(home, "src"))
+	sh.status, sh.duration = 2, 1500*time.Millisecond
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+
+	testCases := []struct {
+		ps       string
+		expected string
+	}{
+		{"my-shell> ", "my-shell> "},
+		{`\w> `, "~/src> "},
+		{`\W> `, "src> "},
+		{`[\t|\A|\T|\@]`, "[14:07:09|14:07|02:07:09|02:07 PM]"},
+		{`\d`, "Tue Mar 05"},
+		{`\? \c`, "2 1.5s"},
+		{`\[\e[1m\]x\[\e[0m\]\n\\`, "\x1b[1mx\x1b[0m\n\\"},
+		{`\q\`, `\q\`},
+	}
+
+	for _, tc := range testCases {
+		if result := sh.expandPrompt(tc.ps, now); result != tc.expected {
+			t.Errorf("expected %q, got %q for %q", tc.expected, result, tc.ps)
+		}
+	}
+}
+
+func TestExpandPromptGit(t *testing.T) {
+	dir, _ := gitFixture(t)
+	sh := newShell(os.Stdin, os.Stdout, os.Stderr, []string{"HOME=" + dir}, dir)
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+
+	if result := sh.expandPrompt(`(\g) `, now); result != "(main) " {
+		t.Errorf("expected the branch, got %q", result)
+	}
+	writeFile(t, dir, "dir/b.txt", "changed\n")
+	if result := sh.expandPrompt(`\g`, now); result != "main*" {
+		t.Errorf("expected %q, got %q", "main*", result)
+	}
+	sh.dir = t.TempDir()
+	if result := sh.expandPrompt(`[\g]`, now); result != "[]" {
+		t.Errorf("expected nothing outside of a repository, got %q", result)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+type psProcess struct {
+	pid     int32
+	ppid    int32
+	user    string
+	uid     int32
+	cpu     float64
+	mem     float32
+	rss     uint64
+	vsz     uint64
+	start   time.Time
+	cpuTime float64
+	tty     string
+	stat    string
+	nice    int32
+	comm    string
+	args    string
+
+	depth int // nesting level in --forest output
+}
+
+type psColumn struct {
+	header string
+	right  bool
+	value  func(p *psProcess) interface{}
+	format func(p *psProcess) string
+}
+
+var psColumns = map[string]psColumn{
+	"pid": {"PID", true,
+		func(p *psProcess) interface{} { return p.pid },
+		func(p *psProcess) string { return strconv.Itoa(int(p.pid)) }},
+	"ppid": {"PPID", true,
+		func(p *psProcess) interface{} { return p.ppid },
+		func(p *psProcess) string { return strconv.Itoa(int(p.ppid)) }},
+	"user": {"USER", false,
+		func(p *psProcess) interface{} { return p.user },
+		func(p *psProcess) string { return p.user }},
+	"uid": {"UID", true,
+		func(p *psProcess) interface{} { return p.uid },
+		func(p *psProcess) string { return strconv.Itoa(int(p.uid)) }},
+	"%cpu": {"%CPU", true,
+		func(p *psProcess) interface{} { return p.cpu },
+		func(p *psProcess) string { return strconv.FormatFloat(p.cpu, 'f', 1, 64) }},
+	"%mem": {"%MEM", true,
+		func(p *psProcess) interface{} { return float64(p.mem) },
+		func(p *psProcess) string { return strconv.FormatFloat(float64(p.mem), 'f', 1, 32) }},
+	"rss": {"RSS", true,
+		func(p *psProcess) interface{} { return p.rss },
+		func(p *psProcess) string { return strconv.FormatUint(p.rss, 10) }},
+	"vsz": {"VSZ", true,
+		func(p *psProcess) interface{} { return p.vsz },
+		func(p *psProcess) string { return strconv.FormatUint(p.vsz, 10) }},
+	"etime": {"ELAPSED", true,
+		func(p *psProcess) interface{} { return int64(time.Since(p.start).Seconds()) },
+		func(p *psProcess) string { return formatElapsed(time.Since(p.start)) }},
+	"time": {"TIME", true,
+		func(p *psProcess) interface{} { return p.cpuTime },
+		func(p *psProcess) string { return formatCPUTime(p.cpuTime) }},
+	"tty": {"TT", false,
+		func(p *psProcess) interface{} { return p.tty },
+		func(p *psProcess) string { return p.tty }},
+	"stat": {"STAT", false,
+		func(p *psProcess) interface{} { return p.stat },
+		func(p *psProcess) string { return p.stat }},
+	"ni": {"NI", true,
+		func(p *psProcess) interface{} { return p.nice },
+		func(p *psProcess) string { return strconv.Itoa(int(p.nice)) }},
+	"comm": {"COMMAND", false,
+		func(p *psProcess) interface{} { return p.comm },
+		func(p *psProcess) string { return forestPrefix(p) + p.comm }},
+	"args": {"COMMAND", false,
+		func(p *psProcess) interface{} { return p.args },
+		func(p *psProcess) string { return forestPrefix(p) + p.args }},
+	"cmd": {"CMD", false,
+		func(p *psProcess) interface{} { return p.args },
+		func(p *psProcess) string { return forestPrefix(p) + p.args }},
+}
+
+var psAliases = map[string]string{
+	"pcpu": "%cpu", "pmem": "%mem", "command": "args", "ucmd": "comm",
+	"tname": "tty", "nice": "ni", "rssize": "rss", "vsize": "vsz",
+}
+
+var (
+	psDefaultColumns = []string{"pid", "tty", "time", "cmd"}
+	psFullColumns    = []string{"user", "pid", "ppid", "%cpu", "etime", "tty", "time", "args"}
+)
+
+type psOptions struct {
+	all      bool
+	users    []string
+	pids     []int32
+	columns  []string
+	sortKeys []string
+	forest   bool
+	json     bool
+	noHeader bool
+}
+
+func (sh *Shell) psCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, err := parsePsOptions(cmd[1:])
+	if err != nil {
+		return fmt.Errorf("ps: %v", err)
+	}
+	return handlePsCommand(opts, stdout)
+}
+
+// optionValue returns the value of an option given as "-o value",
+// "-ovalue" or "--sort=value".
+func optionValue(args []string, i *int, name string) (string, error) {
+	arg := args[*i]
+	if value, ok := strings.CutPrefix(arg, name+"="); ok && strings.HasPrefix(name, "--") {
+		return value, nil
+	}
+	if arg != name {
+		return strings.TrimPrefix(arg, name), nil
+	}
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("option %s requires an argument", name)
+	}
+	*i++
+	return args[*i], nil
+}
+
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func parsePsOptions(args []string) (psOptions, error) {
+	var opts psOptions
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-e" || arg == "-A":
+			opts.all = true
+		case arg == "-f":
+			opts.columns = append(opts.columns, psFullColumns...)
+		case arg == "--forest":
+			opts.forest = true
+		case arg == "--json":
+			opts.json = true
+		case arg == "--no-headers":
+			opts.noHeader = true
+		case strings.HasPrefix(arg, "--sort"):
+			value, err := optionValue(args, &i, "--sort")
+			if err != nil {
+				return opts, err
+			}
+			opts.sortKeys = append(opts.sortKeys, splitList(value)...)
+		case strings.HasPrefix(arg, "-u"):
+			value, err := optionValue(args, &i, "-u")
+			if err != nil {
+				return opts, err
+			}
+			opts.users = append(opts.users, splitList(value)...)
+		case strings.HasPrefix(arg, "-p"):
+			value, err := optionValue(args, &i, "-p")
+			if err != nil {
+				return opts, err
+			}
+			for _, item := range splitList(value) {
+				pid, err := strconv.Atoi(item)
+				if err != nil {
+					return opts, fmt.Errorf("invalid process id: %s", item)
+				}
+				opts.pids = append(opts.pids, int32(pid))
+			}
+		case strings.HasPrefix(arg, "-o"):
+			value, err := optionValue(args, &i, "-o")
+			if err != nil {
+				return opts, err
+			}
+			opts.columns = append(opts.columns, splitList(value)...)
+		default:
+			return opts, fmt.Errorf("unknown option %s", arg)
+		}
+	}
+
+	if len(opts.columns) == 0 {
+		opts.columns = psDefaultColumns
+	}
+	for i, name := range opts.columns {
+		name = strings.ToLower(name)
+		if alias, ok := psAliases[name]; ok {
+			name = alias
+		}
+		if _, ok := psColumns[name]; !ok {
+			return opts, fmt.Errorf("unknown column %s", opts.columns[i])
+		}
+		opts.columns[i] = name
+	}
+	for i, key := range opts.sortKeys {
+		name := strings.ToLower(strings.TrimLeft(key, "+-"))
+		if alias, ok := psAliases[name]; ok {
+			name = alias
+		}
+		if _, ok := psColumns[name]; !ok {
+			return opts, fmt.Errorf("unknown sort key %s", key)
+		}
+		opts.sortKeys[i] = key[:len(key)-len(strings.TrimLeft(key, "+-"))] + name
+	}
+	return opts, nil
+}
+
+func loadPsProcess(p *process.Process) *psProcess {
+	ps := &psProcess{pid: p.Pid, comm: "?", tty: "?"}
+	ps.ppid, _ = p.Ppid()
+	if name, err := p.Name(); err == nil {
+		ps.comm = name
+	}
+	args, _ := p.Cmdline()
+	// like procps, do not let control characters break the table
+	ps.args = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, args)
+	if ps.args == "" {
+		ps.args = "[" + ps.comm + "]"
+	}
+	ps.user, _ = p.Username()
+	if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+		ps.uid = uids[0]
+		if ps.user == "" {
+			ps.user = strconv.Itoa(int(ps.uid))
+		}
+	}
+	if tty, err := p.Terminal(); err == nil && tty != "" {
+		ps.tty = strings.TrimPrefix(tty, "/")
+	}
+	ps.cpu, _ = p.CPUPercent()
+	ps.mem, _ = p.MemoryPercent()
+	if info, err := p.MemoryInfo(); err == nil {
+		ps.rss = info.RSS / 1024
+		ps.vsz = info.VMS / 1024
+	}
+	if created, err := p.CreateTime(); err == nil {
+		ps.start = time.UnixMilli(created)
+	}
+	if times, err := p.Times(); err == nil {
+		ps.cpuTime = times.User + times.System
+	}
+	ps.stat, _ = p.Status()
+	ps.nice, _ = p.Nice()
+	return ps
+}
+
+// selectProcess applies the selection options. Without any of them ps
+// shows the processes of the current user on the terminal of the shell.
+func (opts psOptions) selectProcess(p *psProcess, self *psProcess) bool {
+	if opts.all {
+		return true
+	}
+	if len(opts.pids) > 0 || len(opts.users) > 0 {
+		for _, pid := range opts.pids {
+			if p.pid == pid {
+				return true
+			}
+		}
+		for _, u := range opts.users {
+			if u == p.user || u == strconv.Itoa(int(p.uid)) {
+				return true
+			}
+		}
+		return false
+	}
+	return p.uid == self.uid && p.tty == self.tty
+}
+
+func handlePsCommand(opts psOptions, stdout io.Writer) error {
+	processes, err := process.Processes()
+	if err != nil {
+		return fmt.Errorf("не удалось получить список процессов: %v", err)
+	}
+
+	self := &psProcess{tty: "?", uid: int32(os.Getuid())}
+	if current, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		self = loadPsProcess(current)
+	}
+
+	var selected []*psProcess
+	for _, p := range processes {
+		ps := loadPsProcess(p)
+		if opts.selectProcess(ps, self) {
+			selected = append(selected, ps)
+		}
+	}
+
+	sortPsProcesses(selected, opts.sortKeys)
+	if opts.forest {
+		selected = forest(selected)
+	}
+
+	if opts.json {
+		return writePsJSON(stdout, selected, opts.columns)
+	}
+	return writePsTable(stdout, selected, opts.columns, !opts.noHeader)
+}
+
+func comparePsValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int32:
+		return compareOrdered(a, b.(int32))
+	case int64:
+		return compareOrdered(a, b.(int64))
+	case uint64:
+		return compareOrdered(a, b.(uint64))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+func compareOrdered[T int32 | int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortPsProcesses orders by the keys of --sort; a "-" prefix sorts in
+// descending order. Processes are listed by pid otherwise.
+func sortPsProcesses(processes []*psProcess, keys []string) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		for _, key := range keys {
+			desc := strings.HasPrefix(key, "-")
+			column := psColumns[strings.TrimLeft(key, "+-")]
+			c := comparePsValues(column.value(processes[i]), column.value(processes[j]))
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return processes[i].pid < processes[j].pid
+	})
+}
+
+// forest reorders the processes so that children follow their parents,
+// keeping the sort order among siblings.
+func forest(processes []*psProcess) []*psProcess {
+	byPid := make(map[int32]bool, len(processes))
+	for _, p := range processes {
+		byPid[p.pid] = true
+	}
+	children := make(map[int32][]*psProcess)
+	var roots []*psProcess
+	for _, p := range processes {
+		if byPid[p.ppid] && p.ppid != p.pid {
+			children[p.ppid] = append(children[p.ppid], p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+
+	result := make([]*psProcess, 0, len(processes))
+	var walk func(p *psProcess, depth int)
+	walk = func(p *psProcess, depth int) {
+		p.depth = depth
+		result = append(result, p)
+		for _, child := range children[p.pid] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return result
+}
+
+func forestPrefix(p *psProcess) string {
+	if p.depth == 0 {
+		return ""
+	}
+	return strings.Repeat("    ", p.depth-1) + " \\_ "
+}
+
+func writePsTable(w io.Writer, processes []*psProcess, columns []string, header bool) error {
+	rows := make([][]string, 0, len(processes)+1)
+	if header {
+		row := make([]string, len(columns))
+		for i, name := range columns {
+			row[i] = psColumns[name].header
+		}
+		rows = append(rows, row)
+	}
+	for _, p := range processes {
+		row := make([]string, len(columns))
+		for i, name := range columns {
+			row[i] = psColumns[name].format(p)
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(columns))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString(" ")
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			switch {
+			case psColumns[columns[i]].right:
+				line.WriteString(pad + cell)
+			case i == len(row)-1:
+				line.WriteString(cell)
+			default:
+				line.WriteString(cell + pad)
+			}
+		}
+		if _, err := fmt.Fprintln(w, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePsJSON(w io.Writer, processes []*psProcess, columns []string) error {
+	result := make([]map[string]interface{}, 0, len(processes))
+	for _, p := range processes {
+		item := make(map[string]interface{}, len(columns))
+		for _, name := range columns {
+			item[name] = psColumns[name].value(p)
+		}
+		result = append(result, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// formatElapsed formats a duration like procps: [[dd-]hh:]mm:ss.
+func formatElapsed(d time.Duration) string {
+	total := int(d.Seconds())
+	days := total / 86400
+	hours := (total % 86400) / 3600
+	minutes := (total % 3600) / 60
+	seconds := total % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, minutes, seconds)
+	case hours > 0:
+		return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
+
+func formatCPUTime(totalSeconds float64) string {
+	total := int(totalSeconds)
+	hours := total / 3600
+	minutes := (total % 3600) / 60
+	seconds := total % 60
+
+	return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+}
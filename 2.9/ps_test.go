@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProcesses returns a synthetic process list, in no particular order:
+//
+//	1 init
+//	├── 10 sshd
+//	│   └── 20 bash
+//	│       ├── 30 vim
+//	│       └── 31 ps
+//	└── 11 cron
+//	5 orphan (its parent is not listed)
+func testProcesses() []*psProcess {
+	return []*psProcess{
+		{pid: 30, ppid: 20, user: "anna", uid: 1000, cpu: 2.5, rss: 9000, tty: "pts/0", cpuTime: 65, comm: "vim", args: "vim notes.txt"},
+		{pid: 11, ppid: 1, user: "root", uid: 0, cpu: 0, rss: 1200, tty: "?", comm: "cron", args: "/usr/sbin/cron -f"},
+		{pid: 1, ppid: 0, user: "root", uid: 0, cpu: 0.1, rss: 4000, tty: "?", cpuTime: 3725, comm: "init", args: "/sbin/init"},
+		{pid: 31, ppid: 20, user: "anna", uid: 1000, cpu: 12.5, rss: 3000, tty: "pts/0", comm: "ps", args: "ps --forest"},
+		{pid: 20, ppid: 10, user: "anna", uid: 1000, cpu: 0.5, rss: 5000, tty: "pts/0", comm: "bash", args: "-bash"},
+		{pid: 10, ppid: 1, user: "root", uid: 0, cpu: 0, rss: 7000, tty: "?", comm: "sshd", args: "sshd: anna [priv]"},
+		{pid: 5, ppid: 3, user: "root", uid: 0, cpu: 0, rss: 0, tty: "?", comm: "orphan", args: "[orphan]"},
+	}
+}
+
+func psPids(processes []*psProcess) []int32 {
+	pids := make([]int32, len(processes))
+	for i, p := range processes {
+		pids[i] = p.pid
+	}
+	return pids
+}
+
+func TestParsePsOptions(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected psOptions
+		hasError bool
+	}{
+		{nil, psOptions{columns: psDefaultColumns}, false},
+		{[]string{"-e", "-o", "pid,PCPU", "--sort=-pcpu,+pid"},
+			psOptions{all: true, columns: []string{"pid", "%cpu"}, sortKeys: []string{"-%cpu", "+pid"}}, false},
+		{[]string{"-opid", "-o", "command", "--sort", "rss"},
+			psOptions{columns: []string{"pid", "args"}, sortKeys: []string{"rss"}}, false},
+		{[]string{"-u", "root,anna", "-p1,20", "--forest", "--json", "--no-headers"},
+			psOptions{users: []string{"root", "anna"}, pids: []int32{1, 20}, columns: psDefaultColumns, forest: true, json: true, noHeader: true}, false},
+		{[]string{"-o", "bogus"}, psOptions{}, true},
+		{[]string{"--sort=-bogus"}, psOptions{}, true},
+		{[]string{"-p", "x"}, psOptions{}, true},
+		{[]string{"-o"}, psOptions{}, true},
+		{[]string{"-x"}, psOptions{}, true},
+	}
+
+	for _, tc := range testCases {
+		opts, err := parsePsOptions(tc.args)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("expected error for %q, but got none", tc.args)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(opts, tc.expected) {
+			t.Errorf("expected %+v, got %+v (%v) for %q", tc.expected, opts, err, tc.args)
+		}
+	}
+}
+
+func TestSelectProcess(t *testing.T) {
+	self := &psProcess{uid: 1000, tty: "pts/0"}
+	testCases := []struct {
+		opts     psOptions
+		expected []int32
+	}{
+		{psOptions{}, []int32{30, 31, 20}},
+		{psOptions{all: true}, []int32{30, 11, 1, 31, 20, 10, 5}},
+		{psOptions{users: []string{"root"}}, []int32{11, 1, 10, 5}},
+		{psOptions{users: []string{"1000"}, pids: []int32{1}}, []int32{30, 1, 31, 20}},
+		{psOptions{pids: []int32{5, 99}}, []int32{5}},
+	}
+
+	for _, tc := range testCases {
+		var selected []*psProcess
+		for _, p := range testProcesses() {
+			if tc.opts.selectProcess(p, self) {
+				selected = append(selected, p)
+			}
+		}
+		if pids := psPids(selected); !reflect.DeepEqual(pids, tc.expected) {
+			t.Errorf("expected %v, got %v for %+v", tc.expected, pids, tc.opts)
+		}
+	}
+}
+
+func TestSortPsProcesses(t *testing.T) {
+	testCases := []struct {
+		keys     []string
+		expected []int32
+	}{
+		{nil, []int32{1, 5, 10, 11, 20, 30, 31}},
+		{[]string{"-%cpu"}, []int32{31, 30, 20, 1, 5, 10, 11}},
+		{[]string{"user", "-rss"}, []int32{30, 20, 31, 10, 1, 11, 5}},
+		{[]string{"+tty", "comm"}, []int32{11, 1, 5, 10, 20, 31, 30}},
+		{[]string{"-time"}, []int32{1, 30, 5, 10, 11, 20, 31}},
+	}
+
+	for _, tc := range testCases {
+		processes := testProcesses()
+		sortPsProcesses(processes, tc.keys)
+		if pids := psPids(processes); !reflect.DeepEqual(pids, tc.expected) {
+			t.Errorf("expected %v, got %v for %q", tc.expected, pids, tc.keys)
+		}
+	}
+}
+
+func TestForest(t *testing.T) {
+	testCases := []struct {
+		keys     []string
+		expected []int32
+		depths   []int
+	}{
+		{nil, []int32{1, 10, 20, 30, 31, 11, 5}, []int{0, 1, 2, 3, 3, 1, 0}},
+		// siblings keep the sort order
+		{[]string{"-pid"}, []int32{5, 1, 11, 10, 20, 31, 30}, []int{0, 0, 1, 1, 2, 3, 3}},
+	}
+
+	for _, tc := range testCases {
+		processes := testProcesses()
+		sortPsProcesses(processes, tc.keys)
+		processes = forest(processes)
+		depths := make([]int, len(processes))
+		for i, p := range processes {
+			depths[i] = p.depth
+		}
+		if pids := psPids(processes); !reflect.DeepEqual(pids, tc.expected) || !reflect.DeepEqual(depths, tc.depths) {
+			t.Errorf("expected %v at depths %v, got %v at %v for %q", tc.expected, tc.depths, pids, depths, tc.keys)
+		}
+	}
+
+	// a process that is its own parent is a root
+	self := []*psProcess{{pid: 7, ppid: 7, comm: "loop"}}
+	if result := forest(self); len(result) != 1 || result[0].depth != 0 {
+		t.Errorf("expected a single root, got %+v", result)
+	}
+}
+
+func TestWritePsTable(t *testing.T) {
+	testCases := []struct {
+		columns  []string
+		forest   bool
+		header   bool
+		expected string
+	}{
+		{[]string{"pid", "tty", "time", "cmd"}, false, true, "" +
+			"PID TT       TIME CMD\n" +
+			"  1 ?     1:02:05 /sbin/init\n" +
+			"  5 ?     0:00:00 [orphan]\n" +
+			" 10 ?     0:00:00 sshd: anna [priv]\n" +
+			" 11 ?     0:00:00 /usr/sbin/cron -f\n" +
+			" 20 pts/0 0:00:00 -bash\n" +
+			" 30 pts/0 0:01:05 vim notes.txt\n" +
+			" 31 pts/0 0:00:00 ps --forest\n"},
+		{[]string{"pid", "user", "%cpu", "comm"}, true, true, "" +
+			"PID USER %CPU COMMAND\n" +
+			"  1 root  0.1 init\n" +
+			" 10 root  0.0  \\_ sshd\n" +
+			" 20 anna  0.5      \\_ bash\n" +
+			" 30 anna  2.5          \\_ vim\n" +
+			" 31 anna 12.5          \\_ ps\n" +
+			" 11 root  0.0  \\_ cron\n" +
+			"  5 root  0.0 orphan\n"},
+		{[]string{"comm", "rss"}, false, false, "" +
+			"init   4000\n" +
+			"orphan    0\n" +
+			"sshd   7000\n" +
+			"cron   1200\n" +
+			"bash   5000\n" +
+			"vim    9000\n" +
+			"ps     3000\n"},
+	}
+
+	for _, tc := range testCases {
+		processes := testProcesses()
+		sortPsProcesses(processes, nil)
+		if tc.forest {
+			processes = forest(processes)
+		}
+		var out bytes.Buffer
+		if err := writePsTable(&out, processes, tc.columns, tc.header); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tc.expected {
+			t.Errorf("expected\n%s\ngot\n%s\nfor %q", tc.expected, out.String(), tc.columns)
+		}
+	}
+
+	// widths count runes, not bytes
+	processes := []*psProcess{{pid: 1, user: "José"}, {pid: 2, user: "ann"}}
+	var out bytes.Buffer
+	writePsTable(&out, processes, []string{"user", "pid"}, false)
+	if expected := "José 1\nann  2\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestWritePsJSON(t *testing.T) {
+	processes := testProcesses()[:2]
+	var out bytes.Buffer
+	if err := writePsJSON(&out, processes, []string{"pid", "user", "%cpu", "rss", "args"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var result []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	expected := []map[string]interface{}{
+		{"pid": 30.0, "user": "anna", "%cpu": 2.5, "rss": 9000.0, "args": "vim notes.txt"},
+		{"pid": 11.0, "user": "root", "%cpu": 0.0, "rss": 1200.0, "args": "/usr/sbin/cron -f"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	out.Reset()
+	writePsJSON(&out, nil, psDefaultColumns)
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("expected an empty array, got %q", out.String())
+	}
+}
+
+func TestFormatPsTimes(t *testing.T) {
+	testCases := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{5 * time.Second, "00:05"},
+		{61 * time.Minute, "01:01:00"},
+		{50*time.Hour + 3*time.Second, "2-02:00:03"},
+	}
+	for _, tc := range testCases {
+		if result := formatElapsed(tc.elapsed); result != tc.expected {
+			t.Errorf("expected %q, got %q for %v", tc.expected, result, tc.elapsed)
+		}
+	}
+	if result := formatCPUTime(3725.9); result != "1:02:05" {
+		t.Errorf("expected %q, got %q", "1:02:05", result)
+	}
+}
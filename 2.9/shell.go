@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Shell is one instance of the interpreter. Everything a command line can
+// change lives here rather than in the process: variables, functions,
+// aliases, jobs and the working directory. Commands read stdin and write
+// to stdout and stderr unless they are redirected.
+type Shell struct {
+	stdin  *os.File
+	stdout *os.File
+	stderr *os.File
+	dir    string
+	dirs   []string // the directory stack below dir
+
+	vars       *variableTable
+	aliases    *aliasTable
+	functions  *functionTable
+	jobs       *jobTable
+	scriptName string   // $0
+	positional []string // $1, $2...
+	status     int      // $?
+	duration   time.Duration
+	git        *gitCache // for \g in the prompt
+
+	// hermetic makes the internal coreutils take the place of the
+	// programs of the same name in $PATH
+	hermetic bool
+
+	// exitWarned is set when exit refused to leave stopped jobs behind; a
+	// second exit right after it goes through
+	exitWarned bool
+}
+
+// newShell creates a shell with the given files, environment in the form
+// of os.Environ and working directory.
+func newShell(stdin, stdout, stderr *os.File, environ []string, dir string) *Shell {
+	sh := &Shell{
+		stdin:      stdin,
+		stdout:     stdout,
+		stderr:     stderr,
+		dir:        dir,
+		vars:       newVariableTable(environ),
+		aliases:    newAliasTable(),
+		functions:  newFunctionTable(),
+		jobs:       newJobTable(stderr),
+		git:        newGitCache(),
+		scriptName: "my-shell",
+	}
+	sh.vars.set("PWD", dir)
+	sh.vars.export("PWD")
+	return sh
+}
+
+// subshell returns a copy of the shell for commands that must not change
+// it, such as the first commands of a pipeline. The copy has its own
+// working directory, variables, aliases and functions, and shares the jobs.
+func (sh *Shell) subshell() *Shell {
+	sub := *sh
+	sub.dirs = append([]string(nil), sh.dirs...)
+	sub.vars = sh.vars.clone()
+	sub.aliases = sh.aliases.clone()
+	sub.functions = sh.functions.clone()
+	sub.positional = append([]string(nil), sh.positional...)
+	sub.git = newGitCache()
+	return &sub
+}
+
+// path resolves a file name against the working directory of the shell.
+func (sh *Shell) path(name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(sh.dir, name)
+}
+
+// execute parses and runs a piece of input, such as a line or a script.
+func (sh *Shell) execute(input string) error {
+	list, err := sh.parse(input)
+	if err != nil {
+		sh.status = 2
+		return err
+	}
+	return sh.runList(list, sh.stdin, sh.stdout)
+}
+
+func (sh *Shell) parse(input string) (*List, error) {
+	return parseWithAliases(input, sh.aliases)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// runShell runs input as the commands of -c in a fresh shell whose
+// working directory and home are dir. It returns stdout, stderr and the
+// status in the format of the golden files, with dir replaced by $DIR.
+func runShell(t *testing.T, dir, input string, args []string, hermetic bool) string {
+	t.Helper()
+	files := t.TempDir()
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(files, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(files, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	environ := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "LC_ALL=C"}
+	sh := newShell(stdin, stdout, stderr, environ, dir)
+	sh.hermetic = hermetic
+	status := sh.runCommand(input, args)
+
+	out, _ := os.ReadFile(stdout.Name())
+	errOut, _ := os.ReadFile(stderr.Name())
+	result := fmt.Sprintf("--- stdout\n%s--- stderr\n%s--- status\n%d\n", out, errOut, status)
+	return strings.ReplaceAll(result, dir, "$DIR")
+}
+
+// TestGolden runs every testdata/*.sh and compares the result with the
+// .golden file next to it. Run with -update after a deliberate change.
+// Scripts named hermetic*.sh run with the internal coreutils.
+func TestGolden(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".sh")
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir, err := filepath.EvalSymlinks(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			hermetic := strings.HasPrefix(name, "hermetic")
+			result := runShell(t, dir, string(input), []string{script}, hermetic)
+
+			golden := strings.TrimSuffix(script, ".sh") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(result), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != string(expected) {
+				t.Errorf("output of %s differs from %s\nexpected:\n%s\ngot:\n%s", script, golden, expected, result)
+			}
+		})
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	testCases := []struct {
+		input    string
+		args     []string
+		expected string
+	}{
+		{`echo $0 $#`, nil, "--- stdout\nmy-shell 0\n--- stderr\n--- status\n0\n"},
+		{`echo $0 $# "$2"`, []string{"name", "a", "b c"}, "--- stdout\nname 2 b c\n--- stderr\n--- status\n0\n"},
+		{`pwd; cd sub`, nil, "--- stdout\n$DIR\n--- stderr\ncd: sub: no such file or directory\n--- status\n1\n"},
+		{`echo a; exit 4; echo b`, nil, "--- stdout\na\n--- stderr\n--- status\n4\n"},
+		{`echo "a`, nil, "--- stdout\n--- stderr\nsyntax error: unterminated double quote\n--- status\n2\n"},
+	}
+
+	for _, tc := range testCases {
+		if result := runShell(t, t.TempDir(), tc.input, tc.args, false); result != tc.expected {
+			t.Errorf("expected %q, got %q for input %q", tc.expected, result, tc.input)
+		}
+	}
+}
+
+// TestPipelineSubshell checks that built-ins before the end of a pipeline
+// change a copy of the shell. Run with -race: the cd runs in a goroutine
+// while the last stage starts in the working directory of the shell.
+func TestPipelineSubshell(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "marker", "")
+	writeFile(t, dir, "sub/inner", "")
+
+	input := "cd sub | ls; pwd\nexport V=1 | true; echo \"[$V]\"\nalias q=echo | true; alias\n"
+	expected := "--- stdout\nmarker\nsub\n$DIR\n[]\n--- stderr\n--- status\n0\n"
+	if result := runShell(t, dir, input, nil, false); result != expected {
+		t.Errorf("expected %q, got %q for input %q", expected, result, input)
+	}
+}
+
+// TestInteractErrors checks that the interactive loop reports errors on
+// stderr in the same format as -c.
+func TestInteractErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := t.TempDir()
+	stdout, err := os.Create(filepath.Join(files, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(files, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	sh := newShell(os.Stdin, stdout, stderr, []string{"PATH=" + os.Getenv("PATH")}, dir)
+	reader := &plainReader{reader: bufio.NewReader(strings.NewReader("cd missing\nfi\n")), out: stdout}
+	if status := sh.interact(reader); status != 2 {
+		t.Errorf("expected status 2, got %d", status)
+	}
+
+	out, _ := os.ReadFile(stdout.Name())
+	errOut, _ := os.ReadFile(stderr.Name())
+	if expected := "my-shell> my-shell> my-shell> "; string(out) != expected {
+		t.Errorf("expected %q on stdout, got %q", expected, out)
+	}
+	if expected := "cd: missing: no such file or directory\nsyntax error: unexpected token `fi'\n"; string(errOut) != expected {
+		t.Errorf("expected %q on stderr, got %q", expected, errOut)
+	}
+}
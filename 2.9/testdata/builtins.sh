@@ -0,0 +1,36 @@
+# built-ins that change or report the state of the shell
+echo hello world
+echo
+pwd
+mkdir sub
+cd sub && pwd
+cd .. && pwd
+cd missing
+cd
+pwd
+export GREETING=hi
+env | grep GREETING
+GREETING=override env | grep GREETING
+echo piped | env GREETING=env sh -c 'cat; echo $GREETING'
+env nosuch-command 2> /dev/null
+echo $?
+unset GREETING
+echo "[$GREETING]"
+alias ll='echo long'
+alias ll
+type ll cd if
+type -t echo
+which cd
+which nosuch
+greet() { echo "hello $1"; }
+greet you
+type greet
+unset -f greet
+greet you
+set_status() { return $1; }
+set_status 3; echo $?
+true; echo $?
+false; echo $?
+echo done
+exit 5
+echo unreachable
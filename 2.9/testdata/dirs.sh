@@ -0,0 +1,50 @@
+# cd, the directory stack, PWD and OLDPWD
+mkdir -p projects/shell/src projects/web tmp
+ln -s projects/shell link
+TOP=$PWD
+echo $PWD
+cd projects/shell && echo "$PWD $OLDPWD"
+cd -
+cd
+pwd
+cd link/src && pwd
+cd .. && pwd
+pwd -P
+cd && cd -P link && pwd
+cd ~ && echo ~+ ~-
+CDPATH=:$HOME/projects
+cd web
+cd tmp
+cd shell/src
+CDPATH=
+cd nowhere
+cd ../missing
+cd ~
+touch file
+cd file
+cd a b
+unset OLDPWD
+cd -
+HOME=
+cd
+HOME=$TOP
+cd ~
+pushd projects
+pushd shell/src
+pushd
+dirs
+dirs -v
+dirs -l +1
+pushd +2
+popd
+dirs -p
+pushd -n ~/tmp
+dirs -1
+popd -n
+popd +1
+popd
+pushd +5
+pushd
+pushd tmp
+dirs -c
+dirs
@@ -0,0 +1,21 @@
+# error messages of the shell and the built-ins
+nosuch-command arg
+echo $?
+cat < missing.txt
+echo $?
+echo x > /nonexistent/dir/file
+F="a b"
+echo x > $F
+touch file
+cd file
+cd missing
+kill -FOO 1
+kill %9
+# the diagnostics of built-ins follow the redirections of their stage
+cd missing 2> err.txt
+echo $?
+kill abc 2>> err.txt
+cat err.txt
+nosuch-command 2> /dev/null
+echo $?
+exit abc
@@ -0,0 +1,33 @@
+# the internal coreutils, alone and in pipelines with external commands
+type ls cat wc
+mkdir -p src/lib docs
+touch src/main.go src/lib/util.go .hidden
+ls
+ls -A
+ls -d src docs
+ls src missing
+printf 'one\ntwo\nthree\nfour\n' > lines.txt
+cat lines.txt
+cat -n lines.txt
+head -n 2 lines.txt
+head -1 lines.txt lines.txt
+tail -n 1 lines.txt
+tail -n +3 lines.txt
+wc lines.txt
+wc -l < lines.txt
+wc -lw lines.txt src/main.go
+cat lines.txt | tr a-z A-Z | head -n 2
+printf 'b\na\n' | sort | cat -n
+cp lines.txt copy.txt
+cp -r src backup
+mv copy.txt docs
+ls backup docs
+cp src dir
+rm src
+rm -r backup
+rm -f gone
+rm gone
+mkdir docs
+cat gone lines.txt | wc -l
+ls -z
+env ls docs
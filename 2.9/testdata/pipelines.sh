@@ -0,0 +1,19 @@
+# pipelines, redirections and the status of commands
+echo one two three | tr a-z A-Z
+printf 'b\na\nc\n' | sort | head -n 2
+echo first > out.txt
+echo second >> out.txt
+cat < out.txt
+wc -l < out.txt
+cat out.txt | grep sec
+cat missing-file 2> err.txt; echo "status $?"
+cat err.txt | wc -l
+cat missing-file 2>&1 | wc -l
+false | true; echo "status $?"
+true | false; echo "status $?"
+! false; echo "status $?"
+false && echo no || echo yes
+touch a.log b.log
+echo *.log
+echo *.none
+for f in *.log; do echo "file $f"; done
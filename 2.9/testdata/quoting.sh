@@ -0,0 +1,27 @@
+# quoting, expansion and field splitting
+NAME="a   b"
+echo $NAME
+echo "$NAME"
+echo '$NAME'
+echo "it's" 'say "hi"'
+echo a\ b\$c
+echo "tab	and \"escape\" \$HOME \\"
+echo ~ ~/x "~"
+echo $HOME/file
+echo "$(echo nested "$(echo deep)")"
+echo $(printf 'x\ny\n')
+# a command substitution changes only a subshell
+mkdir sub
+echo "$(cd sub; pwd)"; pwd
+echo "$(y=5; echo $y)" "[$y]"
+echo "$(f() { echo f; }; f)"; type f
+count() { echo $#; }
+count $NAME
+count "$NAME"
+count ""
+count $EMPTY
+args() { for a in "$@"; do echo "[$a]"; done; }
+args one "two words" 'three'
+echo '*' "*.sh" \*
+echo a#b # comment
+echo "${NAME}x"
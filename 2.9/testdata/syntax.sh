@@ -0,0 +1,4 @@
+# a syntax error stops the script before anything runs
+echo before
+if true; then echo a; fi fi
+echo after
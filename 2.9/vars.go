@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type variable struct {
+	value    string
+	exported bool
+}
+
+// variableTable holds the shell variables. Exported ones make up the
+// environment of the commands started by the shell.
+type variableTable struct {
+	vars  map[string]variable
+	mutex *sync.Mutex
+}
+
+func newVariableTable(environ []string) *variableTable {
+	vt := &variableTable{vars: make(map[string]variable), mutex: &sync.Mutex{}}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && isName(name) {
+			vt.vars[name] = variable{value: value, exported: true}
+		}
+	}
+	return vt
+}
+
+func (vt *variableTable) get(name string) (string, bool) {
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	v, ok := vt.vars[name]
+	return v.value, ok
+}
+
+// set changes the value of a variable and keeps it exported if it was.
+func (vt *variableTable) set(name, value string) {
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	v := vt.vars[name]
+	v.value = value
+	vt.vars[name] = v
+}
+
+func (vt *variableTable) export(name string) {
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	v := vt.vars[name]
+	v.exported = true
+	vt.vars[name] = v
+}
+
+// clone copies the table for a subshell.
+func (vt *variableTable) clone() *variableTable {
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	c := &variableTable{vars: make(map[string]variable, len(vt.vars)), mutex: &sync.Mutex{}}
+	for name, v := range vt.vars {
+		c.vars[name] = v
+	}
+	return c
+}
+
+func (vt *variableTable) unset(name string) {
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	delete(vt.vars, name)
+}
+
+// environ returns the exported variables overridden by the assignments
+// that prefix a command, sorted by name.
+func (vt *variableTable) environ(assignments map[string]string) []string {
+	vt.mutex.Lock()
+	env := make(map[string]string, len(vt.vars)+len(assignments))
+	for name, v := range vt.vars {
+		if v.exported {
+			env[name] = v.value
+		}
+	}
+	vt.mutex.Unlock()
+
+	for name, value := range assignments {
+		env[name] = value
+	}
+	result := make([]string, 0, len(env))
+	for name, value := range env {
+		result = append(result, name+"="+value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// withAssignments runs a built-in with the prefix assignments applied as
+// exported variables and restores the previous values afterwards.
+func (vt *variableTable) withAssignments(assignments map[string]string, run func() error) error {
+	if len(assignments) == 0 {
+		return run()
+	}
+
+	vt.mutex.Lock()
+	saved := make(map[string]*variable, len(assignments))
+	for name, value := range assignments {
+		if v, ok := vt.vars[name]; ok {
+			saved[name] = &v
+		} else {
+			saved[name] = nil
+		}
+		vt.vars[name] = variable{value: value, exported: true}
+	}
+	vt.mutex.Unlock()
+
+	defer func() {
+		vt.mutex.Lock()
+		defer vt.mutex.Unlock()
+		for name, v := range saved {
+			if v == nil {
+				delete(vt.vars, name)
+			} else {
+				vt.vars[name] = *v
+			}
+		}
+	}()
+	return run()
+}
+
+// lookPath searches for the command in the PATH of the shell rather than
+// in the one the shell was started with. Relative names are resolved
+// against the working directory of the shell.
+func (sh *Shell) lookPath(name string) (string, error) {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.ContainsRune(name, '/') {
+		return sh.path(name), nil
+	}
+	path, _ := sh.vars.get("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if found, err := exec.LookPath(filepath.Join(sh.path(dir), name)); err == nil {
+			return found, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// quote returns s quoted for reuse as shell input when it needs quoting.
+func quote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(c rune) bool {
+		return !isNameChar(c, false) && !strings.ContainsRune("-./:,+@%=", c)
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (sh *Shell) exportCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		for _, kv := range sh.vars.environ(nil) {
+			name, value, _ := strings.Cut(kv, "=")
+			fmt.Fprintf(stdout, "export %s=%s\n", name, quote(value))
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			return fmt.Errorf("export: `%s': not a valid identifier", arg)
+		}
+		if hasValue {
+			sh.vars.set(name, value)
+		}
+		sh.vars.export(name)
+	}
+	return nil
+}
+
+func (sh *Shell) unsetCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := cmd[1:]
+	funcs := false
+	if len(args) > 0 && (args[0] == "-v" || args[0] == "-f") {
+		funcs, args = args[0] == "-f", args[1:]
+	}
+	for _, name := range args {
+		if funcs {
+			sh.functions.remove(name)
+			continue
+		}
+		if !isName(name) {
+			return fmt.Errorf("unset: `%s': not a valid identifier", name)
+		}
+		sh.vars.unset(name)
+	}
+	return nil
+}
+
+// envArgs splits the arguments of env into its NAME=VALUE assignments
+// and the command that follows them.
+func envArgs(args []string) (map[string]string, []string) {
+	assignments := make(map[string]string)
+	for len(args) > 0 {
+		name, value, ok := strings.Cut(args[0], "=")
+		if !ok || !isName(name) {
+			break
+		}
+		assignments[name] = value
+		args = args[1:]
+	}
+	return assignments, args
+}
+
+// envCommand prints the environment extended by the NAME=VALUE arguments.
+// With a command after them, env never gets here: startStage runs the
+// command like any other with the assignments added to its own.
+func (sh *Shell) envCommand(cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	assignments, _ := envArgs(cmd[1:])
+	for _, kv := range sh.vars.environ(assignments) {
+		fmt.Fprintln(stdout, kv)
+	}
+	return nil
+}